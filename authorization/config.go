@@ -0,0 +1,53 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	MinSecretLength   = 32
+	DefaultAccessTTL  = time.Minute * 15
+	DefaultRefreshTTL = time.Hour * 24 * 7
+)
+
+// secrets and lifetimes of tokens
+type Config struct {
+	AccessSecret  string
+	RefreshSecret string
+	AccessTTL     time.Duration
+	RefreshTTL    time.Duration
+	// called by CreateToken before issuing tokens, e.g. to refuse blocked users
+	UserAllowed func(ctx context.Context, userId uint64) error
+}
+
+func (c *Config) Validate() error {
+	if len(c.AccessSecret) < MinSecretLength {
+		return fmt.Errorf("access secret must be at least %d bytes long", MinSecretLength)
+	}
+
+	if len(c.RefreshSecret) < MinSecretLength {
+		return fmt.Errorf("refresh secret must be at least %d bytes long", MinSecretLength)
+	}
+
+	if c.AccessSecret == c.RefreshSecret {
+		return fmt.Errorf("access and refresh secrets must be different")
+	}
+
+	return nil
+}
+
+func (c *Config) accessTTL() time.Duration {
+	if c.AccessTTL <= 0 {
+		return DefaultAccessTTL
+	}
+	return c.AccessTTL
+}
+
+func (c *Config) refreshTTL() time.Duration {
+	if c.RefreshTTL <= 0 {
+		return DefaultRefreshTTL
+	}
+	return c.RefreshTTL
+}
@@ -0,0 +1,259 @@
+package authorization
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// OAuth 2.0 device authorization grant (RFC 8628)
+
+const (
+	DeviceCodeTTL      = time.Minute * 10
+	DevicePollInterval = time.Second * 5
+	deviceSlowDownStep = time.Second * 5
+	// letters without vowels to avoid words, as recommended by RFC 8628
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+	// failed and successful approvals of user within DeviceCodeTTL, limits guessing of user codes
+	DeviceApproveMaxAttempts = 10
+)
+
+const (
+	deviceStatusPending  = "pending"
+	deviceStatusApproved = "approved"
+	deviceStatusDenied   = "denied"
+)
+
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// error of token endpoint, Code is one of error codes from RFC 8628 section 3.5
+type DeviceError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *DeviceError) Error() string {
+	if e.Description != "" {
+		return e.Code + ": " + e.Description
+	}
+	return e.Code
+}
+
+func deviceCodeKey(deviceCode string) string {
+	return "device_code:" + hashCode(deviceCode)
+}
+
+func deviceUserCodeKey(userCode string) string {
+	return "device_user_code:" + userCode
+}
+
+func deviceApproveAttemptsKey(userId uint64) string {
+	return fmt.Sprintf("device_approve_attempts:%d", userId)
+}
+
+// set result of pending authorization and delete user code in one step, so status is changed
+// only once and expired authorization is not recreated without TTL. Returns client id.
+var approveDeviceScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'status') ~= 'pending' then
+  return false
+end
+redis.call('HSET', KEYS[1], 'status', ARGV[1], 'user_id', ARGV[2])
+redis.call('DEL', KEYS[2])
+return redis.call('HGET', KEYS[1], 'client_id')
+`)
+
+// check client and store time of poll in one step, so expired authorization is not recreated
+// without TTL. Interval is increased when device polls too often.
+// Returns client id, status, user id and 1 for slow down, or nil when authorization is expired.
+var pollDeviceScript = redis.NewScript(`
+local values = redis.call('HMGET', KEYS[1], 'client_id', 'status', 'user_id', 'interval', 'last_poll')
+if not values[2] then
+  return false
+end
+if values[1] ~= ARGV[1] then
+  return {values[1] or '', values[2], '', 0}
+end
+redis.call('HSET', KEYS[1], 'last_poll', ARGV[2])
+if values[2] == 'pending' and tonumber(ARGV[2]) - (tonumber(values[5]) or 0) < (tonumber(values[4]) or 0) then
+  redis.call('HINCRBY', KEYS[1], 'interval', ARGV[3])
+  return {values[1], values[2], '', 1}
+end
+return {values[1], values[2], values[3] or '', 0}
+`)
+
+// remove formatting from user code typed by user
+func NormalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(userCode))
+}
+
+// create device code for client and user code for approval in browser
+func CreateDeviceAuthorization(clientID string, verificationURI string, client *redis.Client, ctx context.Context) (*DeviceAuthorization, error) {
+	deviceCode, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	userCode := make([]byte, userCodeLength)
+	for i := range userCode {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return nil, err
+		}
+		userCode[i] = userCodeAlphabet[n.Int64()]
+	}
+
+	// user code is short, reject on rare collision instead of overwriting
+	created, err := client.SetNX(ctx, deviceUserCodeKey(string(userCode)), deviceCodeKey(deviceCode), DeviceCodeTTL).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if !created {
+		return nil, fmt.Errorf("unable to create user code, try again")
+	}
+
+	pipe := client.TxPipeline()
+	pipe.HSet(ctx, deviceCodeKey(deviceCode),
+		"client_id", clientID,
+		"user_code", string(userCode),
+		"status", deviceStatusPending,
+		"interval", int(DevicePollInterval.Seconds()),
+		"last_poll", 0,
+	)
+	pipe.Expire(ctx, deviceCodeKey(deviceCode), DeviceCodeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	formatted := string(userCode[:4]) + "-" + string(userCode[4:])
+
+	return &DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                formatted,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + formatted,
+		ExpiresIn:               int(DeviceCodeTTL.Seconds()),
+		Interval:                int(DevicePollInterval.Seconds()),
+	}, nil
+}
+
+// approve or deny device authorization by user code. Returns client id of device
+func ApproveDeviceCode(userCode string, userId uint64, approve bool, client *redis.Client, ctx context.Context) (string, error) {
+	attemptsKey := deviceApproveAttemptsKey(userId)
+
+	pipe := client.TxPipeline()
+	attempts := pipe.Incr(ctx, attemptsKey)
+	pipe.Expire(ctx, attemptsKey, DeviceCodeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	if attempts.Val() > DeviceApproveMaxAttempts {
+		return "", fmt.Errorf("too many attempts, try again later")
+	}
+
+	normalized := NormalizeUserCode(userCode)
+
+	key, err := client.Get(ctx, deviceUserCodeKey(normalized)).Result()
+	if err == redis.Nil {
+		return "", fmt.Errorf("code is expired or invalid")
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	status := deviceStatusDenied
+	if approve {
+		status = deviceStatusApproved
+	}
+
+	clientID, err := approveDeviceScript.Run(ctx, client, []string{key, deviceUserCodeKey(normalized)}, status, userId).Text()
+	if err == redis.Nil {
+		return "", fmt.Errorf("code is expired or invalid")
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return clientID, nil
+}
+
+// token request of polling device. Returns *DeviceError while authorization is not finished
+func PollDeviceToken(config *Config, deviceCode string, clientID string, client *redis.Client, ctx context.Context) (*TokenDetails, error) {
+	key := deviceCodeKey(deviceCode)
+
+	now := time.Now().Unix()
+	result, err := pollDeviceScript.Run(ctx, client, []string{key}, clientID, now, int64(deviceSlowDownStep.Seconds())).Result()
+	if err == redis.Nil {
+		return nil, &DeviceError{Code: "expired_token"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 4 {
+		return nil, fmt.Errorf("unexpected result of device poll: %v", result)
+	}
+
+	storedClientID, status, userIdValue := stringValue(values[0]), stringValue(values[1]), stringValue(values[2])
+
+	if storedClientID != clientID {
+		return nil, &DeviceError{Code: "invalid_grant", Description: "device code was issued to another client"}
+	}
+
+	if slowDown, _ := values[3].(int64); slowDown == 1 {
+		return nil, &DeviceError{Code: "slow_down"}
+	}
+
+	switch status {
+	case deviceStatusPending:
+		return nil, &DeviceError{Code: "authorization_pending"}
+	case deviceStatusDenied:
+		client.Del(ctx, key)
+		return nil, &DeviceError{Code: "access_denied"}
+	}
+
+	// only the first of concurrent polls is able to delete the code and get tokens
+	deleted, err := client.Del(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if deleted == 0 {
+		return nil, &DeviceError{Code: "expired_token"}
+	}
+
+	userId, err := strconv.Atoi(userIdValue)
+	if err != nil {
+		return nil, &DeviceError{Code: "invalid_grant"}
+	}
+
+	return CreateToken(config, userId, client, ctx)
+}
+
+func stringValue(value interface{}) string {
+	str, _ := value.(string)
+	return str
+}
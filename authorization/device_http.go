@@ -0,0 +1,91 @@
+package authorization
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// device authorization endpoint, takes client_id from form
+func DeviceCodeHandler(client *redis.Client, verificationURI string, allowedClients []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeOAuthJSON(w, http.StatusBadRequest, &DeviceError{Code: "invalid_request"})
+			return
+		}
+
+		clientID := r.PostForm.Get("client_id")
+		if !isAllowedClient(clientID, allowedClients) {
+			writeOAuthJSON(w, http.StatusUnauthorized, &DeviceError{Code: "invalid_client"})
+			return
+		}
+
+		result, err := CreateDeviceAuthorization(clientID, verificationURI, client, r.Context())
+		if err != nil {
+			writeOAuthJSON(w, http.StatusInternalServerError, &DeviceError{Code: "server_error"})
+			return
+		}
+
+		writeOAuthJSON(w, http.StatusOK, result)
+	}
+}
+
+// token endpoint for device_code grant type
+func DeviceTokenHandler(config *Config, client *redis.Client, allowedClients []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeOAuthJSON(w, http.StatusBadRequest, &DeviceError{Code: "invalid_request"})
+			return
+		}
+
+		if r.PostForm.Get("grant_type") != deviceCodeGrantType {
+			writeOAuthJSON(w, http.StatusBadRequest, &DeviceError{Code: "unsupported_grant_type"})
+			return
+		}
+
+		clientID := r.PostForm.Get("client_id")
+		if !isAllowedClient(clientID, allowedClients) {
+			writeOAuthJSON(w, http.StatusUnauthorized, &DeviceError{Code: "invalid_client"})
+			return
+		}
+
+		token, err := PollDeviceToken(config, r.PostForm.Get("device_code"), clientID, client, r.Context())
+		if deviceErr, ok := err.(*DeviceError); ok {
+			writeOAuthJSON(w, http.StatusBadRequest, deviceErr)
+			return
+		}
+
+		if err != nil {
+			writeOAuthJSON(w, http.StatusInternalServerError, &DeviceError{Code: "server_error"})
+			return
+		}
+
+		writeOAuthJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token":  token.AccessToken,
+			"refresh_token": token.RefreshToken,
+			"token_type":    "Bearer",
+			"expires_in":    token.AtExpires - time.Now().Unix(),
+		})
+	}
+}
+
+func isAllowedClient(clientID string, allowedClients []string) bool {
+	for _, allowed := range allowedClients {
+		if clientID != "" && clientID == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeOAuthJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
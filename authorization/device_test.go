@@ -0,0 +1,148 @@
+package authorization
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestApproveDeviceCode(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestRedis(t)
+
+	device, err := CreateDeviceAuthorization("cli", "http://localhost/device", client, ctx)
+	if err != nil {
+		t.Fatalf("CreateDeviceAuthorization: %v", err)
+	}
+
+	// typed by user in lower case
+	clientID, err := ApproveDeviceCode(strings.ToLower(device.UserCode), 5, true, client, ctx)
+	if err != nil {
+		t.Fatalf("ApproveDeviceCode: %v", err)
+	}
+
+	if clientID != "cli" {
+		t.Fatalf("got client id %q, want cli", clientID)
+	}
+
+	if _, err := ApproveDeviceCode(device.UserCode, 6, false, client, ctx); err == nil {
+		t.Fatalf("user code is used twice")
+	}
+
+	key := deviceCodeKey(device.DeviceCode)
+	if server.HGet(key, "status") != deviceStatusApproved || server.HGet(key, "user_id") != "5" {
+		t.Fatalf("authorization is not approved by first user")
+	}
+
+	if server.TTL(key) <= 0 {
+		t.Fatalf("approved authorization has no TTL")
+	}
+
+	config := &Config{AccessSecret: strings.Repeat("a", MinSecretLength), RefreshSecret: strings.Repeat("r", MinSecretLength)}
+	if _, err := PollDeviceToken(config, device.DeviceCode, "cli", client, ctx); err != nil {
+		t.Fatalf("PollDeviceToken: %v", err)
+	}
+}
+
+func TestApproveDeviceCodeExpired(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestRedis(t)
+
+	device, err := CreateDeviceAuthorization("cli", "http://localhost/device", client, ctx)
+	if err != nil {
+		t.Fatalf("CreateDeviceAuthorization: %v", err)
+	}
+
+	// user code outlives authorization, e.g. when it was deleted by denied poll
+	server.Del(deviceCodeKey(device.DeviceCode))
+
+	if _, err := ApproveDeviceCode(device.UserCode, 5, true, client, ctx); err == nil {
+		t.Fatalf("expired authorization is approved")
+	}
+
+	if server.Exists(deviceCodeKey(device.DeviceCode)) {
+		t.Fatalf("expired authorization is recreated")
+	}
+}
+
+func TestApproveDeviceCodeAttemptsLimit(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestRedis(t)
+
+	device, err := CreateDeviceAuthorization("cli", "http://localhost/device", client, ctx)
+	if err != nil {
+		t.Fatalf("CreateDeviceAuthorization: %v", err)
+	}
+
+	for i := 0; i < DeviceApproveMaxAttempts; i++ {
+		if _, err := ApproveDeviceCode("BBBB-BBBB", 5, true, client, ctx); err == nil {
+			t.Fatalf("guessed user code is approved")
+		}
+	}
+
+	_, err = ApproveDeviceCode(device.UserCode, 5, true, client, ctx)
+	if err == nil || err.Error() != "too many attempts, try again later" {
+		t.Fatalf("got error %v, want attempts limit", err)
+	}
+
+	// limit is per user
+	if _, err := ApproveDeviceCode(device.UserCode, 6, true, client, ctx); err != nil {
+		t.Fatalf("another user is limited: %v", err)
+	}
+
+	server.FastForward(DeviceCodeTTL)
+
+	if _, err := ApproveDeviceCode("BBBB-BBBB", 5, true, client, ctx); err == nil || strings.Contains(err.Error(), "too many") {
+		t.Fatalf("limit is not reset after TTL: %v", err)
+	}
+}
+
+func TestPollDeviceToken(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestRedis(t)
+	config := &Config{AccessSecret: strings.Repeat("a", MinSecretLength), RefreshSecret: strings.Repeat("r", MinSecretLength)}
+
+	device, err := CreateDeviceAuthorization("cli", "http://localhost/device", client, ctx)
+	if err != nil {
+		t.Fatalf("CreateDeviceAuthorization: %v", err)
+	}
+	key := deviceCodeKey(device.DeviceCode)
+
+	tests := []struct {
+		name     string
+		clientID string
+		want     string
+	}{
+		{name: "another client", clientID: "web", want: "invalid_grant"},
+		{name: "first poll", clientID: "cli", want: "authorization_pending"},
+		{name: "poll within interval", clientID: "cli", want: "slow_down"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := PollDeviceToken(config, device.DeviceCode, test.clientID, client, ctx)
+			if deviceErr, ok := err.(*DeviceError); !ok || deviceErr.Code != test.want {
+				t.Fatalf("got error %v, want %s", err, test.want)
+			}
+
+			if server.TTL(key) <= 0 {
+				t.Fatalf("authorization has no TTL after poll")
+			}
+		})
+	}
+
+	if interval := server.HGet(key, "interval"); interval != "10" {
+		t.Fatalf("got interval %s after slow down, want 10", interval)
+	}
+
+	server.FastForward(DeviceCodeTTL)
+
+	_, err = PollDeviceToken(config, device.DeviceCode, "cli", client, ctx)
+	if deviceErr, ok := err.(*DeviceError); !ok || deviceErr.Code != "expired_token" {
+		t.Fatalf("got error %v, want expired_token", err)
+	}
+
+	if server.Exists(key) {
+		t.Fatalf("expired authorization is recreated by poll")
+	}
+}
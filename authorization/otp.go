@@ -0,0 +1,150 @@
+package authorization
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	OneTimeCodeTTL         = time.Minute * 10
+	OneTimeCodeMaxAttempts = 5
+	OneTimeCodeCooldown    = time.Minute
+	oneTimeCodeDigits      = 6
+)
+
+type OneTimeCode struct {
+	// short numeric code for typing by hand
+	Code string
+	// long random token for links
+	LinkToken string
+	ExpiresAt time.Time
+}
+
+func oneTimeCodeKey(purpose string, subject string) string {
+	return fmt.Sprintf("otp:%s:%s", purpose, subject)
+}
+
+// create single-use code for purpose (login, phone...) and subject (email, phone...)
+// and store hashes of it in redis. Previous code for the same subject is replaced.
+func CreateOneTimeCode(purpose string, subject string, client *redis.Client, ctx context.Context) (*OneTimeCode, error) {
+	key := oneTimeCodeKey(purpose, subject)
+
+	// do not allow to spam codes, also applied to subjects which do not exist
+	allowed, err := client.SetNX(ctx, key+":cooldown", 1, OneTimeCodeCooldown).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if !allowed {
+		return nil, fmt.Errorf("code was requested recently, try again later")
+	}
+
+	code, err := randomDigits(oneTimeCodeDigits)
+	if err != nil {
+		return nil, err
+	}
+
+	linkToken, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := client.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, "code", hashCode(code), "link", hashCode(linkToken), "attempts", 0)
+	pipe.Expire(ctx, key, OneTimeCodeTTL)
+	_, err = pipe.Exec(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &OneTimeCode{
+		Code:      code,
+		LinkToken: linkToken,
+		ExpiresAt: time.Now().Add(OneTimeCodeTTL),
+	}, nil
+}
+
+// check code or link token given by user. Code is deleted after successful check
+// or when attempts limit is reached
+func VerifyOneTimeCode(purpose string, subject string, code string, client *redis.Client, ctx context.Context) error {
+	key := oneTimeCodeKey(purpose, subject)
+
+	attempts, err := client.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		return err
+	}
+
+	stored, err := client.HMGet(ctx, key, "code", "link").Result()
+	if err != nil {
+		return err
+	}
+
+	codeHash, _ := stored[0].(string)
+	linkHash, _ := stored[1].(string)
+
+	// HIncrBy creates the key when it doesn't exist
+	if codeHash == "" {
+		client.Del(ctx, key)
+		return fmt.Errorf("code is expired or invalid")
+	}
+
+	if attempts > OneTimeCodeMaxAttempts {
+		client.Del(ctx, key)
+		return fmt.Errorf("too many attempts, request a new code")
+	}
+
+	given := hashCode(code)
+	if subtle.ConstantTimeCompare([]byte(given), []byte(codeHash)) != 1 &&
+		subtle.ConstantTimeCompare([]byte(given), []byte(linkHash)) != 1 {
+		return fmt.Errorf("code is expired or invalid")
+	}
+
+	// only the first of concurrent requests is able to delete the key
+	deleted, err := client.Del(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return fmt.Errorf("code is expired or invalid")
+	}
+
+	return nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomDigits(length int) (string, error) {
+	result := make([]byte, length)
+	for i := range result {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		result[i] = byte('0' + n.Int64())
+	}
+
+	return string(result), nil
+}
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,137 @@
+package authorization
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return server, client
+}
+
+func TestVerifyOneTimeCode(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// prepare state and return code to verify
+		given   func(t *testing.T, server *miniredis.Miniredis, client *redis.Client, code *OneTimeCode) string
+		wantErr string
+	}{
+		{
+			name: "code",
+			given: func(t *testing.T, server *miniredis.Miniredis, client *redis.Client, code *OneTimeCode) string {
+				return code.Code
+			},
+		},
+		{
+			name: "link token",
+			given: func(t *testing.T, server *miniredis.Miniredis, client *redis.Client, code *OneTimeCode) string {
+				return code.LinkToken
+			},
+		},
+		{
+			name: "wrong code",
+			given: func(t *testing.T, server *miniredis.Miniredis, client *redis.Client, code *OneTimeCode) string {
+				return wrongCode(code.Code)
+			},
+			wantErr: "code is expired or invalid",
+		},
+		{
+			name: "expired",
+			given: func(t *testing.T, server *miniredis.Miniredis, client *redis.Client, code *OneTimeCode) string {
+				server.FastForward(OneTimeCodeTTL)
+				return code.Code
+			},
+			wantErr: "code is expired or invalid",
+		},
+		{
+			name: "used twice",
+			given: func(t *testing.T, server *miniredis.Miniredis, client *redis.Client, code *OneTimeCode) string {
+				if err := VerifyOneTimeCode("login", "user@example.com", code.Code, client, ctx); err != nil {
+					t.Fatalf("first verification: %v", err)
+				}
+				return code.Code
+			},
+			wantErr: "code is expired or invalid",
+		},
+		{
+			name: "correct code after attempts limit",
+			given: func(t *testing.T, server *miniredis.Miniredis, client *redis.Client, code *OneTimeCode) string {
+				for i := 0; i < OneTimeCodeMaxAttempts; i++ {
+					VerifyOneTimeCode("login", "user@example.com", wrongCode(code.Code), client, ctx)
+				}
+				return code.Code
+			},
+			wantErr: "too many attempts, request a new code",
+		},
+		{
+			name: "another purpose",
+			given: func(t *testing.T, server *miniredis.Miniredis, client *redis.Client, code *OneTimeCode) string {
+				if err := VerifyOneTimeCode("phone", "user@example.com", code.Code, client, ctx); err == nil {
+					t.Fatalf("code of login is accepted for phone")
+				}
+				return code.Code
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, client := newTestRedis(t)
+
+			code, err := CreateOneTimeCode("login", "user@example.com", client, ctx)
+			if err != nil {
+				t.Fatalf("CreateOneTimeCode: %v", err)
+			}
+
+			err = VerifyOneTimeCode("login", "user@example.com", test.given(t, server, client, code), client, ctx)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != test.wantErr {
+				t.Fatalf("got error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateOneTimeCodeCooldown(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestRedis(t)
+
+	if _, err := CreateOneTimeCode("login", "user@example.com", client, ctx); err != nil {
+		t.Fatalf("CreateOneTimeCode: %v", err)
+	}
+
+	if _, err := CreateOneTimeCode("login", "user@example.com", client, ctx); err == nil {
+		t.Fatalf("second code is created during cooldown")
+	}
+
+	server.FastForward(OneTimeCodeCooldown)
+
+	if _, err := CreateOneTimeCode("login", "user@example.com", client, ctx); err != nil {
+		t.Fatalf("code after cooldown: %v", err)
+	}
+}
+
+// code of the same length which differs from code
+func wrongCode(code string) string {
+	if code[0] == '0' {
+		return "1" + code[1:]
+	}
+	return "0" + code[1:]
+}
@@ -3,7 +3,6 @@ package authorization
 import (
 	"context"
 	"fmt"
-	"os"
 	"strconv"
 	"time"
 
@@ -39,7 +38,8 @@ func createRedisAuth(userid uint64, td *TokenDetails, client *redis.Client, ctx
 	if errRefresh != nil {
 		return errRefresh
 	}
-	return nil
+
+	return addSession(userid, td, client, ctx)
 }
 
 // delete key from redis
@@ -52,12 +52,12 @@ func DeleteAuthFromRedis(givenUuid string, client *redis.Client, ctx context.Con
 }
 
 // use refresh token to create new access token and refresh token
-func Refresh(refresh_token string, client *redis.Client, ctx context.Context) (map[string]string, error) {
+func Refresh(config *Config, refresh_token string, client *redis.Client, ctx context.Context) (map[string]string, error) {
 	token, err := jwt.Parse(refresh_token, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("REFRESH_SECRET")), nil
+		return []byte(config.RefreshSecret), nil
 	})
 
 	if err != nil {
@@ -111,20 +111,20 @@ func Refresh(refresh_token string, client *redis.Client, ctx context.Context) (m
 			return nil, fmt.Errorf("refresh token is expired")
 		}
 
-		ts, createErr := CreateToken(int(userId), client, ctx)
+		ts, createErr := CreateToken(config, int(userId), client, ctx)
+
+		if createErr != nil {
+			return nil, createErr
+		}
 
 		// set for old refresh keys uuid new value with new refreshUuid
 		// for delete it when it was used second time
-		errUpdateOldRefresh := client.Set(ctx, refreshUuid, ts.RefreshUuid, time.Hour*24*7)
+		errUpdateOldRefresh := client.Set(ctx, refreshUuid, ts.RefreshUuid, config.refreshTTL())
 
 		if errUpdateOldRefresh.Err() != nil {
 			return nil, errUpdateOldRefresh.Err()
 		}
 
-		if createErr != nil {
-			return nil, createErr
-		}
-
 		saveErr := createRedisAuth(userId, ts, client, ctx)
 
 		if saveErr != nil {
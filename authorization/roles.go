@@ -0,0 +1,31 @@
+package authorization
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// check that user has one of given roles. Role is taken from database,
+// so changes are applied without new tokens
+func CheckRole(pgsql *sqlx.DB, userId uint64, roles ...string) error {
+	var role string
+	err := pgsql.Get(&role, "SELECT role FROM users WHERE id=$1", userId)
+	if err != nil {
+		return fmt.Errorf("access denied")
+	}
+
+	for _, allowed := range roles {
+		if role == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("access denied")
+}
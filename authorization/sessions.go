@@ -0,0 +1,87 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Session is a pair of access and refresh tokens issued by CreateToken
+type Session struct {
+	AccessUuid  string    `json:"access_uuid"`
+	RefreshUuid string    `json:"refresh_uuid"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// hash of sessions of user, field is access uuid
+func sessionsKey(userId uint64) string {
+	return fmt.Sprintf("user_sessions:%d", userId)
+}
+
+func addSession(userId uint64, td *TokenDetails, client *redis.Client, ctx context.Context) error {
+	session, err := json.Marshal(Session{
+		AccessUuid:  td.AccessUuid,
+		RefreshUuid: td.RefreshUuid,
+		CreatedAt:   time.Now().UTC(),
+		ExpiresAt:   time.Unix(td.RtExpires, 0).UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	key := sessionsKey(userId)
+	pipe := client.TxPipeline()
+	pipe.HSet(ctx, key, td.AccessUuid, session)
+	pipe.ExpireAt(ctx, key, time.Unix(td.RtExpires, 0))
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+// list of not expired sessions of user, expired ones are removed from index
+func UserSessions(userId uint64, client *redis.Client, ctx context.Context) ([]Session, error) {
+	key := sessionsKey(userId)
+	values, err := client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	now := time.Now()
+
+	for accessUuid, value := range values {
+		var session Session
+		if err := json.Unmarshal([]byte(value), &session); err != nil || session.ExpiresAt.Before(now) {
+			client.HDel(ctx, key, accessUuid)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// delete access and refresh keys of all sessions of user
+func RevokeUserSessions(userId uint64, client *redis.Client, ctx context.Context) error {
+	key := sessionsKey(userId)
+	values, err := client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	keys := []string{key}
+	for accessUuid, value := range values {
+		keys = append(keys, accessUuid)
+
+		var session Session
+		if err := json.Unmarshal([]byte(value), &session); err == nil && session.RefreshUuid != "" {
+			keys = append(keys, session.RefreshUuid)
+		}
+	}
+
+	return client.Del(ctx, keys...).Err()
+}
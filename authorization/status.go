@@ -0,0 +1,39 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	StatusActive              = "active"
+	StatusSuspended           = "suspended"
+	StatusDeactivated         = "deactivated"
+	StatusPendingVerification = "pending_verification"
+)
+
+var Statuses = []string{StatusActive, StatusSuspended, StatusDeactivated, StatusPendingVerification}
+
+// check that account of user is active
+func CheckActive(ctx context.Context, pgsql *sqlx.DB, userId uint64) error {
+	var status string
+	err := pgsql.GetContext(ctx, &status, "SELECT status FROM users WHERE id=$1", userId)
+	if err != nil {
+		return fmt.Errorf("account not found")
+	}
+
+	switch status {
+	case StatusActive:
+		return nil
+	case StatusSuspended:
+		return fmt.Errorf("account is suspended")
+	case StatusDeactivated:
+		return fmt.Errorf("account is deactivated")
+	case StatusPendingVerification:
+		return fmt.Errorf("account is pending verification")
+	}
+
+	return fmt.Errorf("account is not active")
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -38,12 +37,18 @@ type Tokens struct {
 }
 
 // generate tokens and store it to redis
-func CreateToken(userId int, client *redis.Client, ctx context.Context) (*TokenDetails, error) {
+func CreateToken(config *Config, userId int, client *redis.Client, ctx context.Context) (*TokenDetails, error) {
+	if config.UserAllowed != nil {
+		if err := config.UserAllowed(ctx, uint64(userId)); err != nil {
+			return nil, err
+		}
+	}
+
 	td := &TokenDetails{}
-	td.AtExpires = time.Now().Add(time.Minute * 15).Unix()
+	td.AtExpires = time.Now().Add(config.accessTTL()).Unix()
 	td.AccessUuid = uuid.New().String()
 
-	td.RtExpires = time.Now().Add(time.Hour * 24 * 7).Unix()
+	td.RtExpires = time.Now().Add(config.refreshTTL()).Unix()
 	td.RefreshUuid = uuid.New().String()
 
 	var err error
@@ -54,7 +59,7 @@ func CreateToken(userId int, client *redis.Client, ctx context.Context) (*TokenD
 	atClaims["authorized"] = true
 	atClaims["exp"] = td.AtExpires
 	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	td.AccessToken, err = at.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
+	td.AccessToken, err = at.SignedString([]byte(config.AccessSecret))
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +69,7 @@ func CreateToken(userId int, client *redis.Client, ctx context.Context) (*TokenD
 	rtClaims["user_id"] = userId
 	rtClaims["exp"] = td.RtExpires
 	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
-	td.RefreshToken, err = rt.SignedString([]byte(os.Getenv("REFRESH_SECRET")))
+	td.RefreshToken, err = rt.SignedString([]byte(config.RefreshSecret))
 
 	if err != nil {
 		return nil, err
@@ -95,13 +100,13 @@ func GetAuthToken(r *http.Request) string {
 	return ""
 }
 
-func VerifyToken(authHeaderToken string) (*jwt.Token, error) {
+func VerifyToken(config *Config, authHeaderToken string) (*jwt.Token, error) {
 	tokenString := authHeaderToken
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("ACCESS_SECRET")), nil
+		return []byte(config.AccessSecret), nil
 	})
 
 	if err != nil {
@@ -111,8 +116,8 @@ func VerifyToken(authHeaderToken string) (*jwt.Token, error) {
 	return token, nil
 }
 
-func TokenValid(r string) error {
-	token, err := VerifyToken(r)
+func TokenValid(config *Config, r string) error {
+	token, err := VerifyToken(config, r)
 	if err != nil {
 		return err
 	}
@@ -124,8 +129,8 @@ func TokenValid(r string) error {
 	return nil
 }
 
-func ExtractTokenMetadata(r string) (*AccessDetails, error) {
-	token, err := VerifyToken(r)
+func ExtractTokenMetadata(config *Config, r string) (*AccessDetails, error) {
+	token, err := VerifyToken(config, r)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,131 @@
+// Package blobstore stores user files like avatars. Keys are slash separated paths.
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type BlobStore interface {
+	// store content by key, existing blob is replaced
+	Put(ctx context.Context, key string, contentType string, content io.Reader) error
+
+	// delete blob by key, missing blob is not an error
+	Delete(ctx context.Context, key string) error
+
+	// public url of blob
+	URL(key string) string
+}
+
+type Config struct {
+	// only "local" is supported
+	Backend string `yaml:"backend"`
+	// directory of local backend
+	Dir string `yaml:"dir"`
+	// url prefix of served files
+	BaseURL string `yaml:"base_url"`
+}
+
+func New(config Config) (BlobStore, error) {
+	switch config.Backend {
+	case "", "local":
+		if config.Dir == "" {
+			return nil, fmt.Errorf("local blob store requires dir")
+		}
+		return &LocalStore{dir: config.Dir, baseURL: strings.TrimSuffix(config.BaseURL, "/")}, nil
+	}
+
+	return nil, fmt.Errorf("unknown blob store backend: %s", config.Backend)
+}
+
+var validKey = regexp.MustCompile(`^[a-zA-Z0-9_\-]+(/[a-zA-Z0-9_\-.]+)*$`)
+
+func checkKey(key string) error {
+	if !validKey.MatchString(key) || strings.Contains(key, "..") {
+		return fmt.Errorf("invalid blob key: %s", key)
+	}
+
+	return nil
+}
+
+// LocalStore keeps blobs in directory on local filesystem
+type LocalStore struct {
+	dir     string
+	baseURL string
+}
+
+func (s *LocalStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, contentType string, content io.Reader) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// write to temporary file and rename, so readers never see partial content
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *LocalStore) URL(key string) string {
+	return s.baseURL + "/" + key
+}
+
+// serve stored files, directory listing is disabled
+func (s *LocalStore) Handler() http.Handler {
+	files := http.FileServer(http.Dir(s.dir))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/invoices"
+	"github.com/Moranilt/go-graphql-location/ledger"
+	"github.com/Moranilt/go-graphql-location/payments"
+	"github.com/Moranilt/go-graphql-location/payments/provider"
+	"github.com/Moranilt/go-graphql-location/subscriptions"
+	"github.com/Moranilt/go-graphql-location/user"
+)
+
+// commands which are run instead of server: go run . [-config path] <command> [flags]
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"import-users":    importUsersCommand,
+	"export-users":    exportUsersCommand,
+	"send-webhook":    sendWebhookCommand,
+	"replay-webhooks": replayWebhooksCommand,
+	"check-ledger":    checkLedgerCommand,
+	"run-billing":     runBillingCommand,
+}
+
+func runCommand(ctx context.Context, name string, args []string) error {
+	command, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %s, available: import-users, export-users, send-webhook, replay-webhooks, check-ledger, run-billing", name)
+	}
+
+	return command(ctx, args)
+}
+
+// format by flag or by file extension
+func fileFormat(format string, path string) string {
+	if format != "" {
+		return format
+	}
+
+	if strings.ToLower(filepath.Ext(path)) == ".jsonl" {
+		return "jsonl"
+	}
+
+	return "csv"
+}
+
+func importUsersCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import-users", flag.ExitOnError)
+	format := flags.String("format", "", "csv or jsonl, detected by file extension when empty")
+	batchSize := flags.Int("batch-size", user.DefaultImportBatchSize, "users per transaction")
+	dryRun := flags.Bool("dry-run", false, "validate and check duplicates without inserting")
+	reportPath := flags.String("report", "", "write CSV report of failed rows to file instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: import-users [flags] <file>")
+		fmt.Fprintln(flags.Output(), "Columns: first_name, last_name, login, password, email, phone (optional)")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("file is required")
+	}
+
+	source, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	pgsql, err := initDb()
+	if err != nil {
+		return fmt.Errorf("connection to the database refused: %s", err)
+	}
+	defer pgsql.Close()
+
+	report, importErr := user.ImportUsers(ctx, pgsql, source, user.ImportOptions{
+		Format:    fileFormat(*format, flags.Arg(0)),
+		BatchSize: *batchSize,
+		DryRun:    *dryRun,
+	})
+
+	// rows of failed batch are not in report, so it is written anyway
+	if report != nil {
+		if err := writeImportReport(*reportPath, report); err != nil {
+			return err
+		}
+
+		action := "imported"
+		if *dryRun {
+			action = "valid"
+		}
+		log.Printf("%d rows, %d %s, %d failed", report.Total, report.Imported, action, len(report.Errors))
+	}
+
+	if importErr != nil {
+		return importErr
+	}
+
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d rows were not imported", len(report.Errors))
+	}
+
+	return nil
+}
+
+func writeImportReport(path string, report *user.ImportReport) error {
+	if len(report.Errors) == 0 {
+		return nil
+	}
+
+	var target io.Writer = os.Stdout
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		target = file
+	}
+
+	writer := csv.NewWriter(target)
+	writer.Write([]string{"line", "login", "email", "error"})
+	for _, row := range report.Errors {
+		writer.Write([]string{strconv.Itoa(row.Line), row.Login, row.Email, row.Error})
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func exportUsersCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export-users", flag.ExitOnError)
+	format := flags.String("format", "", "csv or jsonl, detected by file extension when empty")
+	fields := flags.String("fields", strings.Join(user.DefaultExportColumns, ","),
+		"comma separated fields: "+strings.Join(user.ExportColumns, ", "))
+	output := flags.String("o", "", "output file, stdout when empty")
+	flags.Parse(args)
+
+	columns := []string{}
+	for _, field := range strings.Split(*fields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			columns = append(columns, field)
+		}
+	}
+
+	pgsql, err := initDb()
+	if err != nil {
+		return fmt.Errorf("connection to the database refused: %s", err)
+	}
+	defer pgsql.Close()
+
+	var target io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		target = file
+	}
+
+	return user.ExportUsers(ctx, pgsql, target, fileFormat(*format, *output), columns)
+}
+
+// send signed webhook event to running server, for testing of payment flows
+func sendWebhookCommand(ctx context.Context, args []string) error {
+	providerName := cfg.PaymentProvider.Name
+
+	flags := flag.NewFlagSet("send-webhook", flag.ExitOnError)
+	eventType := flags.String("type", provider.EventCaptured, "event type")
+	intentId := flags.String("intent", "", "payment intent id of provider")
+	eventId := flags.String("event", "", "event id, generated when empty")
+	refunded := flags.Int64("refunded", 0, "total refunded amount in minor units for "+provider.EventRefunded)
+	message := flags.String("message", "", "failure message for "+provider.EventFailed)
+	url := flags.String("url", strings.TrimSuffix(cfg.PublicURL, "/")+"/webhooks/payments/"+providerName, "webhook endpoint")
+	flags.Parse(args)
+
+	if *intentId == "" {
+		return fmt.Errorf("intent is required")
+	}
+
+	if cfg.PaymentProvider.WebhookSecret == "" {
+		return fmt.Errorf("PAYMENT_WEBHOOK_SECRET is not set")
+	}
+
+	now := time.Now()
+	if *eventId == "" {
+		*eventId = fmt.Sprintf("evt_%d", now.UnixNano())
+	}
+
+	body, err := json.Marshal(provider.WebhookEvent{
+		Id:      *eventId,
+		Type:    *eventType,
+		Created: now.Unix(),
+		Data: provider.WebhookEventData{
+			IntentId:       *intentId,
+			AmountRefunded: *refunded,
+			FailureMessage: *message,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, *url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(provider.SignatureHeader, provider.SignWebhook(cfg.PaymentProvider.WebhookSecret, now, body))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	response, _ := ioutil.ReadAll(res.Body)
+	log.Printf("event %s: %s %s", *eventId, res.Status, strings.TrimSpace(string(response)))
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook was not accepted")
+	}
+
+	return nil
+}
+
+// process stored webhook events again
+func replayWebhooksCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("replay-webhooks", flag.ExitOnError)
+	eventId := flags.String("event", "", "replay single event, even when it was processed")
+	failed := flags.Bool("failed", false, "replay all failed events")
+	providerName := flags.String("provider", cfg.PaymentProvider.Name, "provider of events")
+	flags.Parse(args)
+
+	if (*eventId == "") == !*failed {
+		return fmt.Errorf("either -event or -failed is required")
+	}
+
+	pgsql, err := initDb()
+	if err != nil {
+		return fmt.Errorf("connection to the database refused: %s", err)
+	}
+	defer pgsql.Close()
+
+	resolvers := payments.GetResolvers(pgsql, nil, payments.Options{
+		ProviderConfig: cfg.PaymentProvider,
+		Invoices:       invoices.GetResolvers(pgsql, nil, invoices.Options{Config: cfg.Invoices, PublicURL: cfg.PublicURL}),
+	})
+
+	eventIds := []string{*eventId}
+	if *failed {
+		eventIds = nil
+		err := pgsql.SelectContext(ctx, &eventIds,
+			"SELECT event_id FROM webhook_events WHERE provider=$1 AND status='failed' ORDER BY id", *providerName)
+		if err != nil {
+			return err
+		}
+	}
+
+	failures := 0
+	for _, id := range eventIds {
+		status, err := resolvers.ProcessWebhookEvent(ctx, *providerName, id, true)
+		if err != nil {
+			failures++
+			log.Printf("event %s: %s", id, err)
+			continue
+		}
+		log.Printf("event %s: %s", id, status)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d events failed", failures, len(eventIds))
+	}
+
+	return nil
+}
+
+func checkLedgerCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("check-ledger", flag.ExitOnError)
+	flags.Parse(args)
+
+	pgsql, err := initDb()
+	if err != nil {
+		return fmt.Errorf("connection to the database refused: %s", err)
+	}
+	defer pgsql.Close()
+
+	report, err := ledger.Check(ctx, pgsql)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%d entries, %d postings", report.Entries, report.Postings)
+	for _, total := range report.Totals {
+		log.Printf("total %s", total)
+	}
+	for _, entry := range report.Unbalanced {
+		log.Printf("entry %d (%s) is not balanced in %s by %d", entry.EntryId, entry.Reference, entry.Currency, entry.Sum)
+	}
+	for _, postingId := range report.CurrencyMismatches {
+		log.Printf("posting %d has currency other than its account", postingId)
+	}
+
+	if !report.Consistent() {
+		return fmt.Errorf("ledger is not consistent")
+	}
+
+	log.Printf("ledger is consistent")
+	return nil
+}
+
+// renew subscriptions and retry failed charges once, server does it every subscriptions.BillingInterval
+func runBillingCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("run-billing", flag.ExitOnError)
+	flags.Parse(args)
+
+	pgsql, err := initDb()
+	if err != nil {
+		return fmt.Errorf("connection to the database refused: %s", err)
+	}
+	defer pgsql.Close()
+
+	resolvers := subscriptions.GetResolvers(pgsql, nil, subscriptions.Options{
+		Invoices: invoices.GetResolvers(pgsql, nil, invoices.Options{Config: cfg.Invoices, PublicURL: cfg.PublicURL}),
+	})
+	report, err := resolvers.RunBilling(ctx)
+	log.Printf(
+		"%d renewed, %d charged, %d failed, %d cancelled, %d expired",
+		report.Renewed, report.Charged, report.Failed, report.Cancelled, report.Expired,
+	)
+
+	return err
+}
@@ -0,0 +1,266 @@
+// Package config loads application settings in layers: defaults, yaml file,
+// environment variables and files referenced by *_FILE variables (mounted secrets).
+// Every next layer overrides values of previous one.
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/blobstore"
+	"github.com/Moranilt/go-graphql-location/invoices"
+	"github.com/Moranilt/go-graphql-location/mailer"
+	"github.com/Moranilt/go-graphql-location/oidc"
+	"github.com/Moranilt/go-graphql-location/payments/provider"
+	"github.com/Moranilt/go-graphql-location/sms"
+	"gopkg.in/yaml.v2"
+)
+
+const DefaultPath = "./config.yml"
+
+type DBConfig struct {
+	Host     string `yaml:"HOST"`
+	Port     int    `yaml:"PORT"`
+	User     string `yaml:"USER"`
+	Password string `yaml:"PASSWORD"`
+	Database string `yaml:"DATABASE"`
+	Ssl      string `yaml:"SSL_MODE"`
+}
+
+type DeviceAuthConfig struct {
+	// page where user enters code shown on device
+	VerificationURI string   `yaml:"verification_uri"`
+	Clients         []string `yaml:"clients"`
+}
+
+type Config struct {
+	DB             DBConfig
+	ACCESS_SECRET  string                `yaml:"secret_key"`
+	REFRESH_SECRET string                `yaml:"secret_refresh_key"`
+	RedisDSN       string                `yaml:"redis_dsn"`
+	ListenAddr     string                `yaml:"listen_addr"`
+	LoginLinkURL   string                `yaml:"login_link_url"`
+	Mail           mailer.Config         `yaml:"mail"`
+	OidcProviders  []oidc.ProviderConfig `yaml:"oidc_providers"`
+	SMS            sms.Config            `yaml:"sms"`
+	DeviceAuth     DeviceAuthConfig      `yaml:"device_auth"`
+	// base url of this server, used in links sent to users
+	PublicURL  string `yaml:"public_url"`
+	ExportsDir string `yaml:"exports_dir"`
+	// uploaded files, base_url is public_url + "/files" when empty
+	Files blobstore.Config `yaml:"files"`
+	// gateway for payments and capture mode
+	PaymentProvider provider.Config `yaml:"payment_provider"`
+	// numbering, seller and tax of invoices
+	Invoices invoices.Config `yaml:"invoices"`
+	// days between account deletion request and purge
+	AccountDeletionGraceDays int `yaml:"account_deletion_grace_days"`
+	// key for signed download links, derived from ACCESS_SECRET when empty
+	SIGNING_SECRET string `yaml:"-"`
+}
+
+func defaults() *Config {
+	return &Config{
+		DB: DBConfig{
+			Host: "localhost",
+			Port: 5432,
+			Ssl:  "disable",
+		},
+		RedisDSN:   "localhost:6379",
+		ListenAddr: ":8080",
+		Mail:       mailer.Config{Backend: "log"},
+		SMS:        sms.Config{Backend: "log"},
+		PublicURL:  "http://localhost:8080",
+		ExportsDir: "./data/exports",
+		Files:      blobstore.Config{Backend: "local", Dir: "./data/files"},
+
+		PaymentProvider: provider.Config{Name: "mock", Capture: provider.CaptureAutomatic},
+		Invoices:        invoices.Config{Prefix: "INV", Seller: "Location API", TaxName: "VAT"},
+
+		AccountDeletionGraceDays: 30,
+	}
+}
+
+// load config from defaults, file by path, environment variables and *_FILE references.
+// Missing file is an error only when path differs from DefaultPath.
+func Load(path string) (*Config, error) {
+	return load(path, os.LookupEnv)
+}
+
+func load(path string, lookup func(string) (string, bool)) (*Config, error) {
+	config := defaults()
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !(os.IsNotExist(err) && path == DefaultPath) {
+		return nil, err
+	}
+
+	if err == nil {
+		if err := yaml.Unmarshal(content, config); err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %s", path, err)
+		}
+	}
+
+	if err := config.applyEnv(lookup); err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// environment variables which override values from file
+func (c *Config) envVars() map[string]interface{} {
+	return map[string]interface{}{
+		"DB_HOST":                 &c.DB.Host,
+		"DB_PORT":                 &c.DB.Port,
+		"DB_USER":                 &c.DB.User,
+		"DB_PASSWORD":             &c.DB.Password,
+		"DB_DATABASE":             &c.DB.Database,
+		"DB_SSL_MODE":             &c.DB.Ssl,
+		"ACCESS_SECRET":           &c.ACCESS_SECRET,
+		"REFRESH_SECRET":          &c.REFRESH_SECRET,
+		"REDIS_DSN":               &c.RedisDSN,
+		"LISTEN_ADDR":             &c.ListenAddr,
+		"LOGIN_LINK_URL":          &c.LoginLinkURL,
+		"MAIL_BACKEND":            &c.Mail.Backend,
+		"MAIL_FROM":               &c.Mail.From,
+		"MAIL_HOST":               &c.Mail.Host,
+		"MAIL_PORT":               &c.Mail.Port,
+		"MAIL_USER":               &c.Mail.User,
+		"MAIL_PASSWORD":           &c.Mail.Password,
+		"SMS_BACKEND":             &c.SMS.Backend,
+		"SMS_PATH":                &c.SMS.Path,
+		"DEVICE_VERIFICATION_URI": &c.DeviceAuth.VerificationURI,
+		"PUBLIC_URL":              &c.PublicURL,
+		"EXPORTS_DIR":             &c.ExportsDir,
+		"FILES_DIR":               &c.Files.Dir,
+		"FILES_BASE_URL":          &c.Files.BaseURL,
+		"PAYMENT_PROVIDER":        &c.PaymentProvider.Name,
+		"PAYMENT_CAPTURE":         &c.PaymentProvider.Capture,
+		"PAYMENT_WEBHOOK_SECRET":  &c.PaymentProvider.WebhookSecret,
+		"INVOICE_PREFIX":          &c.Invoices.Prefix,
+		"INVOICE_SELLER":          &c.Invoices.Seller,
+		"INVOICE_TAX_NAME":        &c.Invoices.TaxName,
+		"INVOICE_TAX_RATE":        &c.Invoices.TaxRate,
+		"SIGNING_SECRET":          &c.SIGNING_SECRET,
+	}
+}
+
+// apply NAME and NAME_FILE variables. NAME_FILE contains path of file with value,
+// trailing newline of file is trimmed. Setting both of them is an error.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	for name, target := range c.envVars() {
+		value, hasValue := lookup(name)
+		file, hasFile := lookup(name + "_FILE")
+
+		if hasValue && hasFile {
+			return fmt.Errorf("both %s and %s_FILE are set", name, name)
+		}
+
+		if hasFile {
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("unable to read %s_FILE: %s", name, err)
+			}
+			value = strings.TrimRight(string(content), "\r\n")
+		}
+
+		if !hasValue && !hasFile {
+			continue
+		}
+
+		switch target := target.(type) {
+		case *string:
+			*target = value
+		case *int:
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s must be a number", name)
+			}
+			*target = number
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) Validate() error {
+	if c.DB.User == "" || c.DB.Database == "" {
+		return fmt.Errorf("database user and name are required")
+	}
+
+	if err := c.Auth().Validate(); err != nil {
+		return err
+	}
+
+	if c.SIGNING_SECRET != "" && len(c.SIGNING_SECRET) < authorization.MinSecretLength {
+		return fmt.Errorf("signing secret must be at least %d bytes long", authorization.MinSecretLength)
+	}
+
+	if err := c.PaymentProvider.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Invoices.Validate(); err != nil {
+		return err
+	}
+
+	// zero would delete accounts right after request without a chance to cancel
+	if c.AccountDeletionGraceDays < 1 {
+		return fmt.Errorf("account deletion grace period must be at least 1 day")
+	}
+
+	return nil
+}
+
+// config of tokens for authorization package
+func (c *Config) Auth() *authorization.Config {
+	return &authorization.Config{
+		AccessSecret:  c.ACCESS_SECRET,
+		RefreshSecret: c.REFRESH_SECRET,
+	}
+}
+
+// key for signedurl.Signer
+func (c *Config) SigningKey() []byte {
+	if c.SIGNING_SECRET != "" {
+		return []byte(c.SIGNING_SECRET)
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.ACCESS_SECRET))
+	mac.Write([]byte("signed-url"))
+	return mac.Sum(nil)
+}
+
+// config of blob store with base url derived from public url
+func (c *Config) BlobStore() blobstore.Config {
+	files := c.Files
+	if files.BaseURL == "" {
+		files.BaseURL = strings.TrimSuffix(c.PublicURL, "/") + "/files"
+	}
+
+	return files
+}
+
+// connection string for lib/pq
+func (c *Config) DSN() string {
+	return fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quote(c.DB.Host), c.DB.Port, quote(c.DB.User), quote(c.DB.Password), quote(c.DB.Database), quote(c.DB.Ssl),
+	)
+}
+
+// quote value of key=value connection string
+func quote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
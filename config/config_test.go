@@ -0,0 +1,180 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+)
+
+var (
+	accessSecret  = strings.Repeat("a", authorization.MinSecretLength)
+	refreshSecret = strings.Repeat("r", authorization.MinSecretLength)
+)
+
+// lookup of environment variables from map
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.yml", `
+db:
+  USER: file-user
+  DATABASE: file-db
+  HOST: file-host
+secret_key: `+accessSecret+`
+secret_refresh_key: `+refreshSecret+`
+listen_addr: ":9090"
+`)
+	password := writeFile(t, dir, "db-password", "mounted password\n")
+
+	tests := []struct {
+		name    string
+		path    string
+		env     map[string]string
+		check   func(t *testing.T, config *Config)
+		wantErr string
+	}{
+		{
+			name: "defaults and file",
+			path: file,
+			check: func(t *testing.T, config *Config) {
+				if config.DB.Host != "file-host" || config.ListenAddr != ":9090" {
+					t.Errorf("values of file are not applied: %s, %s", config.DB.Host, config.ListenAddr)
+				}
+				if config.DB.Port != 5432 || config.RedisDSN != "localhost:6379" {
+					t.Errorf("defaults are not kept: %d, %s", config.DB.Port, config.RedisDSN)
+				}
+			},
+		},
+		{
+			name: "environment overrides file",
+			path: file,
+			env:  map[string]string{"DB_HOST": "env-host", "DB_PORT": "6432", "REDIS_DSN": "redis:6379"},
+			check: func(t *testing.T, config *Config) {
+				if config.DB.Host != "env-host" || config.DB.Port != 6432 || config.RedisDSN != "redis:6379" {
+					t.Errorf("environment is not applied: %s, %d, %s", config.DB.Host, config.DB.Port, config.RedisDSN)
+				}
+				if config.DB.User != "file-user" || config.ListenAddr != ":9090" {
+					t.Errorf("values of file are lost: %s, %s", config.DB.User, config.ListenAddr)
+				}
+			},
+		},
+		{
+			name: "file reference",
+			path: file,
+			env:  map[string]string{"DB_PASSWORD_FILE": password},
+			check: func(t *testing.T, config *Config) {
+				if config.DB.Password != "mounted password" {
+					t.Errorf("got password %q from file", config.DB.Password)
+				}
+			},
+		},
+		{
+			name: "environment without default file",
+			path: DefaultPath,
+			env: map[string]string{
+				"DB_USER": "env-user", "DB_DATABASE": "env-db",
+				"ACCESS_SECRET": accessSecret, "REFRESH_SECRET": refreshSecret,
+			},
+			check: func(t *testing.T, config *Config) {
+				if config.DB.User != "env-user" || config.DB.Host != "localhost" {
+					t.Errorf("got user %s and host %s", config.DB.User, config.DB.Host)
+				}
+			},
+		},
+		{
+			name:    "missing file",
+			path:    filepath.Join(dir, "missing.yml"),
+			env:     map[string]string{"DB_USER": "env-user", "DB_DATABASE": "env-db"},
+			wantErr: "no such file or directory",
+		},
+		{
+			name:    "both value and file reference",
+			path:    file,
+			env:     map[string]string{"DB_PASSWORD": "password", "DB_PASSWORD_FILE": password},
+			wantErr: "both DB_PASSWORD and DB_PASSWORD_FILE are set",
+		},
+		{
+			name:    "missing referenced file",
+			path:    file,
+			env:     map[string]string{"DB_PASSWORD_FILE": filepath.Join(dir, "missing")},
+			wantErr: "unable to read DB_PASSWORD_FILE",
+		},
+		{
+			name:    "not a number",
+			path:    file,
+			env:     map[string]string{"DB_PORT": "postgres"},
+			wantErr: "DB_PORT must be a number",
+		},
+		{
+			name:    "short access secret",
+			path:    file,
+			env:     map[string]string{"ACCESS_SECRET": "secret"},
+			wantErr: "access secret must be at least",
+		},
+		{
+			name:    "short refresh secret from file",
+			path:    file,
+			env:     map[string]string{"REFRESH_SECRET_FILE": writeFile(t, dir, "refresh", "secret\n")},
+			wantErr: "refresh secret must be at least",
+		},
+		{
+			name:    "same secrets",
+			path:    file,
+			env:     map[string]string{"REFRESH_SECRET": accessSecret},
+			wantErr: "access and refresh secrets must be different",
+		},
+		{
+			name:    "short signing secret",
+			path:    file,
+			env:     map[string]string{"SIGNING_SECRET": "secret"},
+			wantErr: "signing secret must be at least",
+		},
+		{
+			name: "signing secret",
+			path: file,
+			env:  map[string]string{"SIGNING_SECRET": strings.Repeat("s", authorization.MinSecretLength)},
+			check: func(t *testing.T, config *Config) {
+				if string(config.SigningKey()) != strings.Repeat("s", authorization.MinSecretLength) {
+					t.Errorf("signing secret is not used as key")
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := load(test.path, env(test.env))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			test.check(t, config)
+		})
+	}
+}
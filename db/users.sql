@@ -1,32 +1,369 @@
 CREATE TABLE users (
   id SERIAL PRIMARY KEY,
-  login VARCHAR(255) UNIQUE NOT NULL,
+  -- login and email are stored lower case, names of unique constraints are used for errors
+  login VARCHAR(255) NOT NULL CONSTRAINT users_login_key UNIQUE CHECK (login = lower(login)),
   password VARCHAR(255) NOT NULL,
-  phone VARCHAR(255) UNIQUE,
-  email VARCHAR(255) UNIQUE NOT NULL,
+  phone VARCHAR(255) CONSTRAINT users_phone_key UNIQUE,
+  phone_verified_at TIMESTAMP,
+  email VARCHAR(255) NOT NULL CONSTRAINT users_email_key UNIQUE CHECK (email = lower(email)),
   first_name VARCHAR(255) NOT NULL,
   last_name VARCHAR(255) NOT NULL,
   last_login timestamp NOT NULL DEFAULT NOW(),
+  status VARCHAR(32) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended', 'deactivated', 'pending_verification')),
+  status_reason TEXT,
+  status_changed_at TIMESTAMP,
+  delete_after TIMESTAMP,
+  avatar_key VARCHAR(255),
+  role VARCHAR(32) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'support', 'admin')),
+  -- maintained by users_search_update trigger
+  search_text TEXT NOT NULL DEFAULT '',
+  search_vector TSVECTOR NOT NULL DEFAULT ''::tsvector,
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
   updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
--- CREATE EXTENSION spi;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
 
--- CREATE TRIGGER users_moddatetime
---   BEFORE UPDATE ON users
---   FOR EACH ROW
---   EXECUTE PROCEDURE moddatetime (updated_at);
+CREATE FUNCTION users_search_update() RETURNS trigger AS $$
+BEGIN
+  NEW.search_text := concat_ws(' ', NEW.first_name, NEW.last_name, NEW.login, NEW.email, NEW.phone);
+  NEW.search_vector :=
+    setweight(to_tsvector('simple', concat_ws(' ', NEW.first_name, NEW.last_name)), 'A') ||
+    setweight(to_tsvector('simple', concat_ws(' ', NEW.login, NEW.email)), 'B') ||
+    setweight(to_tsvector('simple', coalesce(NEW.phone, '')), 'C');
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
 
-INSERT INTO users (first_name, last_name, phone, login, password, email) VALUES('Name', 'Lastname', '986754673823', 'name', '325325326', 'test@mail.com');
-INSERT INTO users (first_name, last_name, phone, login, password, email) VALUES('Test', 'TEst', '9878721632163', 'test', '24124', 'test2@mail.com');
+CREATE TRIGGER users_search_update
+  BEFORE INSERT OR UPDATE OF first_name, last_name, login, email, phone ON users
+  FOR EACH ROW
+  EXECUTE PROCEDURE users_search_update();
 
+CREATE INDEX users_search_vector_idx ON users USING GIN (search_vector);
+CREATE INDEX users_search_text_trgm_idx ON users USING GIN (search_text gin_trgm_ops);
+
+CREATE FUNCTION users_set_updated_at() RETURNS trigger AS $$
+BEGIN
+  NEW.updated_at := NOW();
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+-- last_login and delete_after are not changes of profile
+CREATE TRIGGER users_set_updated_at
+  BEFORE UPDATE OF first_name, last_name, phone, email, login, password, avatar_key, status, status_reason, role ON users
+  FOR EACH ROW
+  EXECUTE PROCEDURE users_set_updated_at();
+
+INSERT INTO users (first_name, last_name, phone, login, password, email) VALUES('Name', 'Lastname', '+986754673823', 'name', '325325326', 'test@mail.com');
+INSERT INTO users (first_name, last_name, phone, login, password, email) VALUES('Test', 'TEst', '+9878721632163', 'test', '24124', 'test2@mail.com');
+
+-- payments are kept for accounting when user is deleted
 CREATE TABLE payments(
+  id SERIAL PRIMARY KEY,
+  user_id INT,
+  -- minor units of currency, e.g. cents
+  amount BIGINT NOT NULL CHECK (amount > 0),
+  currency CHAR(3) NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$'),
+  status VARCHAR(32) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'authorized', 'captured', 'failed', 'cancelled', 'refunded', 'partially_refunded')),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  captured_at TIMESTAMP,
+  provider VARCHAR(32),
+  provider_intent_id VARCHAR(255),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- append-only log of payment status changes
+CREATE TABLE payment_events(
+  id BIGSERIAL PRIMARY KEY,
+  payment_id INT NOT NULL,
+  from_status VARCHAR(32),
+  to_status VARCHAR(32) NOT NULL,
+  actor_id INT,
+  note TEXT,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (payment_id) REFERENCES payments(id) ON DELETE CASCADE,
+  FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- money returned to payer, sum never exceeds amount of payment
+CREATE TABLE payment_refunds(
+  id BIGSERIAL PRIMARY KEY,
+  payment_id INT NOT NULL,
+  amount BIGINT NOT NULL CHECK (amount > 0),
+  currency CHAR(3) NOT NULL,
+  reason TEXT,
+  actor_id INT,
+  provider_refund_id VARCHAR(255),
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (payment_id) REFERENCES payments(id) ON DELETE CASCADE,
+  FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX payments_provider_intent_idx ON payments (provider, provider_intent_id);
+
+CREATE INDEX payment_events_payment_id_idx ON payment_events (payment_id, id);
+
+CREATE INDEX payment_refunds_payment_id_idx ON payment_refunds (payment_id, id);
+
+-- webhooks received from payment providers, event_id makes processing idempotent
+CREATE TABLE webhook_events(
+  id BIGSERIAL PRIMARY KEY,
+  provider VARCHAR(32) NOT NULL,
+  event_id VARCHAR(255) NOT NULL,
+  type VARCHAR(64) NOT NULL,
+  payload TEXT NOT NULL,
+  status VARCHAR(16) CHECK (status IN ('processed', 'ignored', 'failed')),
+  error TEXT,
+  received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  processed_at TIMESTAMP,
+  UNIQUE (provider, event_id)
+);
+
+-- double-entry ledger: entry postings net to zero in each currency
+CREATE TABLE ledger_accounts(
+  id SERIAL PRIMARY KEY,
+  code VARCHAR(128) NOT NULL UNIQUE,
+  type VARCHAR(16) NOT NULL CHECK (type IN ('asset', 'liability', 'revenue', 'expense', 'equity')),
+  -- owner of wallet
+  user_id INT,
+  currency CHAR(3) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX ledger_accounts_user_id_idx ON ledger_accounts (user_id);
+
+CREATE TABLE ledger_entries(
+  id BIGSERIAL PRIMARY KEY,
+  reference VARCHAR(128) NOT NULL UNIQUE,
+  description TEXT,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- amount is positive for debit and negative for credit
+CREATE TABLE ledger_postings(
+  id BIGSERIAL PRIMARY KEY,
+  entry_id BIGINT NOT NULL,
+  account_id INT NOT NULL,
+  amount BIGINT NOT NULL CHECK (amount <> 0),
+  currency CHAR(3) NOT NULL,
+  FOREIGN KEY (entry_id) REFERENCES ledger_entries(id),
+  FOREIGN KEY (account_id) REFERENCES ledger_accounts(id)
+);
+
+CREATE INDEX ledger_postings_entry_id_idx ON ledger_postings (entry_id);
+
+CREATE INDEX ledger_postings_account_id_idx ON ledger_postings (account_id);
+
+CREATE FUNCTION ledger_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_entries_append_only
+  BEFORE UPDATE OR DELETE ON ledger_entries
+  FOR EACH ROW
+  EXECUTE PROCEDURE ledger_append_only();
+
+CREATE TRIGGER ledger_postings_append_only
+  BEFORE UPDATE OR DELETE ON ledger_postings
+  FOR EACH ROW
+  EXECUTE PROCEDURE ledger_append_only();
+
+-- checked on commit, so postings of entry can be inserted one by one
+CREATE FUNCTION ledger_check_balance() RETURNS trigger AS $$
+BEGIN
+  IF EXISTS (
+    SELECT 1 FROM ledger_postings WHERE entry_id = NEW.entry_id GROUP BY currency HAVING SUM(amount) <> 0
+  ) THEN
+    RAISE EXCEPTION 'ledger entry % is not balanced', NEW.entry_id;
+  END IF;
+  RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_postings_balanced
+  AFTER INSERT ON ledger_postings
+  DEFERRABLE INITIALLY DEFERRED
+  FOR EACH ROW
+  EXECUTE PROCEDURE ledger_check_balance();
+
+CREATE TABLE plans(
+  id SERIAL PRIMARY KEY,
+  code VARCHAR(64) NOT NULL UNIQUE,
+  name VARCHAR(255) NOT NULL,
+  -- minor units of currency for one period
+  price BIGINT NOT NULL CHECK (price >= 0),
+  currency CHAR(3) NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$'),
+  interval VARCHAR(8) NOT NULL DEFAULT 'month' CHECK (interval IN ('day', 'week', 'month', 'year')),
+  interval_count INT NOT NULL DEFAULT 1 CHECK (interval_count > 0),
+  trial_days INT NOT NULL DEFAULT 0 CHECK (trial_days >= 0),
+  active BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO plans (code, name, price, trial_days) VALUES('basic', 'Basic', 499, 14);
+INSERT INTO plans (code, name, price) VALUES('pro', 'Pro', 1499);
+INSERT INTO plans (code, name, price, interval) VALUES('pro-yearly', 'Pro yearly', 14990, 'year');
+
+-- times are stored in UTC
+CREATE TABLE subscriptions(
   id SERIAL PRIMARY KEY,
   user_id INT NOT NULL,
-  amount INT NOT NULL,
-  payed BOOLEAN DEFAULT false,
+  plan_id INT NOT NULL,
+  status VARCHAR(16) NOT NULL CHECK (status IN ('trialing', 'active', 'past_due', 'cancelled', 'expired')),
+  current_period_start TIMESTAMP NOT NULL,
+  current_period_end TIMESTAMP NOT NULL,
+  trial_end TIMESTAMP,
+  cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+  cancelled_at TIMESTAMP,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (plan_id) REFERENCES plans(id)
+);
+
+-- single subscription which is not ended per user
+CREATE UNIQUE INDEX subscriptions_live_user_idx ON subscriptions (user_id) WHERE status IN ('trialing', 'active', 'past_due');
+
+CREATE INDEX subscriptions_period_end_idx ON subscriptions (current_period_end) WHERE status IN ('trialing', 'active');
+
+-- amount is negative for credit of unused time on plan change
+CREATE TABLE subscription_charges(
+  id BIGSERIAL PRIMARY KEY,
+  subscription_id INT NOT NULL,
+  plan_id INT NOT NULL,
+  kind VARCHAR(16) NOT NULL CHECK (kind IN ('initial', 'renewal', 'proration')),
+  amount BIGINT NOT NULL,
+  currency CHAR(3) NOT NULL,
+  period_start TIMESTAMP NOT NULL,
+  period_end TIMESTAMP NOT NULL,
+  status VARCHAR(16) NOT NULL CHECK (status IN ('pending', 'paid', 'failed')),
+  attempts INT NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP,
+  failure TEXT,
+  paid_at TIMESTAMP,
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-  payed_at TIMESTAMP,
+  FOREIGN KEY (subscription_id) REFERENCES subscriptions(id) ON DELETE CASCADE,
+  FOREIGN KEY (plan_id) REFERENCES plans(id)
+);
+
+-- the same period can not be renewed twice
+CREATE UNIQUE INDEX subscription_charges_renewal_idx ON subscription_charges (subscription_id, period_start) WHERE kind = 'renewal';
+
+CREATE INDEX subscription_charges_retry_idx ON subscription_charges (next_attempt_at) WHERE status = 'failed';
+
+-- last issued number of invoices per year, numbers have no gaps
+CREATE TABLE invoice_sequences(
+  year INT PRIMARY KEY,
+  last_number INT NOT NULL
+);
+
+-- billing details are copied on issue, so invoice does not change with profile
+CREATE TABLE invoices(
+  id SERIAL PRIMARY KEY,
+  number VARCHAR(32) NOT NULL UNIQUE,
+  year INT NOT NULL,
+  sequence INT NOT NULL,
+  user_id INT,
+  payment_id INT UNIQUE,
+  subscription_charge_id BIGINT UNIQUE,
+  currency CHAR(3) NOT NULL,
+  subtotal BIGINT NOT NULL,
+  tax BIGINT NOT NULL,
+  total BIGINT NOT NULL,
+  tax_name VARCHAR(32) NOT NULL,
+  tax_rate INT NOT NULL CHECK (tax_rate BETWEEN 0 AND 10000),
+  seller TEXT NOT NULL,
+  billing_name VARCHAR(255) NOT NULL,
+  billing_email VARCHAR(255) NOT NULL,
+  billing_phone VARCHAR(32),
+  billing_locale VARCHAR(16) NOT NULL,
+  billing_timezone VARCHAR(64) NOT NULL,
+  issued_at TIMESTAMP NOT NULL,
+  receipt_sent_at TIMESTAMP,
+  UNIQUE (year, sequence),
+  CHECK (payment_id IS NULL OR subscription_charge_id IS NULL),
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+  FOREIGN KEY (payment_id) REFERENCES payments(id),
+  -- charges are deleted with account, invoice is kept
+  FOREIGN KEY (subscription_charge_id) REFERENCES subscription_charges(id) ON DELETE SET NULL
+);
+
+CREATE INDEX invoices_user_id_idx ON invoices (user_id, id);
+
+CREATE INDEX invoices_unsent_receipts_idx ON invoices (id) WHERE receipt_sent_at IS NULL;
+
+CREATE TABLE invoice_lines(
+  id BIGSERIAL PRIMARY KEY,
+  invoice_id INT NOT NULL,
+  position INT NOT NULL,
+  kind VARCHAR(16) NOT NULL CHECK (kind IN ('item', 'tax')),
+  description TEXT NOT NULL,
+  quantity INT NOT NULL,
+  unit_amount BIGINT NOT NULL,
+  amount BIGINT NOT NULL,
+  currency CHAR(3) NOT NULL,
+  UNIQUE (invoice_id, position),
+  FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE CASCADE
+);
+
+-- append-only log of profile changes
+CREATE TABLE user_history(
+  id BIGSERIAL PRIMARY KEY,
+  user_id INT NOT NULL,
+  actor_id INT,
+  field VARCHAR(64) NOT NULL,
+  old_value TEXT,
+  new_value TEXT,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX user_history_user_id_idx ON user_history (user_id, id);
+
+CREATE FUNCTION user_history_append_only() RETURNS trigger AS $$
+BEGIN
+  -- actor_id is cleared by foreign key when actor is deleted
+  IF NEW.id = OLD.id AND NEW.user_id = OLD.user_id AND NEW.field = OLD.field
+    AND NEW.old_value IS NOT DISTINCT FROM OLD.old_value AND NEW.new_value IS NOT DISTINCT FROM OLD.new_value
+    AND NEW.created_at IS NOT DISTINCT FROM OLD.created_at AND NEW.actor_id IS NULL THEN
+    RETURN NEW;
+  END IF;
+  RAISE EXCEPTION 'user_history is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER user_history_append_only
+  BEFORE UPDATE ON user_history
+  FOR EACH ROW
+  EXECUTE PROCEDURE user_history_append_only();
+
+CREATE TABLE user_settings(
+  user_id INT PRIMARY KEY,
+  locale VARCHAR(16) NOT NULL DEFAULT 'en' CHECK (locale ~ '^[a-z]{2}(-[A-Z]{2})?$'),
+  timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+  currency CHAR(3) NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$'),
+  notify_account BOOLEAN NOT NULL DEFAULT TRUE,
+  notify_payments BOOLEAN NOT NULL DEFAULT TRUE,
+  notify_marketing BOOLEAN NOT NULL DEFAULT FALSE,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_identities(
+  id SERIAL PRIMARY KEY,
+  user_id INT NOT NULL,
+  provider VARCHAR(255) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(255) NOT NULL DEFAULT '',
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (provider, subject),
+  UNIQUE (user_id, provider),
   FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-);
\ No newline at end of file
+);
@@ -0,0 +1,216 @@
+// Package gqlupload implements GraphQL multipart request specification
+// (https://github.com/jaydenseric/graphql-multipart-request-spec) for graphql-go.
+package gqlupload
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Moranilt/go-graphql-location/sqlpatch"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// File uploaded with request, value of Upload scalar
+type File struct {
+	Filename string
+	// content type sent by client, it is not verified
+	ContentType string
+	Size        int64
+	header      *multipart.FileHeader
+}
+
+func (f *File) Open() (multipart.File, error) {
+	return f.header.Open()
+}
+
+var Upload = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Upload",
+	Description: "File sent by multipart request, can be passed only by variable",
+	Serialize: func(value interface{}) interface{} {
+		if file, ok := value.(*File); ok {
+			return file.Filename
+		}
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		if file, ok := value.(*File); ok {
+			return file
+		}
+		return nil
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		return nil
+	},
+})
+
+type operation struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Handler executes multipart requests and passes other requests to next handler
+func Handler(schema *graphql.Schema, maxRequestSize int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+		if err := r.ParseMultipartForm(maxRequestSize); err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("unable to parse multipart request: %s", err))
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		operations, batch, err := parseOperations(r.MultipartForm)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		results := make([]*graphql.Result, len(operations))
+		for i, op := range operations {
+			results[i] = graphql.Do(graphql.Params{
+				Schema:         *schema,
+				RequestString:  op.Query,
+				VariableValues: op.Variables,
+				OperationName:  op.OperationName,
+				Context:        sqlpatch.WithVariables(r.Context(), op.Variables),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if batch {
+			json.NewEncoder(w).Encode(results)
+			return
+		}
+		json.NewEncoder(w).Encode(results[0])
+	})
+}
+
+// read "operations" and put files from "map" into variables
+func parseOperations(form *multipart.Form) ([]*operation, bool, error) {
+	rawOperations := form.Value["operations"]
+	if len(rawOperations) != 1 {
+		return nil, false, fmt.Errorf("operations field is required")
+	}
+
+	var operations []*operation
+	batch := strings.HasPrefix(strings.TrimSpace(rawOperations[0]), "[")
+
+	if batch {
+		if err := json.Unmarshal([]byte(rawOperations[0]), &operations); err != nil {
+			return nil, false, fmt.Errorf("invalid operations: %s", err)
+		}
+	} else {
+		var single operation
+		if err := json.Unmarshal([]byte(rawOperations[0]), &single); err != nil {
+			return nil, false, fmt.Errorf("invalid operations: %s", err)
+		}
+		operations = []*operation{&single}
+	}
+
+	if len(operations) == 0 {
+		return nil, false, fmt.Errorf("operations are empty")
+	}
+
+	var fileMap map[string][]string
+	if rawMap := form.Value["map"]; len(rawMap) == 1 {
+		if err := json.Unmarshal([]byte(rawMap[0]), &fileMap); err != nil {
+			return nil, false, fmt.Errorf("invalid map: %s", err)
+		}
+	}
+
+	for fieldName, paths := range fileMap {
+		headers := form.File[fieldName]
+		if len(headers) != 1 {
+			return nil, false, fmt.Errorf("file %s is missing", fieldName)
+		}
+
+		file := &File{
+			Filename:    headers[0].Filename,
+			ContentType: headers[0].Header.Get("Content-Type"),
+			Size:        headers[0].Size,
+			header:      headers[0],
+		}
+
+		for _, path := range paths {
+			if err := setFile(operations, batch, path, file); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	return operations, batch, nil
+}
+
+// set file by object path like "variables.file", "variables.files.0" or "0.variables.file" for batch
+func setFile(operations []*operation, batch bool, path string, file *File) error {
+	segments := strings.Split(path, ".")
+
+	index := 0
+	if batch {
+		i, err := strconv.Atoi(segments[0])
+		if err != nil || i < 0 || i >= len(operations) {
+			return fmt.Errorf("invalid file path: %s", path)
+		}
+		index = i
+		segments = segments[1:]
+	}
+
+	if len(segments) < 2 || segments[0] != "variables" {
+		return fmt.Errorf("invalid file path: %s", path)
+	}
+
+	if operations[index].Variables == nil {
+		return fmt.Errorf("invalid file path: %s", path)
+	}
+
+	var container interface{} = operations[index].Variables
+	segments = segments[1:]
+
+	for i, segment := range segments {
+		last := i == len(segments)-1
+
+		switch value := container.(type) {
+		case map[string]interface{}:
+			if _, ok := value[segment]; !ok {
+				return fmt.Errorf("invalid file path: %s", path)
+			}
+			if last {
+				value[segment] = file
+				return nil
+			}
+			container = value[segment]
+		case []interface{}:
+			position, err := strconv.Atoi(segment)
+			if err != nil || position < 0 || position >= len(value) {
+				return fmt.Errorf("invalid file path: %s", path)
+			}
+			if last {
+				value[position] = file
+				return nil
+			}
+			container = value[position]
+		default:
+			return fmt.Errorf("invalid file path: %s", path)
+		}
+	}
+
+	return fmt.Errorf("invalid file path: %s", path)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"message": err.Error()}},
+	})
+}
@@ -0,0 +1,234 @@
+// Package idempotency replays responses of mutations retried with the same key,
+// so a client can safely repeat request after timeout.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/go-redis/redis/v8"
+	"github.com/graphql-go/graphql"
+)
+
+type HeaderKeyType string
+
+// context key of Idempotency-Key header value
+const HeaderKey HeaderKeyType = "Idempotency-Key"
+
+// name of mutation argument, it overrides header
+const ArgumentName = "idempotencyKey"
+
+const (
+	TTL          = 24 * time.Hour
+	MaxKeyLength = 255
+	// time for first request to finish, retries get "in progress" error until then
+	lockTTL = time.Minute
+	// time to store response after mutation is done
+	storeTimeout = 5 * time.Second
+)
+
+type record struct {
+	Fingerprint string          `json:"fingerprint"`
+	Done        bool            `json:"done"`
+	Response    json.RawMessage `json:"response,omitempty"`
+}
+
+type Store struct {
+	client *redis.Client
+	auth   *authorization.Config
+}
+
+func NewStore(client *redis.Client, auth *authorization.Config) *Store {
+	return &Store{client: client, auth: auth}
+}
+
+// hash of mutation name and arguments without key
+func fingerprint(field string, args map[string]interface{}) (string, error) {
+	filtered := map[string]interface{}{}
+	for name, value := range args {
+		if name != ArgumentName {
+			filtered[name] = value
+		}
+	}
+
+	// keys of maps are sorted by encoding/json
+	encoded, err := json.Marshal(filtered)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(append([]byte(field+"\n"), encoded...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// key from argument or header, empty when request is not idempotent
+func requestKey(params graphql.ResolveParams) (string, error) {
+	key, _ := params.Args[ArgumentName].(string)
+	if key == "" {
+		key, _ = params.Context.Value(HeaderKey).(string)
+	}
+
+	key = strings.TrimSpace(key)
+	if len(key) > MaxKeyLength {
+		return "", fmt.Errorf("idempotency key must not be longer than %d characters", MaxKeyLength)
+	}
+
+	return key, nil
+}
+
+func (s *Store) userId(ctx context.Context) (uint64, error) {
+	authToken, _ := ctx.Value(authorization.AuthHeaderKey).(string)
+	token, err := authorization.ExtractTokenMetadata(s.auth, authToken)
+	if err != nil {
+		return 0, err
+	}
+
+	return authorization.FetchAuth(token, s.client, ctx)
+}
+
+// Field adds idempotencyKey argument to mutation and stores its first successful response.
+// Retry with the same key and arguments returns stored response decoded into newResult(),
+// retry with other arguments fails. Requests without key or authorization are not stored.
+// Store is taken on every request, because schema is built before connections.
+func Field(name string, field *graphql.Field, newResult func() interface{}, store func() *Store) *graphql.Field {
+	args := graphql.FieldConfigArgument{}
+	for argName, arg := range field.Args {
+		args[argName] = arg
+	}
+	args[ArgumentName] = &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "Repeated request with the same key returns the first response, Idempotency-Key header can be used instead",
+	}
+
+	resolve := field.Resolve
+	wrapped := *field
+	wrapped.Args = args
+	wrapped.Resolve = func(params graphql.ResolveParams) (interface{}, error) {
+		key, err := requestKey(params)
+		if err != nil {
+			return nil, err
+		}
+
+		if key == "" {
+			return resolve(params)
+		}
+
+		s := store()
+
+		// authorization errors are returned by resolver itself
+		userId, err := s.userId(params.Context)
+		if err != nil {
+			return resolve(params)
+		}
+
+		hash, err := fingerprint(name, params.Args)
+		if err != nil {
+			return nil, err
+		}
+
+		storageKey := fmt.Sprintf("idempotency:%d:%s", userId, key)
+		replayed, found, err := s.begin(params.Context, storageKey, hash, newResult)
+		if err != nil || found {
+			return replayed, err
+		}
+
+		result, err := resolve(params)
+		if err != nil {
+			// failed request is not stored, so it can be retried with the same key
+			s.client.Del(params.Context, storageKey)
+			return nil, err
+		}
+
+		// mutation is already done, so error of storing is not returned. Otherwise client
+		// would retry after lock expiration and repeat the mutation
+		if err := s.complete(storageKey, hash, result); err != nil {
+			log.Printf("unable to store response of %s for idempotency key: %s", name, err)
+		}
+
+		return result, nil
+	}
+
+	return &wrapped
+}
+
+// lock key for new request or return stored response
+func (s *Store) begin(ctx context.Context, storageKey string, hash string, newResult func() interface{}) (interface{}, bool, error) {
+	pending, err := json.Marshal(record{Fingerprint: hash})
+	if err != nil {
+		return nil, false, err
+	}
+
+	created, err := s.client.SetNX(ctx, storageKey, pending, lockTTL).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created {
+		return nil, false, nil
+	}
+
+	value, err := s.client.Get(ctx, storageKey).Bytes()
+	if err == redis.Nil {
+		return nil, false, fmt.Errorf("request with this idempotency key is in progress, retry later")
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var stored record
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return nil, false, err
+	}
+
+	if stored.Fingerprint != hash {
+		return nil, false, fmt.Errorf("idempotency key was already used with different arguments")
+	}
+
+	if !stored.Done {
+		return nil, false, fmt.Errorf("request with this idempotency key is in progress, retry later")
+	}
+
+	if stored.Response == nil {
+		return nil, false, fmt.Errorf("request with this idempotency key is completed, but its response is not available")
+	}
+
+	result := newResult()
+	if err := json.Unmarshal(stored.Response, result); err != nil {
+		return nil, false, err
+	}
+
+	return result, true, nil
+}
+
+// store response of successful request. Request context is not used, because client
+// could disconnect after mutation is done. Key is marked as done even when response
+// can't be encoded, and it stays locked when redis fails, so the mutation is not repeated
+func (s *Store) complete(storageKey string, hash string, result interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+
+	done := record{Fingerprint: hash, Done: true}
+	response, encodeErr := json.Marshal(result)
+	if encodeErr == nil {
+		done.Response = response
+	}
+
+	value, err := json.Marshal(done)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.Set(ctx, storageKey, value, TTL).Err(); err != nil {
+		s.client.Expire(ctx, storageKey, TTL)
+		return err
+	}
+
+	return encodeErr
+}
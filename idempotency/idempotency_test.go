@@ -0,0 +1,166 @@
+package idempotency
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/graphql-go/graphql"
+)
+
+type testResult struct {
+	Id     int         `json:"id"`
+	Extra  interface{} `json:"extra,omitempty"`
+	Amount string      `json:"amount"`
+}
+
+type testMutation struct {
+	field *graphql.Field
+	calls int
+	// returned by resolver instead of result when not nil
+	err error
+	// called by resolver before returning result
+	before func(params graphql.ResolveParams)
+	extra  interface{}
+}
+
+func newTestMutation(t *testing.T) (*testMutation, context.Context) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	auth := &authorization.Config{
+		AccessSecret:  strings.Repeat("a", authorization.MinSecretLength),
+		RefreshSecret: strings.Repeat("r", authorization.MinSecretLength),
+	}
+	tokens, err := authorization.CreateToken(auth, 1, client, context.Background())
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+
+	mutation := &testMutation{}
+	store := NewStore(client, auth)
+	mutation.field = Field("createPayment", &graphql.Field{
+		Type: graphql.String,
+		Args: graphql.FieldConfigArgument{"amount": &graphql.ArgumentConfig{Type: graphql.String}},
+		Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+			mutation.calls++
+			if mutation.err != nil {
+				return nil, mutation.err
+			}
+
+			if mutation.before != nil {
+				mutation.before(params)
+			}
+
+			return &testResult{Id: mutation.calls, Amount: params.Args["amount"].(string), Extra: mutation.extra}, nil
+		},
+	}, func() interface{} { return &testResult{} }, func() *Store { return store })
+
+	ctx := context.WithValue(context.Background(), authorization.AuthHeaderKey, tokens.AccessToken)
+	return mutation, ctx
+}
+
+func (m *testMutation) call(ctx context.Context, key string, amount string) (*testResult, error) {
+	result, err := m.field.Resolve(graphql.ResolveParams{
+		Context: ctx,
+		Args:    map[string]interface{}{ArgumentName: key, "amount": amount},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*testResult), nil
+}
+
+func TestFieldReplaysResponse(t *testing.T) {
+	mutation, ctx := newTestMutation(t)
+
+	first, err := mutation.call(ctx, "key-1", "10.00")
+	if err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+
+	second, err := mutation.call(ctx, "key-1", "10.00")
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+
+	if mutation.calls != 1 || *second != *first {
+		t.Fatalf("retry is executed again: calls %d, got %+v, want %+v", mutation.calls, second, first)
+	}
+
+	if _, err := mutation.call(ctx, "key-1", "20.00"); err == nil || !strings.Contains(err.Error(), "different arguments") {
+		t.Fatalf("got error %v, want different arguments", err)
+	}
+
+	if _, err := mutation.call(ctx, "", "10.00"); err != nil || mutation.calls != 2 {
+		t.Fatalf("request without key is not executed: %v", err)
+	}
+}
+
+func TestFieldRetriesFailedRequest(t *testing.T) {
+	mutation, ctx := newTestMutation(t)
+
+	mutation.err = fmt.Errorf("card declined")
+	if _, err := mutation.call(ctx, "key-1", "10.00"); err == nil {
+		t.Fatalf("error of resolver is not returned")
+	}
+
+	mutation.err = nil
+	if _, err := mutation.call(ctx, "key-1", "10.00"); err != nil {
+		t.Fatalf("retry after failure: %v", err)
+	}
+
+	if mutation.calls != 2 {
+		t.Fatalf("got %d calls, want 2", mutation.calls)
+	}
+}
+
+func TestFieldStoresResponseAfterDisconnect(t *testing.T) {
+	mutation, ctx := newTestMutation(t)
+
+	requestCtx, cancel := context.WithCancel(ctx)
+	mutation.before = func(params graphql.ResolveParams) { cancel() }
+
+	if _, err := mutation.call(requestCtx, "key-1", "10.00"); err != nil {
+		t.Fatalf("done mutation returns error: %v", err)
+	}
+
+	mutation.before = nil
+	result, err := mutation.call(ctx, "key-1", "10.00")
+	if err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+
+	if mutation.calls != 1 || result.Id != 1 {
+		t.Fatalf("mutation is repeated after disconnect: calls %d", mutation.calls)
+	}
+}
+
+func TestFieldResponseNotStored(t *testing.T) {
+	mutation, ctx := newTestMutation(t)
+
+	// channels can't be encoded to JSON
+	mutation.extra = make(chan int)
+
+	result, err := mutation.call(ctx, "key-1", "10.00")
+	if err != nil || result == nil {
+		t.Fatalf("done mutation returns error: %v", err)
+	}
+
+	_, err = mutation.call(ctx, "key-1", "10.00")
+	if err == nil || !strings.Contains(err.Error(), "response is not available") {
+		t.Fatalf("got error %v, want response is not available", err)
+	}
+
+	if mutation.calls != 1 {
+		t.Fatalf("mutation is repeated: calls %d", mutation.calls)
+	}
+}
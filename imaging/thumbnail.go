@@ -0,0 +1,78 @@
+// Package imaging resizes uploaded images without external dependencies.
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// crop center square of src and scale it to size x size with area averaging.
+// Transparent pixels are drawn over background.
+func SquareThumbnail(src image.Image, size int, background color.Color) *image.RGBA {
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+
+	crop := image.Rect(0, 0, side, side)
+	offset := image.Pt(bounds.Min.X+(bounds.Dx()-side)/2, bounds.Min.Y+(bounds.Dy()-side)/2)
+
+	square := image.NewRGBA(crop)
+	draw.Draw(square, crop, &image.Uniform{C: background}, image.Point{}, draw.Src)
+	draw.Draw(square, crop, src, offset, draw.Over)
+
+	if side <= size {
+		return upscale(square, size)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		y0 := y * side / size
+		y1 := (y + 1) * side / size
+
+		for x := 0; x < size; x++ {
+			x0 := x * side / size
+			x1 := (x + 1) * side / size
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				row := square.Pix[sy*square.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					pixel := row[sx*4 : sx*4+4]
+					r += uint64(pixel[0])
+					g += uint64(pixel[1])
+					b += uint64(pixel[2])
+					a += uint64(pixel[3])
+					count++
+				}
+			}
+
+			offset := y*dst.Stride + x*4
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+
+	return dst
+}
+
+// nearest neighbour scaling for images smaller than thumbnail
+func upscale(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		sy := y * side / size
+		for x := 0; x < size; x++ {
+			sx := x * side / size
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:sy*src.Stride+sx*4+4])
+		}
+	}
+
+	return dst
+}
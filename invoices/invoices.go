@@ -0,0 +1,228 @@
+// Package invoices issues numbered invoices for captured payments, renders them to PDF
+// and emails receipts.
+package invoices
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/locale"
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	LineItem = "item"
+	LineTax  = "tax"
+)
+
+type Config struct {
+	// first part of number, e.g. INV-2024-000001
+	Prefix string `yaml:"prefix"`
+	// name and address printed on invoice, lines are separated by \n
+	Seller  string `yaml:"seller"`
+	TaxName string `yaml:"tax_name"`
+	// basis points of tax included in prices, 2000 is 20%
+	TaxRate int `yaml:"tax_rate"`
+}
+
+func (c Config) Validate() error {
+	if c.Prefix == "" {
+		return fmt.Errorf("invoice prefix is required")
+	}
+	if c.TaxRate < 0 || c.TaxRate > 10000 {
+		return fmt.Errorf("tax rate must be between 0 and 10000 basis points")
+	}
+	return nil
+}
+
+// invoice is not changed after issue, billing details are copied from user at that moment
+type Invoice struct {
+	Id       uint64  `json:"id" db:"id"`
+	Number   string  `json:"number" db:"number"`
+	Year     int     `json:"year" db:"year"`
+	Sequence int     `json:"sequence" db:"sequence"`
+	UserId   *uint64 `json:"user_id" db:"user_id"`
+	// invoice is issued either for payment or for subscription charge
+	PaymentId            *uint64 `json:"payment_id" db:"payment_id"`
+	SubscriptionChargeId *uint64 `json:"subscription_charge_id" db:"subscription_charge_id"`
+	Currency             string  `json:"currency" db:"currency"`
+	// minor units, total includes tax
+	Subtotal int64  `json:"subtotal" db:"subtotal"`
+	Tax      int64  `json:"tax" db:"tax"`
+	Total    int64  `json:"total" db:"total"`
+	TaxName  string `json:"tax_name" db:"tax_name"`
+	TaxRate  int    `json:"tax_rate" db:"tax_rate"`
+	Seller   string `json:"seller" db:"seller"`
+
+	BillingName     string  `json:"billing_name" db:"billing_name"`
+	BillingEmail    string  `json:"billing_email" db:"billing_email"`
+	BillingPhone    *string `json:"billing_phone" db:"billing_phone"`
+	BillingLocale   string  `json:"billing_locale" db:"billing_locale"`
+	BillingTimezone string  `json:"billing_timezone" db:"billing_timezone"`
+
+	IssuedAt      time.Time  `json:"issued_at" db:"issued_at"`
+	ReceiptSentAt *time.Time `json:"receipt_sent_at" db:"receipt_sent_at"`
+}
+
+func (invoice *Invoice) money(amount int64) money.Money {
+	return money.Money{Amount: amount, Currency: invoice.Currency}
+}
+
+// formatter for language and timezone of customer
+func (invoice *Invoice) formatter() *locale.Formatter {
+	return locale.New(invoice.BillingLocale, invoice.BillingTimezone, invoice.Currency)
+}
+
+type Line struct {
+	Id          uint64 `json:"id" db:"id"`
+	InvoiceId   uint64 `json:"invoice_id" db:"invoice_id"`
+	Position    int    `json:"position" db:"position"`
+	Kind        string `json:"kind" db:"kind"`
+	Description string `json:"description" db:"description"`
+	Quantity    int    `json:"quantity" db:"quantity"`
+	UnitAmount  int64  `json:"unit_amount" db:"unit_amount"`
+	Amount      int64  `json:"amount" db:"amount"`
+	Currency    string `json:"currency" db:"currency"`
+}
+
+// what was paid, either PaymentId or SubscriptionChargeId is set
+type Source struct {
+	PaymentId            *uint64
+	SubscriptionChargeId *uint64
+	UserId               *uint64
+	Description          string
+	Amount               money.Money
+}
+
+// creates invoice in transaction of payment or subscription charge
+type Issuer interface {
+	Issue(tx *sqlx.Tx, source Source) (*Invoice, error)
+}
+
+// tax included in total, rounded half up
+func includedTax(total int64, rate int) int64 {
+	if rate == 0 {
+		return 0
+	}
+
+	// total * rate * 2 can overflow int64
+	numerator := new(big.Int).Mul(big.NewInt(total), big.NewInt(int64(rate)*2))
+	denominator := big.NewInt(int64(10000+rate) * 2)
+	numerator.Add(numerator, big.NewInt(int64(10000+rate)))
+
+	return numerator.Quo(numerator, denominator).Int64()
+}
+
+// rate in basis points as percent, e.g. 1950 is "19.5%"
+func percent(rate int) string {
+	return strconv.FormatFloat(float64(rate)/100, 'f', -1, 64) + "%"
+}
+
+func (r *Resolvers) Issue(tx *sqlx.Tx, source Source) (*Invoice, error) {
+	if (source.PaymentId == nil) == (source.SubscriptionChargeId == nil) {
+		return nil, fmt.Errorf("invoice needs either payment or subscription charge")
+	}
+
+	issuedAt := time.Now().UTC()
+	invoice := &Invoice{
+		Year:                 issuedAt.Year(),
+		UserId:               source.UserId,
+		PaymentId:            source.PaymentId,
+		SubscriptionChargeId: source.SubscriptionChargeId,
+		Currency:             source.Amount.Currency,
+		Total:                source.Amount.Amount,
+		Tax:                  includedTax(source.Amount.Amount, r.config.TaxRate),
+		TaxName:              r.config.TaxName,
+		TaxRate:              r.config.TaxRate,
+		Seller:               r.config.Seller,
+		BillingLocale:        locale.DefaultLocale,
+		BillingTimezone:      locale.DefaultTimezone,
+		IssuedAt:             issuedAt,
+	}
+	invoice.Subtotal = invoice.Total - invoice.Tax
+
+	if source.UserId != nil {
+		err := tx.Get(invoice,
+			`SELECT users.first_name || ' ' || users.last_name AS billing_name, users.email AS billing_email,
+				users.phone AS billing_phone,
+				COALESCE(settings.locale, $2) AS billing_locale, COALESCE(settings.timezone, $3) AS billing_timezone
+			FROM users LEFT JOIN user_settings settings ON settings.user_id = users.id
+			WHERE users.id = $1`,
+			*source.UserId, locale.DefaultLocale, locale.DefaultTimezone,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load billing details: %s", err)
+		}
+	}
+
+	// row of year is locked until commit, so numbers have no gaps
+	err := tx.Get(&invoice.Sequence,
+		`INSERT INTO invoice_sequences (year, last_number) VALUES ($1, 1)
+		ON CONFLICT (year) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+		RETURNING last_number`,
+		invoice.Year,
+	)
+	if err != nil {
+		return nil, err
+	}
+	invoice.Number = fmt.Sprintf("%s-%d-%06d", r.config.Prefix, invoice.Year, invoice.Sequence)
+
+	rows, err := tx.NamedQuery(
+		`INSERT INTO invoices (number, year, sequence, user_id, payment_id, subscription_charge_id, currency, subtotal, tax, total,
+			tax_name, tax_rate, seller, billing_name, billing_email, billing_phone, billing_locale, billing_timezone, issued_at)
+		VALUES (:number, :year, :sequence, :user_id, :payment_id, :subscription_charge_id, :currency, :subtotal, :tax, :total,
+			:tax_name, :tax_rate, :seller, :billing_name, :billing_email, :billing_phone, :billing_locale, :billing_timezone, :issued_at)
+		RETURNING id`,
+		invoice,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if rows.Next() {
+		err = rows.Scan(&invoice.Id)
+	}
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []Line{{
+		Kind:        LineItem,
+		Description: source.Description,
+		Quantity:    1,
+		UnitAmount:  invoice.Subtotal,
+		Amount:      invoice.Subtotal,
+	}}
+	if invoice.TaxRate > 0 {
+		lines = append(lines, Line{
+			Kind:        LineTax,
+			Description: fmt.Sprintf("%s %s", invoice.TaxName, percent(invoice.TaxRate)),
+			Quantity:    1,
+			UnitAmount:  invoice.Tax,
+			Amount:      invoice.Tax,
+		})
+	}
+
+	for i, line := range lines {
+		_, err := tx.Exec(
+			`INSERT INTO invoice_lines (invoice_id, position, kind, description, quantity, unit_amount, amount, currency)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			invoice.Id, i+1, line.Kind, line.Description, line.Quantity, line.UnitAmount, line.Amount, invoice.Currency,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return invoice, nil
+}
+
+// lines ordered by position
+func lines(q sqlx.Queryer, invoiceId uint64) ([]Line, error) {
+	lines := []Line{}
+	err := sqlx.Select(q, &lines, "SELECT * FROM invoice_lines WHERE invoice_id=$1 ORDER BY position", invoiceId)
+	return lines, err
+}
@@ -0,0 +1,50 @@
+package invoices
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIncludedTax(t *testing.T) {
+	tests := []struct {
+		name  string
+		total int64
+		rate  int
+		want  int64
+	}{
+		{name: "no tax", total: 1499, rate: 0, want: 0},
+		{name: "20% of round total", total: 1200, rate: 2000, want: 200},
+		{name: "20% rounded up", total: 1499, rate: 2000, want: 250},
+		{name: "20% rounded down", total: 1201, rate: 2000, want: 200},
+		{name: "20% rounded half up", total: 3, rate: 2000, want: 1},
+		{name: "less than half of minor unit", total: 2, rate: 2000, want: 0},
+		{name: "19.5%", total: 10000, rate: 1950, want: 1632},
+		{name: "whole total is tax", total: 1000, rate: 10000, want: 500},
+		{name: "zero total", total: 0, rate: 2000, want: 0},
+		// total * rate does not fit int64
+		{name: "largest total", total: math.MaxInt64, rate: 2000, want: 1537228672809129301},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := includedTax(test.total, test.rate)
+			if got != test.want {
+				t.Fatalf("includedTax(%d, %d) = %d, want %d", test.total, test.rate, got, test.want)
+			}
+
+			if got < 0 || got > test.total {
+				t.Fatalf("tax %d is outside of total %d", got, test.total)
+			}
+		})
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := map[int]string{0: "0%", 2000: "20%", 1950: "19.5%", 725: "7.25%", 10000: "100%"}
+
+	for rate, want := range tests {
+		if got := percent(rate); got != want {
+			t.Errorf("percent(%d) = %q, want %q", rate, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package invoices
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Moranilt/go-graphql-location/pdf"
+)
+
+const margin = 50
+
+// write invoice as single page PDF in language of customer
+func Render(w io.Writer, invoice *Invoice, lines []Line) error {
+	f := invoice.formatter()
+	document := pdf.New("Invoice " + invoice.Number)
+	page := document.AddPage()
+	right := pdf.PageWidth - margin
+
+	page.Text(pdf.Bold, 20, margin, 70, "INVOICE")
+	page.Text(pdf.Regular, 10, margin, 90, "Number: "+invoice.Number)
+	page.Text(pdf.Regular, 10, margin, 104, "Date: "+f.Date(invoice.IssuedAt))
+	page.Text(pdf.Regular, 10, margin, 118, "Status: paid")
+
+	y := 160.0
+	page.Text(pdf.Bold, 10, margin, y, "From")
+	page.Text(pdf.Bold, 10, 320, y, "Bill to")
+
+	sellerY := y
+	for _, line := range strings.Split(invoice.Seller, "\n") {
+		sellerY += 14
+		page.Text(pdf.Regular, 10, margin, sellerY, line)
+	}
+
+	buyer := []string{invoice.BillingName, invoice.BillingEmail}
+	if invoice.BillingPhone != nil {
+		buyer = append(buyer, *invoice.BillingPhone)
+	}
+	buyerY := y
+	for _, line := range buyer {
+		buyerY += 14
+		page.Text(pdf.Regular, 10, 320, buyerY, line)
+	}
+
+	y = sellerY
+	if buyerY > y {
+		y = buyerY
+	}
+	y += 40
+
+	page.Text(pdf.Bold, 10, margin, y, "Description")
+	page.Text(pdf.Bold, 10, 330, y, "Qty")
+	page.Text(pdf.Bold, 10, 380, y, "Unit price")
+	page.Text(pdf.Bold, 10, right-50, y, "Amount")
+	y += 6
+	page.Line(margin, y, right, y, 0.5)
+
+	for _, line := range lines {
+		if line.Kind != LineItem {
+			continue
+		}
+		y += 16
+		page.Text(pdf.Regular, 10, margin, y, line.Description)
+		page.TextRight(10, 350, y, strconv.Itoa(line.Quantity))
+		page.TextRight(10, 460, y, f.Amount(invoice.money(line.UnitAmount)))
+		page.TextRight(10, right, y, f.Amount(invoice.money(line.Amount)))
+	}
+
+	y += 10
+	page.Line(margin, y, right, y, 0.5)
+
+	total := func(label string, amount int64, font pdf.Font) {
+		y += 16
+		page.Text(font, 10, 330, y, label)
+		page.TextRight(10, right, y, f.Amount(invoice.money(amount)))
+	}
+
+	total("Subtotal", invoice.Subtotal, pdf.Regular)
+	for _, line := range lines {
+		if line.Kind == LineTax {
+			total(line.Description, line.Amount, pdf.Regular)
+		}
+	}
+	total("Total", invoice.Total, pdf.Bold)
+
+	if invoice.TaxRate > 0 {
+		y += 40
+		page.Text(pdf.Regular, 8, margin, y, "Prices include "+invoice.TaxName+".")
+	}
+
+	_, err := document.WriteTo(w)
+	return err
+}
@@ -0,0 +1,322 @@
+package invoices
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/locale"
+	"github.com/Moranilt/go-graphql-location/mailer"
+	"github.com/Moranilt/go-graphql-location/pagination"
+	"github.com/Moranilt/go-graphql-location/signedurl"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+	"github.com/jmoiron/sqlx"
+)
+
+const invoicesSortKey = "id:DESC"
+
+// download link in receipt is valid for this time, later PDF is downloaded with access token
+const ReceiptLinkTTL = 30 * 24 * time.Hour
+
+type Resolverers interface {
+	Issuer
+
+	// invoices of authorized user, newest first. Admins can pass user_id of another user
+	Invoices(graphql.ResolveParams) (*pagination.Connection, error)
+
+	// PDF of invoice by signed link from receipt, or for its owner and admins by access token
+	// from Authorization header
+	DownloadHandler(w http.ResponseWriter, req *http.Request)
+
+	// email receipts of issued invoices which were not sent yet
+	SendReceipts(ctx context.Context) (int, error)
+}
+
+// send email to user if notifications about payments are allowed by settings
+type NotifyFunc func(ctx context.Context, userId uint64, compose func(email string, f *locale.Formatter) mailer.Message) error
+
+type Resolvers struct {
+	pgsql       *sqlx.DB
+	RedisClient *redis.Client
+	auth        *authorization.Config
+	config      Config
+	publicURL   string
+	signer      *signedurl.Signer
+	notify      NotifyFunc
+}
+
+type Options struct {
+	Auth   *authorization.Config
+	Config Config
+	// base url of server for download links in receipts
+	PublicURL string
+	// signs download links in receipts, which are opened without access token
+	Signer *signedurl.Signer
+	Notify NotifyFunc
+}
+
+// resolvers of Invoice fields, set by GetResolvers
+var fieldResolvers *Resolvers
+
+func GetResolvers(pgsql *sqlx.DB, client *redis.Client, options Options) *Resolvers {
+	fieldResolvers = &Resolvers{
+		pgsql:       pgsql,
+		RedisClient: client,
+		auth:        options.Auth,
+		config:      options.Config,
+		publicURL:   strings.TrimRight(options.PublicURL, "/"),
+		signer:      options.Signer,
+		notify:      options.Notify,
+	}
+	return fieldResolvers
+}
+
+// get id of authorized active user from access token in context
+func (r *Resolvers) currentUserId(ctx context.Context) (uint64, error) {
+	requestToken, _ := ctx.Value(authorization.AuthHeaderKey).(string)
+	token, err := authorization.ExtractTokenMetadata(r.auth, requestToken)
+	if err != nil {
+		return 0, err
+	}
+
+	userId, err := authorization.FetchAuth(token, r.RedisClient, ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := authorization.CheckActive(ctx, r.pgsql, userId); err != nil {
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+func (r *Resolvers) Invoices(params graphql.ResolveParams) (*pagination.Connection, error) {
+	userId, err := r.currentUserId(params.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	if target, ok := params.Args["user_id"].(int); ok && uint64(target) != userId {
+		if err := authorization.CheckRole(r.pgsql, userId, authorization.RoleAdmin); err != nil {
+			return nil, err
+		}
+		userId = uint64(target)
+	}
+
+	first, err := pagination.First(params.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &pagination.Filter{}
+	filter.Add("user_id = ?", userId)
+
+	var totalCount int
+	err = r.pgsql.Get(&totalCount, "SELECT COUNT(*) FROM invoices"+filter.Where(), filter.Args...)
+	if err != nil {
+		return nil, err
+	}
+
+	after, _ := params.Args["after"].(string)
+	if after != "" {
+		cursor, err := pagination.DecodeCursor(after, invoicesSortKey)
+		if err != nil {
+			return nil, err
+		}
+		filter.Add("id < ?", cursor.Id)
+	}
+
+	var invoices []Invoice
+	query := "SELECT * FROM invoices" + filter.Where() + " ORDER BY id DESC LIMIT " + filter.Arg(first+1)
+	if err := r.pgsql.Select(&invoices, query, filter.Args...); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]interface{}, len(invoices))
+	cursors := make([]string, len(invoices))
+	for i := range invoices {
+		nodes[i] = &invoices[i]
+		cursors[i] = pagination.EncodeCursor(pagination.Cursor{
+			Sort:  invoicesSortKey,
+			Value: strconv.FormatUint(invoices[i].Id, 10),
+			Id:    int64(invoices[i].Id),
+		})
+	}
+
+	return pagination.NewConnection(nodes, cursors, first, after != "", totalCount), nil
+}
+
+var pdfFileName = regexp.MustCompile(`^([A-Za-z0-9-]+)\.pdf$`)
+
+func downloadPath(invoice *Invoice) string {
+	return fmt.Sprintf("/invoices/%s.pdf", invoice.Number)
+}
+
+func (r *Resolvers) downloadURL(invoice *Invoice) string {
+	return r.publicURL + downloadPath(invoice)
+}
+
+func (r *Resolvers) DownloadHandler(w http.ResponseWriter, req *http.Request) {
+	match := pdfFileName.FindStringSubmatch(mux.Vars(req)["file"])
+	if match == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	// signed link from receipt gives access to its invoice only
+	signed := req.URL.Query().Get("signature") != ""
+	if signed {
+		if r.signer == nil {
+			http.Error(w, "invalid link", http.StatusForbidden)
+			return
+		}
+
+		if err := r.signer.Verify(req.URL.Path, req.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	ctx := context.WithValue(req.Context(), authorization.AuthHeaderKey, authorization.GetAuthToken(req))
+	var userId uint64
+	if !signed {
+		var err error
+		userId, err = r.currentUserId(ctx)
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var invoice Invoice
+	err := r.pgsql.GetContext(ctx, &invoice, "SELECT * FROM invoices WHERE number=$1", match[1])
+	if err == sql.ErrNoRows {
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		http.Error(w, "unable to load invoice", http.StatusInternalServerError)
+		return
+	}
+
+	// invoices of other users are not revealed
+	if !signed && (invoice.UserId == nil || *invoice.UserId != userId) {
+		if err := authorization.CheckRole(r.pgsql, userId, authorization.RoleAdmin); err != nil {
+			http.NotFound(w, req)
+			return
+		}
+	}
+
+	invoiceLines, err := lines(r.pgsql, invoice.Id)
+	if err != nil {
+		http.Error(w, "unable to load invoice", http.StatusInternalServerError)
+		return
+	}
+
+	var document bytes.Buffer
+	// text which can not be shown in PDF fonts is reported instead of being replaced
+	if err := Render(&document, &invoice, invoiceLines); err != nil {
+		log.Printf("unable to render invoice %s: %s", invoice.Number, err)
+		http.Error(w, "unable to render invoice", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, invoice.Number))
+	w.Header().Set("Content-Length", strconv.Itoa(document.Len()))
+	w.Header().Set("Cache-Control", "private, no-store")
+	document.WriteTo(w)
+}
+
+func (r *Resolvers) SendReceipts(ctx context.Context) (int, error) {
+	if r.notify == nil {
+		return 0, nil
+	}
+
+	if r.signer == nil {
+		return 0, fmt.Errorf("signer is required for download links in receipts")
+	}
+
+	var invoices []Invoice
+	err := r.pgsql.SelectContext(ctx, &invoices,
+		"SELECT * FROM invoices WHERE receipt_sent_at IS NULL AND user_id IS NOT NULL ORDER BY id LIMIT 100",
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range invoices {
+		invoice := &invoices[i]
+		err := r.notify(ctx, *invoice.UserId, func(email string, f *locale.Formatter) mailer.Message {
+			return r.receipt(email, f, invoice)
+		})
+		// receipt is sent again on next run
+		if err != nil {
+			log.Printf("unable to send receipt for invoice %s: %s", invoice.Number, err)
+			continue
+		}
+
+		// receipt disabled by settings is marked as sent as well
+		_, err = r.pgsql.ExecContext(ctx, "UPDATE invoices SET receipt_sent_at=NOW() WHERE id=$1", invoice.Id)
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+func (r *Resolvers) receipt(email string, f *locale.Formatter, invoice *Invoice) mailer.Message {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Thank you for your payment.\n\n")
+	fmt.Fprintf(&body, "Invoice: %s\n", invoice.Number)
+	fmt.Fprintf(&body, "Date: %s\n", f.DateTime(invoice.IssuedAt))
+	fmt.Fprintf(&body, "Amount: %s\n", f.Money(invoice.money(invoice.Total)))
+	if invoice.TaxRate > 0 {
+		fmt.Fprintf(&body, "Including %s %s: %s\n", invoice.TaxName, percent(invoice.TaxRate), f.Money(invoice.money(invoice.Tax)))
+	}
+	link, expiresAt := r.signer.Sign(r.publicURL, downloadPath(invoice), ReceiptLinkTTL)
+	fmt.Fprintf(&body, "\nDownload PDF: %s\n", link)
+	fmt.Fprintf(&body, "The link is valid until %s, later the invoice can be downloaded from your account.\n", f.Date(expiresAt))
+
+	return mailer.Message{
+		To:      email,
+		Subject: "Receipt " + invoice.Number,
+		Body:    body.String(),
+	}
+}
+
+// invoice of payment, empty when payment was not captured
+func ForPayment(q sqlx.Queryer, paymentId uint64) (*Invoice, error) {
+	return find(q, "SELECT * FROM invoices WHERE payment_id=$1", paymentId)
+}
+
+// invoice of subscription charge, empty when charge was not paid or is a credit
+func ForSubscriptionCharge(q sqlx.Queryer, chargeId uint64) (*Invoice, error) {
+	return find(q, "SELECT * FROM invoices WHERE subscription_charge_id=$1", chargeId)
+}
+
+func find(q sqlx.Queryer, query string, id uint64) (*Invoice, error) {
+	var invoice Invoice
+	err := sqlx.Get(q, &invoice, query, id)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
@@ -0,0 +1,122 @@
+package invoices
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/db/dbtest"
+	"github.com/Moranilt/go-graphql-location/locale"
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/Moranilt/go-graphql-location/signedurl"
+	"github.com/gorilla/mux"
+)
+
+// user from seed of db/users.sql
+const testUserId = 1
+
+var receiptLink = regexp.MustCompile(`Download PDF: (\S+)`)
+
+func TestReceiptLink(t *testing.T) {
+	signer := signedurl.NewSigner([]byte("secret"))
+	r := &Resolvers{publicURL: "https://api.example.com", signer: signer}
+	invoice := &Invoice{Number: "INV-2024-000001", Currency: "USD", Total: 1499, IssuedAt: time.Now()}
+
+	message := r.receipt("test@mail.com", locale.New(locale.DefaultLocale, locale.DefaultTimezone, "USD"), invoice)
+
+	match := receiptLink.FindStringSubmatch(message.Body)
+	if match == nil {
+		t.Fatalf("receipt has no download link: %s", message.Body)
+	}
+
+	link, err := url.Parse(match[1])
+	if err != nil {
+		t.Fatalf("invalid link %s: %v", match[1], err)
+	}
+
+	if link.Host != "api.example.com" || link.Path != "/invoices/INV-2024-000001.pdf" {
+		t.Fatalf("got link %s", link)
+	}
+
+	if err := signer.Verify(link.Path, link.Query()); err != nil {
+		t.Fatalf("link from receipt is rejected: %v", err)
+	}
+}
+
+func TestDownloadHandler(t *testing.T) {
+	db := dbtest.Open(t)
+	signer := signedurl.NewSigner([]byte("secret"))
+	r := GetResolvers(db, nil, Options{Config: Config{Prefix: "INV"}, Signer: signer})
+
+	tx := db.MustBegin()
+	var paymentId uint64
+	err := tx.Get(&paymentId, "INSERT INTO payments (user_id, amount, status) VALUES ($1, 1499, 'captured') RETURNING id", testUserId)
+	if err != nil {
+		t.Fatalf("insert payment: %v", err)
+	}
+
+	userId := uint64(testUserId)
+	invoice, err := r.Issue(tx, Source{
+		PaymentId:   &paymentId,
+		UserId:      &userId,
+		Description: "Wallet top-up",
+		Amount:      money.Money{Amount: 1499, Currency: "USD"},
+	})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.Path("/invoices/{file}").Methods(http.MethodGet).HandlerFunc(r.DownloadHandler)
+
+	signed, _ := signer.Sign("", downloadPath(invoice), ReceiptLinkTTL)
+	expired, _ := signer.Sign("", downloadPath(invoice), -time.Minute)
+	another, _ := signer.Sign("", "/invoices/INV-2024-999999.pdf", ReceiptLinkTTL)
+	forged, _ := signedurl.NewSigner([]byte("another")).Sign("", downloadPath(invoice), ReceiptLinkTTL)
+
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{name: "signed link", target: signed, want: http.StatusOK},
+		{name: "expired link", target: expired, want: http.StatusForbidden},
+		{name: "link of another invoice", target: "/invoices/" + invoice.Number + ".pdf?" + mustQuery(t, another), want: http.StatusForbidden},
+		{name: "forged signature", target: forged, want: http.StatusForbidden},
+		{name: "without signature and token", target: downloadPath(invoice), want: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.target, nil))
+
+			if recorder.Code != test.want {
+				t.Fatalf("got status %d, want %d: %s", recorder.Code, test.want, recorder.Body)
+			}
+
+			if test.want == http.StatusOK && recorder.Header().Get("Content-Type") != "application/pdf" {
+				t.Fatalf("got content type %s", recorder.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+// query of signed link, e.g. to use it with another path
+func mustQuery(t *testing.T, link string) string {
+	t.Helper()
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("invalid link %s: %v", link, err)
+	}
+
+	return parsed.RawQuery
+}
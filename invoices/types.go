@@ -0,0 +1,168 @@
+package invoices
+
+import (
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/Moranilt/go-graphql-location/pagination"
+	"github.com/graphql-go/graphql"
+)
+
+type Types struct {
+	Invoice  *graphql.Object
+	Invoices *graphql.Object
+}
+
+func GetTypes() Types {
+	return Types{
+		Invoice:  invoiceType,
+		Invoices: invoicesConnectionType,
+	}
+}
+
+type Arguments struct {
+	Invoices graphql.FieldConfigArgument
+}
+
+func GetArguments() Arguments {
+	return Arguments{
+		Invoices: invoicesArgs,
+	}
+}
+
+var invoicesArgs = pagination.Args(graphql.FieldConfigArgument{
+	"user_id": &graphql.ArgumentConfig{
+		Type:        graphql.Int,
+		Description: "Invoices of another user, only for admins",
+	},
+})
+
+func sourceInvoice(params graphql.ResolveParams) *Invoice {
+	switch source := params.Source.(type) {
+	case *Invoice:
+		return source
+	case Invoice:
+		return &source
+	}
+	return nil
+}
+
+// resolver of Money field of Invoice
+func invoiceAmount(amount func(invoice *Invoice) int64) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		if invoice := sourceInvoice(params); invoice != nil {
+			return invoice.money(amount(invoice)), nil
+		}
+		return nil, nil
+	}
+}
+
+// resolver of Money field of InvoiceLine
+func lineAmount(amount func(line Line) int64) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		if line, ok := params.Source.(Line); ok {
+			return money.Money{Amount: amount(line), Currency: line.Currency}, nil
+		}
+		return nil, nil
+	}
+}
+
+var lineType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "InvoiceLine",
+	Fields: graphql.Fields{
+		"kind": &graphql.Field{
+			Type:        graphql.String,
+			Description: "item or tax",
+		},
+		"description": &graphql.Field{
+			Type: graphql.String,
+		},
+		"quantity": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"unit_amount": &graphql.Field{
+			Type:    money.Type,
+			Resolve: lineAmount(func(line Line) int64 { return line.UnitAmount }),
+		},
+		"amount": &graphql.Field{
+			Type:    money.Type,
+			Resolve: lineAmount(func(line Line) int64 { return line.Amount }),
+		},
+	},
+})
+
+var invoiceType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Invoice",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"number": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Sequential number within year, e.g. INV-2024-000001",
+		},
+		"issued_at": &graphql.Field{
+			Type: graphql.String,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				if invoice := sourceInvoice(params); invoice != nil {
+					return invoice.IssuedAt.UTC().Format(time.RFC3339), nil
+				}
+				return nil, nil
+			},
+		},
+		"payment_id": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "Captured payment, empty for invoice of subscription charge",
+		},
+		"subscription_charge_id": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "Paid subscription charge, empty for invoice of payment",
+		},
+		"subtotal": &graphql.Field{
+			Type:        money.Type,
+			Description: "Total without tax",
+			Resolve:     invoiceAmount(func(invoice *Invoice) int64 { return invoice.Subtotal }),
+		},
+		"tax": &graphql.Field{
+			Type:    money.Type,
+			Resolve: invoiceAmount(func(invoice *Invoice) int64 { return invoice.Tax }),
+		},
+		"total": &graphql.Field{
+			Type:    money.Type,
+			Resolve: invoiceAmount(func(invoice *Invoice) int64 { return invoice.Total }),
+		},
+		"billing_name": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Billing details are copied from profile when invoice is issued",
+		},
+		"billing_email": &graphql.Field{
+			Type: graphql.String,
+		},
+		"billing_phone": &graphql.Field{
+			Type: graphql.String,
+		},
+		"lines": &graphql.Field{
+			Type: graphql.NewList(lineType),
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				invoice := sourceInvoice(params)
+				if invoice == nil || fieldResolvers == nil {
+					return nil, nil
+				}
+				return lines(fieldResolvers.pgsql, invoice.Id)
+			},
+		},
+		"download_url": &graphql.Field{
+			Type:        graphql.String,
+			Description: "PDF, request requires Authorization header",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				invoice := sourceInvoice(params)
+				if invoice == nil || fieldResolvers == nil {
+					return nil, nil
+				}
+				return fieldResolvers.downloadURL(invoice), nil
+			},
+		},
+	},
+})
+
+var invoicesConnectionType = pagination.ConnectionType("Invoices", invoiceType)
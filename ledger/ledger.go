@@ -0,0 +1,287 @@
+// Package ledger keeps money movements as double-entry journal.
+// Every entry has postings which net to zero in each currency, balances are sums of postings.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	TypeAsset     = "asset"
+	TypeLiability = "liability"
+	TypeRevenue   = "revenue"
+	TypeExpense   = "expense"
+	TypeEquity    = "equity"
+)
+
+// account is created on first posting, Code is unique
+type Account struct {
+	Code     string
+	Type     string
+	UserId   *uint64
+	Currency string
+}
+
+// money which is owed to the user
+func UserWallet(userId uint64, currency string) Account {
+	return Account{
+		Code:     fmt.Sprintf("user:%d:wallet:%s", userId, currency),
+		Type:     TypeLiability,
+		UserId:   &userId,
+		Currency: currency,
+	}
+}
+
+// money held by payment provider
+func ProviderFunds(provider string, currency string) Account {
+	return Account{
+		Code:     fmt.Sprintf("provider:%s:%s", provider, currency),
+		Type:     TypeAsset,
+		Currency: currency,
+	}
+}
+
+// income from sold goods, e.g. "subscriptions"
+func Revenue(name string, currency string) Account {
+	return Account{
+		Code:     fmt.Sprintf("revenue:%s:%s", name, currency),
+		Type:     TypeRevenue,
+		Currency: currency,
+	}
+}
+
+// money received for nobody, e.g. payments of deleted users
+func Suspense(currency string) Account {
+	return Account{
+		Code:     "system:suspense:" + currency,
+		Type:     TypeLiability,
+		Currency: currency,
+	}
+}
+
+var ErrInsufficientFunds = errors.New("insufficient funds in wallet")
+
+type Posting struct {
+	Account Account
+	// minor units, debit is positive and credit is negative
+	Amount int64
+}
+
+type Entry struct {
+	// unique key of entry, the same movement can not be posted twice
+	Reference   string
+	Description string
+	Postings    []Posting
+}
+
+func (entry Entry) validate() error {
+	if len(entry.Postings) < 2 {
+		return fmt.Errorf("ledger entry %s needs at least two postings", entry.Reference)
+	}
+
+	sums := map[string]int64{}
+	for _, posting := range entry.Postings {
+		if posting.Amount == 0 {
+			return fmt.Errorf("ledger entry %s has empty posting to %s", entry.Reference, posting.Account.Code)
+		}
+		sums[posting.Account.Currency] += posting.Amount
+	}
+
+	for currency, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("ledger entry %s is not balanced in %s by %d", entry.Reference, currency, sum)
+		}
+	}
+
+	return nil
+}
+
+// write balanced entry in transaction of caller, accounts are created when missing
+func Post(tx *sqlx.Tx, entry Entry) (uint64, error) {
+	if err := entry.validate(); err != nil {
+		return 0, err
+	}
+
+	var entryId uint64
+	err := tx.Get(&entryId,
+		"INSERT INTO ledger_entries (reference, description) VALUES ($1, $2) RETURNING id",
+		entry.Reference, entry.Description,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, posting := range entry.Postings {
+		accountId, err := accountId(tx, posting.Account)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.Exec(
+			"INSERT INTO ledger_postings (entry_id, account_id, amount, currency) VALUES ($1, $2, $3, $4)",
+			entryId, accountId, posting.Amount, posting.Account.Currency,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return entryId, nil
+}
+
+// move amount from credit account to debit account
+func Transfer(tx *sqlx.Tx, reference string, description string, debit Account, credit Account, amount int64) error {
+	_, err := Post(tx, Entry{
+		Reference:   reference,
+		Description: description,
+		Postings: []Posting{
+			{Account: debit, Amount: amount},
+			{Account: credit, Amount: -amount},
+		},
+	})
+	return err
+}
+
+// move amount from wallet of user to credit account when wallet has enough money.
+// Wallet is locked until the end of transaction, so concurrent charges can not overdraw it.
+func Charge(tx *sqlx.Tx, reference string, description string, userId uint64, credit Account, amount int64) error {
+	if err := CheckFunds(tx, userId, credit.Currency, amount); err != nil {
+		return err
+	}
+
+	return Transfer(tx, reference, description, UserWallet(userId, credit.Currency), credit, amount)
+}
+
+// lock wallet of user until the end of transaction and return ErrInsufficientFunds when
+// its balance is less than amount. Used before calls which can not be rolled back.
+func CheckFunds(tx *sqlx.Tx, userId uint64, currency string, amount int64) error {
+	walletId, err := accountId(tx, UserWallet(userId, currency))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("SELECT id FROM ledger_accounts WHERE id=$1 FOR UPDATE", walletId); err != nil {
+		return err
+	}
+
+	var balance int64
+	err = tx.Get(&balance, "SELECT COALESCE(-SUM(amount), 0) FROM ledger_postings WHERE account_id=$1", walletId)
+	if err != nil {
+		return err
+	}
+
+	if balance < amount {
+		return ErrInsufficientFunds
+	}
+
+	return nil
+}
+
+func accountId(tx *sqlx.Tx, account Account) (uint64, error) {
+	_, err := tx.Exec(
+		"INSERT INTO ledger_accounts (code, type, user_id, currency) VALUES ($1, $2, $3, $4) ON CONFLICT (code) DO NOTHING",
+		account.Code, account.Type, account.UserId, account.Currency,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var id uint64
+	err = tx.Get(&id, "SELECT id FROM ledger_accounts WHERE code=$1", account.Code)
+	return id, err
+}
+
+// wallet balances of user per currency, ordered by currency
+func Balances(q sqlx.Queryer, userId uint64) ([]money.Money, error) {
+	balances := []money.Money{}
+	err := sqlx.Select(q, &balances,
+		`SELECT accounts.currency, COALESCE(-SUM(postings.amount), 0) AS amount
+		FROM ledger_accounts accounts
+		LEFT JOIN ledger_postings postings ON postings.account_id = accounts.id
+		WHERE accounts.user_id = $1 AND accounts.type = $2
+		GROUP BY accounts.currency ORDER BY accounts.currency`,
+		userId, TypeLiability,
+	)
+	return balances, err
+}
+
+type UnbalancedEntry struct {
+	EntryId   uint64 `db:"entry_id"`
+	Reference string `db:"reference"`
+	Currency  string `db:"currency"`
+	Sum       int64  `db:"sum"`
+}
+
+type CheckReport struct {
+	Entries  int
+	Postings int
+	// entries which do not net to zero in some currency
+	Unbalanced []UnbalancedEntry
+	// postings in currency other than currency of their account
+	CurrencyMismatches []uint64
+	// sum of all postings per currency, zero when ledger is consistent
+	Totals []money.Money
+}
+
+func (report *CheckReport) Consistent() bool {
+	for _, total := range report.Totals {
+		if total.Amount != 0 {
+			return false
+		}
+	}
+	return len(report.Unbalanced) == 0 && len(report.CurrencyMismatches) == 0
+}
+
+// verify that every entry and the whole ledger net to zero
+func Check(ctx context.Context, db *sqlx.DB) (*CheckReport, error) {
+	report := &CheckReport{
+		Unbalanced:         []UnbalancedEntry{},
+		CurrencyMismatches: []uint64{},
+		Totals:             []money.Money{},
+	}
+
+	if err := db.GetContext(ctx, &report.Entries, "SELECT COUNT(*) FROM ledger_entries"); err != nil {
+		return nil, err
+	}
+
+	if err := db.GetContext(ctx, &report.Postings, "SELECT COUNT(*) FROM ledger_postings"); err != nil {
+		return nil, err
+	}
+
+	// entries without postings are unbalanced as well
+	err := db.SelectContext(ctx, &report.Unbalanced,
+		`SELECT entries.id AS entry_id, entries.reference, COALESCE(postings.currency, '') AS currency,
+			COALESCE(SUM(postings.amount), 0) AS sum
+		FROM ledger_entries entries
+		LEFT JOIN ledger_postings postings ON postings.entry_id = entries.id
+		GROUP BY entries.id, entries.reference, postings.currency
+		HAVING COALESCE(SUM(postings.amount), 0) <> 0 OR COUNT(postings.id) < 2
+		ORDER BY entries.id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.SelectContext(ctx, &report.CurrencyMismatches,
+		`SELECT postings.id FROM ledger_postings postings
+		JOIN ledger_accounts accounts ON accounts.id = postings.account_id
+		WHERE postings.currency <> accounts.currency ORDER BY postings.id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.SelectContext(ctx, &report.Totals,
+		"SELECT currency, SUM(amount) AS amount FROM ledger_postings GROUP BY currency ORDER BY currency",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
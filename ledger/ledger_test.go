@@ -0,0 +1,221 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Moranilt/go-graphql-location/db/dbtest"
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/jmoiron/sqlx"
+)
+
+// user from seed of db/users.sql
+const testUserId = 1
+
+func TestEntryValidate(t *testing.T) {
+	wallet := UserWallet(testUserId, "USD")
+	funds := ProviderFunds("mock", "USD")
+	revenue := Revenue("subscriptions", "USD")
+	euroWallet := UserWallet(testUserId, "EUR")
+	euroFunds := ProviderFunds("mock", "EUR")
+
+	tests := []struct {
+		name     string
+		postings []Posting
+		wantErr  string
+	}{
+		{
+			name:     "two postings",
+			postings: []Posting{{Account: funds, Amount: 100}, {Account: wallet, Amount: -100}},
+		},
+		{
+			name:     "split credit",
+			postings: []Posting{{Account: wallet, Amount: 100}, {Account: revenue, Amount: -80}, {Account: funds, Amount: -20}},
+		},
+		{
+			name: "balanced in each currency",
+			postings: []Posting{
+				{Account: funds, Amount: 100}, {Account: wallet, Amount: -100},
+				{Account: euroFunds, Amount: 90}, {Account: euroWallet, Amount: -90},
+			},
+		},
+		{
+			name:     "no postings",
+			postings: nil,
+			wantErr:  "ledger entry test needs at least two postings",
+		},
+		{
+			name:     "single posting",
+			postings: []Posting{{Account: funds, Amount: 100}},
+			wantErr:  "ledger entry test needs at least two postings",
+		},
+		{
+			name:     "empty posting",
+			postings: []Posting{{Account: funds, Amount: 0}, {Account: wallet, Amount: 0}},
+			wantErr:  "ledger entry test has empty posting to provider:mock:USD",
+		},
+		{
+			name:     "unbalanced",
+			postings: []Posting{{Account: funds, Amount: 100}, {Account: wallet, Amount: -90}},
+			wantErr:  "ledger entry test is not balanced in USD by 10",
+		},
+		{
+			name:     "balanced only across currencies",
+			postings: []Posting{{Account: funds, Amount: 100}, {Account: euroWallet, Amount: -100}},
+			wantErr:  "ledger entry test is not balanced in",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Entry{Reference: "test", Postings: test.postings}.validate()
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			// currency of unbalanced sum depends on order of map iteration
+			if err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+				t.Fatalf("got error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestPost(t *testing.T) {
+	db := dbtest.Open(t)
+
+	topUp := Entry{
+		Reference:   "test:top-up",
+		Description: "Top-up",
+		Postings: []Posting{
+			{Account: ProviderFunds("mock", "USD"), Amount: 1000},
+			{Account: UserWallet(testUserId, "USD"), Amount: -1000},
+		},
+	}
+
+	inTx(t, db, func(tx *sqlx.Tx) error {
+		_, err := Post(tx, topUp)
+		return err
+	})
+	checkBalances(t, db, money.Money{Amount: 1000, Currency: "USD"})
+
+	// the same movement is not posted twice
+	tx := db.MustBegin()
+	if _, err := Post(tx, topUp); err == nil {
+		t.Fatalf("entry with duplicate reference is posted")
+	}
+	tx.Rollback()
+
+	// unbalanced entry is rejected before it reaches database
+	tx = db.MustBegin()
+	_, err := Post(tx, Entry{
+		Reference: "test:unbalanced",
+		Postings: []Posting{
+			{Account: ProviderFunds("mock", "USD"), Amount: 1000},
+			{Account: UserWallet(testUserId, "USD"), Amount: -900},
+		},
+	})
+	if err == nil {
+		t.Fatalf("unbalanced entry is posted")
+	}
+	tx.Rollback()
+
+	checkBalances(t, db, money.Money{Amount: 1000, Currency: "USD"})
+
+	report, err := Check(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	if !report.Consistent() || report.Entries != 1 || report.Postings != 2 {
+		t.Fatalf("got report %+v, want one consistent entry", report)
+	}
+}
+
+func TestCharge(t *testing.T) {
+	db := dbtest.Open(t)
+	revenue := Revenue("subscriptions", "USD")
+
+	inTx(t, db, func(tx *sqlx.Tx) error {
+		return Transfer(tx, "test:top-up", "Top-up", ProviderFunds("mock", "USD"), UserWallet(testUserId, "USD"), 1000)
+	})
+
+	tests := []struct {
+		name      string
+		reference string
+		amount    int64
+		wantErr   error
+		balance   int64
+	}{
+		{name: "part of wallet", reference: "test:charge-1", amount: 600, balance: 400},
+		{name: "more than wallet", reference: "test:charge-2", amount: 401, wantErr: ErrInsufficientFunds, balance: 400},
+		{name: "whole wallet", reference: "test:charge-3", amount: 400, balance: 0},
+		{name: "empty wallet", reference: "test:charge-4", amount: 1, wantErr: ErrInsufficientFunds, balance: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := db.MustBegin()
+			defer tx.Rollback()
+
+			err := Charge(tx, test.reference, "Charge", testUserId, revenue, test.amount)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+
+			if err == nil {
+				if err := tx.Commit(); err != nil {
+					t.Fatalf("commit failed: %v", err)
+				}
+			}
+
+			checkBalances(t, db, money.Money{Amount: test.balance, Currency: "USD"})
+		})
+	}
+
+	// wallet in another currency is not created with money
+	tx := db.MustBegin()
+	defer tx.Rollback()
+	if err := Charge(tx, "test:charge-eur", "Charge", testUserId, Revenue("subscriptions", "EUR"), 1); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("got error %v, want %v", err, ErrInsufficientFunds)
+	}
+}
+
+func inTx(t *testing.T, db *sqlx.DB, apply func(tx *sqlx.Tx) error) {
+	t.Helper()
+
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	if err := apply(tx); err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+}
+
+func checkBalances(t *testing.T, db *sqlx.DB, want ...money.Money) {
+	t.Helper()
+
+	balances, err := Balances(db, testUserId)
+	if err != nil {
+		t.Fatalf("Balances: %v", err)
+	}
+
+	if len(balances) != len(want) {
+		t.Fatalf("got balances %v, want %v", balances, want)
+	}
+
+	for i := range want {
+		if balances[i] != want[i] {
+			t.Fatalf("got balances %v, want %v", balances, want)
+		}
+	}
+}
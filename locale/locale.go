@@ -0,0 +1,175 @@
+// Package locale formats dates and amounts for users according to their settings.
+package locale
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/money"
+
+	// timezone database for systems without zoneinfo
+	_ "time/tzdata"
+)
+
+const (
+	DefaultLocale   = "en"
+	DefaultTimezone = "UTC"
+	DefaultCurrency = "USD"
+)
+
+type format struct {
+	dateTime  string
+	date      string
+	decimal   string
+	thousands string
+	// currency is placed after amount
+	currencyAfter bool
+}
+
+// supported languages, region part of locale does not change formatting
+var formats = map[string]format{
+	"en": {dateTime: "Jan 2, 2006 3:04 PM MST", date: "Jan 2, 2006", decimal: ".", thousands: ","},
+	"ru": {dateTime: "02.01.2006 15:04 MST", date: "02.01.2006", decimal: ",", thousands: " ", currencyAfter: true},
+	"de": {dateTime: "02.01.2006 15:04 MST", date: "02.01.2006", decimal: ",", thousands: ".", currencyAfter: true},
+	"fr": {dateTime: "02/01/2006 15:04 MST", date: "02/01/2006", decimal: ",", thousands: " ", currencyAfter: true},
+	"es": {dateTime: "02/01/2006 15:04 MST", date: "02/01/2006", decimal: ",", thousands: ".", currencyAfter: true},
+}
+
+// symbols of common currencies, code is shown for others
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"RUB": "₽",
+	"JPY": "¥",
+	"CNY": "CN¥",
+	"CHF": "CHF",
+	"CAD": "CA$",
+	"AUD": "A$",
+	"PLN": "zł",
+}
+
+var localePattern = regexp.MustCompile(`^([a-z]{2})(-[A-Z]{2})?$`)
+
+func ValidateLocale(value string) error {
+	match := localePattern.FindStringSubmatch(value)
+	if match == nil {
+		return fmt.Errorf("locale must look like en or en-US")
+	}
+
+	if _, ok := formats[match[1]]; !ok {
+		return fmt.Errorf("locale %s is not supported", value)
+	}
+
+	return nil
+}
+
+func ValidateTimezone(value string) error {
+	// empty name and "Local" are accepted by time.LoadLocation, but depend on server
+	if value == "" || value == "Local" {
+		return fmt.Errorf("unknown timezone: %s", value)
+	}
+
+	if _, err := time.LoadLocation(value); err != nil {
+		return fmt.Errorf("unknown timezone: %s", value)
+	}
+
+	return nil
+}
+
+func ValidateCurrency(value string) error {
+	return money.ValidateCurrency(value)
+}
+
+type Formatter struct {
+	format   format
+	location *time.Location
+	currency string
+}
+
+// formatter for locale, IANA timezone and currency code.
+// Invalid values are replaced by defaults, so formatting never fails.
+func New(localeName string, timezone string, currency string) *Formatter {
+	language := strings.SplitN(localeName, "-", 2)[0]
+	f, ok := formats[language]
+	if !ok {
+		f = formats[DefaultLocale]
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "" {
+		location = time.UTC
+	}
+
+	if ValidateCurrency(currency) != nil {
+		currency = DefaultCurrency
+	}
+
+	return &Formatter{format: f, location: location, currency: currency}
+}
+
+func (f *Formatter) DateTime(t time.Time) string {
+	return t.In(f.location).Format(f.format.dateTime)
+}
+
+func (f *Formatter) Date(t time.Time) string {
+	return t.In(f.location).Format(f.format.date)
+}
+
+// exact amount with symbol of its currency, e.g. "$1,234.50" or "1.234,50 €".
+// Symbol is used for preferred currency only, other amounts are formatted by Amount,
+// so amount in another currency is not taken for amount in preferred one.
+func (f *Formatter) Money(amount money.Money) string {
+	symbol, ok := currencySymbols[amount.Currency]
+	if !ok || amount.Currency != f.currency {
+		return f.Amount(amount)
+	}
+
+	number := f.group(amount.Decimal())
+	if f.format.currencyAfter {
+		return number + " " + symbol
+	}
+
+	if strings.HasPrefix(number, "-") {
+		return "-" + symbol + number[1:]
+	}
+	return symbol + number
+}
+
+// exact amount with ISO code of currency, e.g. "1,234.50 USD", used in documents
+func (f *Formatter) Amount(amount money.Money) string {
+	return f.group(amount.Decimal()) + " " + amount.Currency
+}
+
+// apply separators of locale to decimal number like "-1234.50"
+func (f *Formatter) group(decimal string) string {
+	sign := ""
+	if strings.HasPrefix(decimal, "-") {
+		sign, decimal = "-", decimal[1:]
+	}
+
+	parts := strings.SplitN(decimal, ".", 2)
+	integer := parts[0]
+
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteString(f.format.thousands)
+		}
+		grouped.WriteRune(digit)
+	}
+
+	result := grouped.String()
+	if len(parts) == 2 {
+		result += f.format.decimal + parts[1]
+	}
+
+	// rounded to zero amount has no sign
+	if strings.Trim(decimal, "0.") == "" {
+		sign = ""
+	}
+
+	return sign + result
+}
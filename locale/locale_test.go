@@ -0,0 +1,31 @@
+package locale
+
+import (
+	"testing"
+
+	"github.com/Moranilt/go-graphql-location/money"
+)
+
+func TestMoney(t *testing.T) {
+	tests := []struct {
+		name      string
+		formatter *Formatter
+		amount    money.Money
+		want      string
+	}{
+		{name: "preferred currency", formatter: New("en-US", "UTC", "USD"), amount: money.Money{Amount: 123450, Currency: "USD"}, want: "$1,234.50"},
+		{name: "negative amount", formatter: New("en", "UTC", "USD"), amount: money.Money{Amount: -150, Currency: "USD"}, want: "-$1.50"},
+		{name: "symbol after amount", formatter: New("de", "UTC", "EUR"), amount: money.Money{Amount: 123450, Currency: "EUR"}, want: "1.234,50 €"},
+		{name: "another currency", formatter: New("en", "UTC", "EUR"), amount: money.Money{Amount: 123450, Currency: "USD"}, want: "1,234.50 USD"},
+		{name: "currency without symbol", formatter: New("ru", "UTC", "SEK"), amount: money.Money{Amount: 123450, Currency: "SEK"}, want: "1 234,50 SEK"},
+		{name: "invalid preferred currency", formatter: New("en", "UTC", "dollars"), amount: money.Money{Amount: 100, Currency: "USD"}, want: "$1.00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.formatter.Money(test.amount); got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	// Send a plain text message to a single recipient.
+	Send(ctx context.Context, msg Message) error
+}
+
+type Config struct {
+	Backend  string `yaml:"backend"`
+	From     string `yaml:"from"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// create mailer by backend name from config. Empty backend is "log"
+func New(config Config) (Mailer, error) {
+	switch config.Backend {
+	case "", "log":
+		return &LogMailer{}, nil
+	case "smtp":
+		if config.Host == "" || config.From == "" {
+			return nil, fmt.Errorf("smtp mailer requires host and from")
+		}
+		return &SMTPMailer{config: config}, nil
+	}
+
+	return nil, fmt.Errorf("unknown mail backend: %s", config.Backend)
+}
+
+// mailer for development, writes messages to the log instead of sending them
+type LogMailer struct{}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+type SMTPMailer struct {
+	config Config
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	port := m.config.Port
+	if port == 0 {
+		port = 25
+	}
+	addr := fmt.Sprintf("%s:%d", m.config.Host, port)
+
+	var auth smtp.Auth
+	if m.config.User != "" {
+		auth = smtp.PlainAuth("", m.config.User, m.config.Password, m.config.Host)
+	}
+
+	headers := []string{
+		"From: " + m.config.From,
+		"To: " + headerValue(msg.To),
+		"Subject: " + headerValue(msg.Subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	body := strings.Join(headers, "\r\n") + "\r\n\r\n" + msg.Body
+
+	return smtp.SendMail(addr, auth, m.config.From, []string{msg.To}, []byte(body))
+}
+
+// strip line breaks to prevent header injection
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
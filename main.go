@@ -2,14 +2,26 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"io/ioutil"
+	"flag"
 	"log"
 	"net/http"
-	"os"
+	"time"
 
 	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/blobstore"
+	"github.com/Moranilt/go-graphql-location/config"
+	"github.com/Moranilt/go-graphql-location/gqlupload"
+	"github.com/Moranilt/go-graphql-location/idempotency"
+	"github.com/Moranilt/go-graphql-location/invoices"
+	"github.com/Moranilt/go-graphql-location/locale"
+	"github.com/Moranilt/go-graphql-location/mailer"
+	"github.com/Moranilt/go-graphql-location/oidc"
 	"github.com/Moranilt/go-graphql-location/payments"
+	"github.com/Moranilt/go-graphql-location/payments/provider"
+	"github.com/Moranilt/go-graphql-location/signedurl"
+	"github.com/Moranilt/go-graphql-location/sms"
+	"github.com/Moranilt/go-graphql-location/sqlpatch"
+	"github.com/Moranilt/go-graphql-location/subscriptions"
 	"github.com/Moranilt/go-graphql-location/user"
 	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
@@ -17,30 +29,21 @@ import (
 	gqlhandler "github.com/graphql-go/handler"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
-	"gopkg.in/yaml.v2"
 )
 
-type DBConfig struct {
-	User     string `yaml:"USER"`
-	Password string `yaml:"PASSWORD"`
-	Database string `yaml:"DATABASE"`
-	Ssl      string `yaml:"SSL_MODE"`
-}
-type Config struct {
-	DB             DBConfig
-	ACCESS_SECRET  string `yaml:"secret_key"`
-	REFRESH_SECRET string `yaml:"secret_refresh_key"`
-	RedisDSN       string `yaml:"redis_dsn"`
-}
-
 type Repository struct {
+	Auth              *authorization.Config
 	Pgsql             *sqlx.DB
 	RedisClient       *redis.Client
+	Blobs             blobstore.BlobStore
+	Idempotency       *idempotency.Store
 	UserResolvers     user.Resolverers
 	PaymentsResolvers payments.Resolverers
+	Subscriptions     subscriptions.Resolverers
+	Invoices          invoices.Resolverers
 }
 
-var config *Config
+var cfg *config.Config
 var repository *Repository
 
 func initRedis(ctx context.Context, redisDSN string) (*redis.Client, error) {
@@ -60,30 +63,26 @@ func initRedis(ctx context.Context, redisDSN string) (*redis.Client, error) {
 	return client, err
 }
 
-func getConfig() *Config {
-	content, err := ioutil.ReadFile("./config.yml")
-
-	if err != nil {
-		log.Fatal(err)
-	}
-	config := &Config{}
-	err = yaml.Unmarshal(content, &config)
-
-	if err != nil {
-		log.Fatal(err)
+// run job now and then every interval until context is done
+func runPeriodically(ctx context.Context, interval time.Duration, name string, job func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(ctx); err != nil {
+			log.Printf("%s failed: %s", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
-
-	return config
 }
 
 func initDb() (*sqlx.DB, error) {
-
-	db_config := fmt.Sprintf(
-		"user=%s password=%s dbname=%s sslmode=%s",
-		config.DB.User, config.DB.Password, config.DB.Database, config.DB.Ssl,
-	)
-
-	db, err := sqlx.Connect("postgres", db_config)
+	db, err := sqlx.Connect("postgres", cfg.DSN())
 
 	if err != nil {
 		return nil, err
@@ -96,9 +95,10 @@ var Query = graphql.NewObject(graphql.ObjectConfig{
 	Name: "GeoLocationRemember",
 	Fields: graphql.Fields{
 		"users": &graphql.Field{
-			Type: graphql.NewList(user.GetTypes().User),
+			Type: user.GetTypes().Users,
+			Args: user.GetArguments().Users,
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
-				users, err := repository.UserResolvers.AllUsers()
+				users, err := repository.UserResolvers.Users(params)
 
 				if err != nil {
 					return nil, err
@@ -107,6 +107,82 @@ var Query = graphql.NewObject(graphql.ObjectConfig{
 				return users, nil
 			},
 		},
+		"payments": &graphql.Field{
+			Type: payments.GetTypes().Payments,
+			Args: payments.GetArguments().Payments,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.PaymentsResolvers.Payments(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"plans": &graphql.Field{
+			Type: graphql.NewList(subscriptions.GetTypes().Plan),
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.Subscriptions.Plans(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"subscription": &graphql.Field{
+			Type: subscriptions.GetTypes().Subscription,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.Subscriptions.Subscription(params)
+
+				if err != nil || result == nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"invoices": &graphql.Field{
+			Type: invoices.GetTypes().Invoices,
+			Args: invoices.GetArguments().Invoices,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.Invoices.Invoices(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"paymentStats": &graphql.Field{
+			Type: graphql.NewList(payments.GetTypes().Stats),
+			Args: payments.GetArguments().Stats,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.PaymentsResolvers.Stats(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"searchUsers": &graphql.Field{
+			Type: user.GetTypes().SearchUsers,
+			Args: user.GetArguments().SearchUsers,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.SearchUsers(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
 		"user": &graphql.Field{
 			Type: user.GetTypes().User,
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
@@ -119,6 +195,29 @@ var Query = graphql.NewObject(graphql.ObjectConfig{
 				return user, nil
 			},
 		},
+		"oidcProviders": &graphql.Field{
+			Type:        graphql.NewList(graphql.String),
+			Description: "Names of external identity providers available for login",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				return repository.UserResolvers.OidcProviders(), nil
+			},
+		},
+		"isLoginAvailable": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Login is not taken by another user, case is ignored",
+			Args:        user.GetArguments().IsLoginAvailable,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				return repository.UserResolvers.IsLoginAvailable(params)
+			},
+		},
+		"isEmailAvailable": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Email is not used by another user, case is ignored",
+			Args:        user.GetArguments().IsEmailAvailable,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				return repository.UserResolvers.IsEmailAvailable(params)
+			},
+		},
 	},
 })
 
@@ -189,7 +288,198 @@ var Mutation = graphql.NewObject(graphql.ObjectConfig{
 				return tokens, nil
 			},
 		},
-		"createPayment": &graphql.Field{
+		"requestLoginCode": &graphql.Field{
+			Type: user.GetTypes().RequestLoginCode,
+			Args: user.GetArguments().RequestLoginCode,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.RequestLoginCode(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"loginWithCode": &graphql.Field{
+			Type: user.GetTypes().Login,
+			Args: user.GetArguments().LoginWithCode,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				tokens, err := repository.UserResolvers.LoginWithCode(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return tokens, nil
+			},
+		},
+		"oidcAuthUrl": &graphql.Field{
+			Type: user.GetTypes().OidcAuthURL,
+			Args: user.GetArguments().OidcAuthURL,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.OidcAuthURL(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"oidcLogin": &graphql.Field{
+			Type: user.GetTypes().Login,
+			Args: user.GetArguments().OidcCallback,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				tokens, err := repository.UserResolvers.OidcLogin(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return tokens, nil
+			},
+		},
+		"identityLink": &graphql.Field{
+			Type: user.GetTypes().Identity,
+			Args: user.GetArguments().OidcCallback,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.IdentityLink(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"identityUnlink": &graphql.Field{
+			Type: user.GetTypes().IdentityUnlink,
+			Args: user.GetArguments().IdentityUnlink,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.IdentityUnlink(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"requestPhoneVerification": &graphql.Field{
+			Type: user.GetTypes().PhoneVerification,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.RequestPhoneVerification(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"verifyPhone": &graphql.Field{
+			Type: user.GetTypes().PhoneVerification,
+			Args: user.GetArguments().VerifyPhone,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.VerifyPhone(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"deviceApprove": &graphql.Field{
+			Type: user.GetTypes().ApproveDevice,
+			Args: user.GetArguments().ApproveDevice,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.ApproveDevice(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"requestAccountDeletion": &graphql.Field{
+			Type: user.GetTypes().AccountDeletion,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.RequestAccountDeletion(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"cancelAccountDeletion": &graphql.Field{
+			Type: user.GetTypes().AccountDeletion,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.CancelAccountDeletion(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"exportMyData": &graphql.Field{
+			Type: user.GetTypes().Export,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.ExportMyData(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"userSetStatus": &graphql.Field{
+			Type: user.GetTypes().User,
+			Args: user.GetArguments().SetStatus,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.SetStatus(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"uploadAvatar": &graphql.Field{
+			Type: user.GetTypes().User,
+			Args: user.GetArguments().UploadAvatar,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.UploadAvatar(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"updateSettings": &graphql.Field{
+			Type: user.GetTypes().Settings,
+			Args: user.GetArguments().UpdateSettings,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.UserResolvers.UpdateSettings(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		},
+		"createPayment": idempotent("createPayment", &graphql.Field{
 			Type: payments.GetTypes().CreatePayment,
 			Args: payments.GetArguments().Create,
 			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
@@ -201,31 +491,138 @@ var Mutation = graphql.NewObject(graphql.ObjectConfig{
 
 				return result, nil
 			},
-		},
+		}, func() interface{} { return &payments.PaymentsCreateReturn{} }),
+		"confirmPayment": idempotent("confirmPayment", &graphql.Field{
+			Type: payments.GetTypes().Confirmation,
+			Args: payments.GetArguments().Confirm,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.PaymentsResolvers.Confirm(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		}, func() interface{} { return &payments.Confirmation{} }),
+		"paymentTransition": idempotent("paymentTransition", &graphql.Field{
+			Type: payments.GetTypes().Payment,
+			Args: payments.GetArguments().Transition,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.PaymentsResolvers.Transition(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		}, func() interface{} { return &payments.Payment{} }),
+		"cancelPayment": idempotent("cancelPayment", &graphql.Field{
+			Type: payments.GetTypes().Payment,
+			Args: payments.GetArguments().Cancel,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.PaymentsResolvers.Cancel(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		}, func() interface{} { return &payments.Payment{} }),
+		"refundPayment": idempotent("refundPayment", &graphql.Field{
+			Type: payments.GetTypes().Payment,
+			Args: payments.GetArguments().Refund,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.PaymentsResolvers.Refund(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		}, func() interface{} { return &payments.Payment{} }),
+		"subscribe": idempotent("subscribe", &graphql.Field{
+			Type: subscriptions.GetTypes().Subscription,
+			Args: subscriptions.GetArguments().Subscribe,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.Subscriptions.Subscribe(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		}, func() interface{} { return &subscriptions.Subscription{} }),
+		"cancelSubscription": idempotent("cancelSubscription", &graphql.Field{
+			Type: subscriptions.GetTypes().Subscription,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.Subscriptions.Cancel(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		}, func() interface{} { return &subscriptions.Subscription{} }),
+		"changePlan": idempotent("changePlan", &graphql.Field{
+			Type: subscriptions.GetTypes().Subscription,
+			Args: subscriptions.GetArguments().ChangePlan,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				result, err := repository.Subscriptions.ChangePlan(params)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return result, nil
+			},
+		}, func() interface{} { return &subscriptions.Subscription{} }),
 	},
 })
 
+// mutation which replays response for repeated idempotency key, see idempotency.Field
+func idempotent(name string, field *graphql.Field, newResult func() interface{}) *graphql.Field {
+	return idempotency.Field(name, field, newResult, func() *idempotency.Store {
+		return repository.Idempotency
+	})
+}
+
 func customHandler(schema *graphql.Schema) http.Handler {
 	r := mux.NewRouter()
+	r.Path("/oauth/device/code").Methods(http.MethodPost).Handler(
+		authorization.DeviceCodeHandler(repository.RedisClient, cfg.DeviceAuth.VerificationURI, cfg.DeviceAuth.Clients),
+	)
+	r.Path("/exports/{file}").Methods(http.MethodGet).HandlerFunc(repository.UserResolvers.ExportHandler)
+	r.Path("/oauth/token").Methods(http.MethodPost).Handler(
+		authorization.DeviceTokenHandler(repository.Auth, repository.RedisClient, cfg.DeviceAuth.Clients),
+	)
+	r.Path("/invoices/{file}").Methods(http.MethodGet).HandlerFunc(repository.Invoices.DownloadHandler)
+	r.Path("/webhooks/payments/{provider}").Methods(http.MethodPost).HandlerFunc(repository.PaymentsResolvers.WebhookHandler)
+	if local, ok := repository.Blobs.(*blobstore.LocalStore); ok {
+		r.PathPrefix("/files/").Methods(http.MethodGet, http.MethodHead).Handler(
+			http.StripPrefix("/files/", local.Handler()),
+		)
+	}
 	r.Path("/").Handler(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// store authorization header to context
-			next.ServeHTTP(
-				w,
-				r.WithContext(
-					context.WithValue(r.Context(),
-						authorization.AuthHeaderKey,
-						authorization.GetAuthToken(r)),
-				),
-			)
+			// store authorization and idempotency headers to context
+			ctx := context.WithValue(r.Context(), authorization.AuthHeaderKey, authorization.GetAuthToken(r))
+			ctx = context.WithValue(ctx, idempotency.HeaderKey, r.Header.Get("Idempotency-Key"))
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}(
-		gqlhandler.New(&gqlhandler.Config{
+		// multipart requests with files are executed by gqlupload
+		gqlupload.Handler(schema, user.MaxAvatarSize+1<<20, sqlpatch.Variables(gqlhandler.New(&gqlhandler.Config{
 			Schema:     schema,
 			Pretty:     true,
 			Playground: true,
 			GraphiQL:   false,
-		})))
+		})))))
 
 	return r
 }
@@ -233,7 +630,21 @@ func customHandler(schema *graphql.Schema) http.Handler {
 func main() {
 	var globalContext = context.Background()
 
-	config = getConfig()
+	configPath := flag.String("config", config.DefaultPath, "path to yaml config")
+	flag.Parse()
+
+	var err error
+	cfg, err = config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Invalid config: %s", err)
+	}
+
+	if flag.NArg() > 0 {
+		if err := runCommand(globalContext, flag.Arg(0), flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	pgsql, err := initDb()
 	if err != nil {
@@ -241,22 +652,104 @@ func main() {
 	}
 	defer pgsql.Close()
 
-	redisClient, err := initRedis(globalContext, config.RedisDSN)
+	redisClient, err := initRedis(globalContext, cfg.RedisDSN)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer redisClient.Close()
 
-	os.Setenv("ACCESS_SECRET", config.ACCESS_SECRET)
-	os.Setenv("REFRESH_SECRET", config.REFRESH_SECRET)
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	providers, err := oidc.NewRegistry(cfg.OidcProviders, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	smsSender, err := sms.New(cfg.SMS)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	blobs, err := blobstore.New(cfg.BlobStore())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	paymentProvider, err := provider.New(cfg.PaymentProvider)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	auth := cfg.Auth()
+	auth.UserAllowed = func(ctx context.Context, userId uint64) error {
+		return authorization.CheckActive(ctx, pgsql, userId)
+	}
+
+	signer := signedurl.NewSigner(cfg.SigningKey())
+
+	userResolvers := user.GetResolvers(pgsql, redisClient, user.Options{
+		Auth:         auth,
+		Mailer:       mail,
+		LoginLinkURL: cfg.LoginLinkURL,
+		Oidc:         providers,
+		SMS:          smsSender,
+
+		DeletionGracePeriod: time.Duration(cfg.AccountDeletionGraceDays) * time.Hour * 24,
+		ExportsDir:          cfg.ExportsDir,
+		PublicURL:           cfg.PublicURL,
+		Signer:              signer,
+		Blobs:               blobs,
+	})
+
+	// receipts respect payment notification settings of user
+	invoiceResolvers := invoices.GetResolvers(pgsql, redisClient, invoices.Options{
+		Auth:      auth,
+		Config:    cfg.Invoices,
+		PublicURL: cfg.PublicURL,
+		Signer:    signer,
+		Notify: func(ctx context.Context, userId uint64, compose func(email string, f *locale.Formatter) mailer.Message) error {
+			return userResolvers.Notify(ctx, userId, user.NotificationPayments, compose)
+		},
+	})
 
 	repository = &Repository{
-		RedisClient:       redisClient,
-		Pgsql:             pgsql,
-		UserResolvers:     user.GetResolvers(pgsql, redisClient),
-		PaymentsResolvers: payments.GetResolvers(pgsql, redisClient),
+		Auth:          auth,
+		RedisClient:   redisClient,
+		Pgsql:         pgsql,
+		Blobs:         blobs,
+		Idempotency:   idempotency.NewStore(redisClient, auth),
+		UserResolvers: userResolvers,
+		PaymentsResolvers: payments.GetResolvers(pgsql, redisClient, payments.Options{
+			Auth:           auth,
+			Provider:       paymentProvider,
+			ProviderConfig: cfg.PaymentProvider,
+			Invoices:       invoiceResolvers,
+		}),
+		Subscriptions: subscriptions.GetResolvers(pgsql, redisClient, subscriptions.Options{
+			Auth:     auth,
+			Invoices: invoiceResolvers,
+		}),
+		Invoices: invoiceResolvers,
 	}
 
+	go runPeriodically(globalContext, subscriptions.BillingInterval, "subscription billing", func(ctx context.Context) error {
+		_, err := repository.Subscriptions.RunBilling(ctx)
+		return err
+	})
+
+	go runPeriodically(globalContext, time.Minute, "send receipts", func(ctx context.Context) error {
+		_, err := repository.Invoices.SendReceipts(ctx)
+		return err
+	})
+
+	go runPeriodically(globalContext, time.Hour, "purge deleted accounts", func(ctx context.Context) error {
+		_, err := repository.UserResolvers.PurgeDeletedAccounts(ctx)
+		return err
+	})
+
 	schema, err := graphql.NewSchema(graphql.SchemaConfig{
 		Query:    Query,
 		Mutation: Mutation,
@@ -268,5 +761,5 @@ func main() {
 
 	mux := http.NewServeMux()
 	mux.Handle("/", customHandler(&schema))
-	log.Fatal(http.ListenAndServe(":8080", mux))
+	log.Fatal(http.ListenAndServe(cfg.ListenAddr, mux))
 }
@@ -0,0 +1,93 @@
+package money
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+)
+
+var Type = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Money",
+	Description: "Exact amount with ISO 4217 currency",
+	Fields: graphql.Fields{
+		"amount": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Decimal amount in major units, e.g. 10.99",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				if m, ok := source(params); ok {
+					return m.Decimal(), nil
+				}
+				return nil, nil
+			},
+		},
+		"amount_minor": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Integer amount in minor units, e.g. 1099 for 10.99 USD",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				if m, ok := source(params); ok {
+					return strconv.FormatInt(m.Amount, 10), nil
+				}
+				return nil, nil
+			},
+		},
+		"currency": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+func source(params graphql.ResolveParams) (Money, bool) {
+	switch m := params.Source.(type) {
+	case Money:
+		return m, true
+	case *Money:
+		if m == nil {
+			return Money{}, false
+		}
+		return *m, true
+	}
+	return Money{}, false
+}
+
+var InputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "MoneyInput",
+	Description: "Exactly one of amount and amount_minor is required",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"amount": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Decimal amount in major units, e.g. 10.99",
+		},
+		"amount_minor": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Integer amount in minor units, e.g. 1099",
+		},
+		"currency": &graphql.InputObjectFieldConfig{
+			Type:        graphql.NewNonNull(graphql.String),
+			Description: "ISO 4217 code, e.g. USD",
+		},
+	},
+})
+
+// value of InputType argument
+func FromInput(value interface{}) (Money, error) {
+	input, ok := value.(map[string]interface{})
+	if !ok {
+		return Money{}, fmt.Errorf("amount is required")
+	}
+
+	currency, _ := input["currency"].(string)
+	decimal, hasDecimal := input["amount"].(string)
+	minor, hasMinor := input["amount_minor"].(string)
+
+	switch {
+	case hasDecimal && hasMinor:
+		return Money{}, fmt.Errorf("only one of amount and amount_minor can be set")
+	case hasDecimal:
+		return Parse(decimal, currency)
+	case hasMinor:
+		return ParseMinor(minor, currency)
+	}
+
+	return Money{}, fmt.Errorf("amount or amount_minor is required")
+}
@@ -0,0 +1,33 @@
+package money
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql"
+)
+
+func TestSource(t *testing.T) {
+	var nilMoney *Money
+
+	tests := []struct {
+		name   string
+		source interface{}
+		want   Money
+		wantOk bool
+	}{
+		{name: "value", source: Money{Amount: 1099, Currency: "USD"}, want: Money{Amount: 1099, Currency: "USD"}, wantOk: true},
+		{name: "pointer", source: &Money{Amount: 5, Currency: "JPY"}, want: Money{Amount: 5, Currency: "JPY"}, wantOk: true},
+		{name: "typed nil", source: nilMoney},
+		{name: "nil", source: nil},
+		{name: "other type", source: "10.99"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := source(graphql.ResolveParams{Source: test.source})
+			if got != test.want || ok != test.wantOk {
+				t.Fatalf("got %+v, %v, want %+v, %v", got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Package money keeps amounts as integer minor units with ISO 4217 currency,
+// so values are never rounded by floating point.
+package money
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// number of minor unit digits by ISO 4217
+var exponents = map[string]int{
+	"AUD": 2,
+	"BHD": 3,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"CZK": 2,
+	"DKK": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HKD": 2,
+	"HUF": 2,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"NOK": 2,
+	"NZD": 2,
+	"OMR": 3,
+	"PLN": 2,
+	"RUB": 2,
+	"SEK": 2,
+	"TND": 3,
+	"TRY": 2,
+	"USD": 2,
+	"VND": 0,
+}
+
+const DefaultCurrency = "USD"
+
+type Money struct {
+	// amount in minor units, e.g. cents
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func Exponent(currency string) (int, error) {
+	exponent, ok := exponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("currency %s is not supported", currency)
+	}
+	return exponent, nil
+}
+
+func ValidateCurrency(currency string) error {
+	_, err := Exponent(currency)
+	return err
+}
+
+func New(amount int64, currency string) (Money, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if err := ValidateCurrency(currency); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// parse decimal amount in major units like "10.99", more digits than exponent is an error
+func Parse(value string, currency string) (Money, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	exponent, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	parts := strings.SplitN(value, ".", 2)
+	integer, fraction := parts[0], ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+	}
+
+	if integer == "" || !digits(integer) || (len(parts) == 2 && (fraction == "" || !digits(fraction))) {
+		return Money{}, fmt.Errorf("amount %q is not a decimal number", value)
+	}
+
+	if len(fraction) > exponent {
+		return Money{}, fmt.Errorf("%s amount can have at most %d decimal places", currency, exponent)
+	}
+
+	fraction += strings.Repeat("0", exponent-len(fraction))
+	amount, err := strconv.ParseInt(integer+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q is too large", value)
+	}
+
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// parse amount in minor units like "1099"
+func ParseMinor(value string, currency string) (Money, error) {
+	amount, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q is not an integer", value)
+	}
+	return New(amount, currency)
+}
+
+func digits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// exact amount in major units, e.g. "10.99" for 1099 USD and "1000" for 1000 JPY
+func (m Money) Decimal() string {
+	exponent, ok := exponents[m.Currency]
+	if !ok {
+		exponent = 2
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+	}
+
+	// math.MinInt64 has no positive counterpart
+	text := strconv.FormatUint(uint64(amount), 10)
+	if amount < 0 {
+		text = strconv.FormatUint(uint64(-(amount+1))+1, 10)
+	}
+
+	if exponent == 0 {
+		return sign + text
+	}
+
+	if len(text) <= exponent {
+		text = strings.Repeat("0", exponent-len(text)+1) + text
+	}
+
+	return sign + text[:len(text)-exponent] + "." + text[len(text)-exponent:]
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
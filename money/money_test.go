@@ -0,0 +1,105 @@
+package money
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     Money
+		wantErr  string
+	}{
+		{value: "10.99", currency: "USD", want: Money{Amount: 1099, Currency: "USD"}},
+		{value: "10.9", currency: "USD", want: Money{Amount: 1090, Currency: "USD"}},
+		{value: "10", currency: "usd", want: Money{Amount: 1000, Currency: "USD"}},
+		{value: " 0.01 ", currency: "EUR", want: Money{Amount: 1, Currency: "EUR"}},
+		{value: "-2.50", currency: "EUR", want: Money{Amount: -250, Currency: "EUR"}},
+		{value: "1000", currency: "JPY", want: Money{Amount: 1000, Currency: "JPY"}},
+		{value: "1.5", currency: "JPY", wantErr: "JPY amount can have at most 0 decimal places"},
+		{value: "1.234", currency: "KWD", want: Money{Amount: 1234, Currency: "KWD"}},
+		{value: "1.2345", currency: "KWD", wantErr: "KWD amount can have at most 3 decimal places"},
+		{value: "10.999", currency: "USD", wantErr: "USD amount can have at most 2 decimal places"},
+		{value: "92233720368547758.07", currency: "USD", want: Money{Amount: math.MaxInt64, Currency: "USD"}},
+		{value: "92233720368547758.08", currency: "USD", wantErr: `amount "92233720368547758.08" is too large`},
+		{value: "1e3", currency: "USD", wantErr: `amount "1e3" is not a decimal number`},
+		{value: ".5", currency: "USD", wantErr: `amount ".5" is not a decimal number`},
+		{value: "5.", currency: "USD", wantErr: `amount "5." is not a decimal number`},
+		{value: "+5", currency: "USD", wantErr: `amount "+5" is not a decimal number`},
+		{value: "1,000.00", currency: "USD", wantErr: `amount "1,000.00" is not a decimal number`},
+		{value: "", currency: "USD", wantErr: `amount "" is not a decimal number`},
+		{value: "10", currency: "XXX", wantErr: "currency XXX is not supported"},
+	}
+
+	for _, test := range tests {
+		got, err := Parse(test.value, test.currency)
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("Parse(%q, %q) error = %v, want %q", test.value, test.currency, err, test.wantErr)
+			}
+			continue
+		}
+
+		if err != nil || got != test.want {
+			t.Errorf("Parse(%q, %q) = %+v, %v, want %+v", test.value, test.currency, got, err, test.want)
+		}
+	}
+}
+
+func TestParseMinor(t *testing.T) {
+	got, err := ParseMinor("1099", "usd")
+	if err != nil || got != (Money{Amount: 1099, Currency: "USD"}) {
+		t.Errorf("ParseMinor = %+v, %v", got, err)
+	}
+
+	if _, err := ParseMinor("10.99", "USD"); err == nil {
+		t.Errorf("ParseMinor accepts decimal amount")
+	}
+
+	if _, err := ParseMinor("1099", "XXX"); err == nil {
+		t.Errorf("ParseMinor accepts unsupported currency")
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{money: Money{Amount: 1099, Currency: "USD"}, want: "10.99"},
+		{money: Money{Amount: 5, Currency: "USD"}, want: "0.05"},
+		{money: Money{Amount: 0, Currency: "USD"}, want: "0.00"},
+		{money: Money{Amount: -5, Currency: "USD"}, want: "-0.05"},
+		{money: Money{Amount: -1099, Currency: "EUR"}, want: "-10.99"},
+		{money: Money{Amount: 1000, Currency: "JPY"}, want: "1000"},
+		{money: Money{Amount: -7, Currency: "JPY"}, want: "-7"},
+		{money: Money{Amount: 1234, Currency: "KWD"}, want: "1.234"},
+		{money: Money{Amount: 1, Currency: "KWD"}, want: "0.001"},
+		{money: Money{Amount: math.MaxInt64, Currency: "USD"}, want: "92233720368547758.07"},
+		{money: Money{Amount: math.MinInt64, Currency: "USD"}, want: "-92233720368547758.08"},
+		{money: Money{Amount: math.MinInt64, Currency: "JPY"}, want: "-9223372036854775808"},
+		// unknown currency is shown with two decimals
+		{money: Money{Amount: 1099, Currency: "XXX"}, want: "10.99"},
+	}
+
+	for _, test := range tests {
+		if got := test.money.Decimal(); got != test.want {
+			t.Errorf("%+v.Decimal() = %q, want %q", test.money, got, test.want)
+		}
+	}
+}
+
+func TestParseDecimalRoundTrip(t *testing.T) {
+	for _, currency := range []string{"USD", "JPY", "KWD"} {
+		for _, amount := range []int64{0, 1, -1, 99, 100, 123456789, math.MaxInt64, math.MinInt64 + 1} {
+			money := Money{Amount: amount, Currency: currency}
+
+			parsed, err := Parse(money.Decimal(), currency)
+			if err != nil || parsed != money {
+				t.Errorf("Parse(%q) = %+v, %v, want %+v", money.Decimal(), parsed, err, money)
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package oidc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/oidc"
+	"github.com/Moranilt/go-graphql-location/oidc/oidctest"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v8"
+)
+
+const redirectURL = "http://localhost/oauth/callback"
+
+func newMockProvider(t *testing.T) *oidctest.Provider {
+	t.Helper()
+
+	mock, err := oidctest.NewProvider("client", "secret")
+	if err != nil {
+		t.Fatalf("oidctest.NewProvider: %v", err)
+	}
+	t.Cleanup(mock.Close)
+
+	return mock
+}
+
+func TestRegistryLogin(t *testing.T) {
+	ctx := context.Background()
+	mock := newMockProvider(t)
+	mock.SetUser(oidctest.User{Subject: "42", Email: "jane@example.com", GivenName: "Jane", FamilyName: "Doe"})
+
+	registry, err := oidc.NewRegistry([]oidc.ProviderConfig{mock.Config("mock", redirectURL)}, nil)
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	authURL, state, err := registry.Start(ctx, client, "mock", 7)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	if !strings.HasPrefix(authURL, mock.Issuer()+"/authorize?") {
+		t.Fatalf("authorization url %s is not discovered endpoint", authURL)
+	}
+
+	code, returnedState, err := mock.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	if returnedState != state {
+		t.Fatalf("got state %q, want %q", returnedState, state)
+	}
+
+	if _, _, err := registry.Finish(ctx, client, "other", code, state); err == nil {
+		t.Fatalf("session is finished by another provider")
+	}
+
+	// state is deleted by the failed attempt as well, start again
+	authURL, state, err = registry.Start(ctx, client, "mock", 7)
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	code, _, err = mock.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	session, claims, err := registry.Finish(ctx, client, "mock", code, state)
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+
+	if session.LinkUserId != 7 || session.Provider != "mock" {
+		t.Fatalf("unexpected session %+v", session)
+	}
+
+	want := oidc.Claims{
+		Subject:       "42",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		GivenName:     "Jane",
+		FamilyName:    "Doe",
+		Nonce:         session.Nonce,
+	}
+	if *claims != want {
+		t.Fatalf("got claims %+v, want %+v", *claims, want)
+	}
+
+	if _, _, err := registry.Finish(ctx, client, "mock", code, state); err == nil {
+		t.Fatalf("state is accepted twice")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	ctx := context.Background()
+	verifier := "verifier-verifier-verifier-verifier-verifier"
+
+	tests := []struct {
+		name         string
+		clientSecret string
+		verifier     string
+		nonce        string
+		wantErr      string
+	}{
+		{name: "valid", clientSecret: "secret", verifier: verifier, nonce: "nonce"},
+		{name: "pkce verifier mismatch", clientSecret: "secret", verifier: "another-verifier", nonce: "nonce", wantErr: "pkce verification failed"},
+		{name: "nonce mismatch", clientSecret: "secret", verifier: verifier, nonce: "another", wantErr: "id token nonce mismatch"},
+		{name: "wrong client secret", clientSecret: "wrong", verifier: verifier, nonce: "nonce", wantErr: "invalid_client"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock := newMockProvider(t)
+
+			config := mock.Config("mock", redirectURL)
+			config.ClientSecret = test.clientSecret
+			provider := oidc.NewProvider(config, nil)
+
+			authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", oidc.CodeChallenge(verifier))
+			if err != nil {
+				t.Fatalf("AuthCodeURL: %v", err)
+			}
+
+			code, _, err := mock.Authorize(authURL)
+			if err != nil {
+				t.Fatalf("Authorize: %v", err)
+			}
+
+			claims, err := provider.Exchange(ctx, code, test.verifier, test.nonce)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+
+			if claims.Subject != "oidctest-user" {
+				t.Fatalf("got subject %q", claims.Subject)
+			}
+
+			if _, err := provider.Exchange(ctx, code, test.verifier, test.nonce); err == nil {
+				t.Fatalf("authorization code is exchanged twice")
+			}
+		})
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	mock := newMockProvider(t)
+	provider := oidc.NewProvider(mock.Config("mock", redirectURL), nil)
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   mock.Issuer(),
+			"sub":   "42",
+			"aud":   "client",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": "nonce",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		change  func(claims jwt.MapClaims)
+		wantErr string
+	}{
+		{name: "valid", change: func(claims jwt.MapClaims) {}},
+		{name: "audience list", change: func(claims jwt.MapClaims) { claims["aud"] = []string{"other", "client"} }},
+		{name: "another issuer", change: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" }, wantErr: "issuer mismatch"},
+		{name: "another audience", change: func(claims jwt.MapClaims) { claims["aud"] = "other" }, wantErr: "audience mismatch"},
+		{name: "no audience", change: func(claims jwt.MapClaims) { delete(claims, "aud") }, wantErr: "audience mismatch"},
+		{name: "expired", change: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }, wantErr: "expired"},
+		{name: "no subject", change: func(claims jwt.MapClaims) { delete(claims, "sub") }, wantErr: "no subject"},
+		{name: "another nonce", change: func(claims jwt.MapClaims) { claims["nonce"] = "replayed" }, wantErr: "nonce mismatch"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := valid()
+			test.change(claims)
+
+			token, err := mock.IDToken(claims)
+			if err != nil {
+				t.Fatalf("IDToken: %v", err)
+			}
+
+			_, err = provider.VerifyIDToken(ctx, token, "nonce")
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("got error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+
+	t.Run("foreign key", func(t *testing.T) {
+		other := newMockProvider(t)
+		claims := valid()
+
+		token, err := other.IDToken(claims)
+		if err != nil {
+			t.Fatalf("IDToken: %v", err)
+		}
+
+		if _, err := provider.VerifyIDToken(ctx, token, "nonce"); err == nil {
+			t.Fatalf("token signed by another key is accepted")
+		}
+	})
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	mock := newMockProvider(t)
+
+	config := mock.Config("mock", redirectURL)
+	config.Issuer += "/"
+	provider := oidc.NewProvider(config, nil)
+
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Fatalf("got error %v, want issuer mismatch", err)
+	}
+}
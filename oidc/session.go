@@ -0,0 +1,160 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const stateTTL = time.Minute * 10
+
+// data stored in redis between redirect to provider and callback
+type AuthSession struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	// not empty when flow was started for linking provider to existing user
+	LinkUserId uint64 `json:"link_user_id,omitempty"`
+}
+
+type Registry struct {
+	providers map[string]*Provider
+}
+
+func NewRegistry(configs []ProviderConfig, httpClient *http.Client) (*Registry, error) {
+	registry := &Registry{providers: map[string]*Provider{}}
+
+	for _, config := range configs {
+		if config.Name == "" || config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+			return nil, fmt.Errorf("oidc provider requires name, issuer, client_id and redirect_url")
+		}
+
+		if _, ok := registry.providers[config.Name]; ok {
+			return nil, fmt.Errorf("duplicated oidc provider: %s", config.Name)
+		}
+
+		registry.providers[config.Name] = NewProvider(config, httpClient)
+	}
+
+	return registry, nil
+}
+
+func (r *Registry) Get(name string) (*Provider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown identity provider: %s", name)
+	}
+
+	return provider, nil
+}
+
+func (r *Registry) Names() []string {
+	names := []string{}
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// create state, nonce and PKCE verifier, store them in redis and return url of provider login page
+func (r *Registry) Start(ctx context.Context, client *redis.Client, providerName string, linkUserId uint64) (string, string, error) {
+	provider, err := r.Get(providerName)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	session := AuthSession{Provider: providerName, LinkUserId: linkUserId}
+
+	session.Nonce, err = randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	session.CodeVerifier, err = randomString(48)
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, session.Nonce, CodeChallenge(session.CodeVerifier))
+	if err != nil {
+		return "", "", err
+	}
+
+	value, err := json.Marshal(session)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := client.Set(ctx, stateKey(state), value, stateTTL).Err(); err != nil {
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// load and delete session by state, exchange code and verify ID token
+func (r *Registry) Finish(ctx context.Context, client *redis.Client, providerName string, code string, state string) (*AuthSession, *Claims, error) {
+	value, err := client.GetDel(ctx, stateKey(state)).Result()
+	if err == redis.Nil {
+		return nil, nil, fmt.Errorf("login session is expired or invalid")
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var session AuthSession
+	if err := json.Unmarshal([]byte(value), &session); err != nil {
+		return nil, nil, err
+	}
+
+	if session.Provider != providerName {
+		return nil, nil, fmt.Errorf("login session is expired or invalid")
+	}
+
+	provider, err := r.Get(providerName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims, err := provider.Exchange(ctx, code, session.CodeVerifier, session.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &session, claims, nil
+}
+
+// S256 code challenge for PKCE verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func stateKey(state string) string {
+	return "oidc_state:" + state
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
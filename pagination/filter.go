@@ -0,0 +1,93 @@
+package pagination
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter collects WHERE conditions with bind parameters.
+// Conditions use ? placeholders which are numbered as $1, $2... in order of adding.
+type Filter struct {
+	conditions []string
+	Args       []interface{}
+}
+
+func (f *Filter) Add(condition string, args ...interface{}) {
+	var builder strings.Builder
+	argIndex := 0
+
+	for _, r := range condition {
+		if r == '?' && argIndex < len(args) {
+			f.Args = append(f.Args, args[argIndex])
+			builder.WriteString("$" + strconv.Itoa(len(f.Args)))
+			argIndex++
+			continue
+		}
+		builder.WriteRune(r)
+	}
+
+	f.conditions = append(f.conditions, "("+builder.String()+")")
+}
+
+// add parameter without condition and return its placeholder, e.g. for LIMIT
+func (f *Filter) Arg(value interface{}) string {
+	f.Args = append(f.Args, value)
+	return "$" + strconv.Itoa(len(f.Args))
+}
+
+// WHERE clause or empty string when there are no conditions
+func (f *Filter) Where() string {
+	if len(f.conditions) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(f.conditions, " AND ")
+}
+
+// escape % and _ for LIKE pattern and wrap value with %
+func Contains(value string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value) + "%"
+}
+
+// conditions for column from values[fromName] and values[toName], see ParseDate.
+// Whole day is included when only date is given for upper bound.
+func (f *Filter) AddDateRange(column string, values map[string]interface{}, fromName string, toName string) error {
+	if from, ok := values[fromName].(string); ok && from != "" {
+		date, _, err := ParseDate(from)
+		if err != nil {
+			return fmt.Errorf("%s: %s", fromName, err)
+		}
+		f.Add(column+" >= ?", date)
+	}
+
+	if to, ok := values[toName].(string); ok && to != "" {
+		date, dateOnly, err := ParseDate(to)
+		if err != nil {
+			return fmt.Errorf("%s: %s", toName, err)
+		}
+
+		if dateOnly {
+			f.Add(column+" < ?", date.AddDate(0, 0, 1))
+		} else {
+			f.Add(column+" <= ?", date)
+		}
+	}
+
+	return nil
+}
+
+// accepts RFC3339 timestamp or date, date is converted to the start of the day in UTC
+func ParseDate(value string) (time.Time, bool, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, false, nil
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("expected date in format YYYY-MM-DD or RFC3339, got %s", strconv.Quote(value))
+	}
+
+	return date, true, nil
+}
@@ -0,0 +1,184 @@
+// Package pagination implements Relay-style cursor connections with keyset pagination.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	DefaultFirst = 20
+	MaxFirst     = 100
+)
+
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor"`
+	EndCursor       *string `json:"endCursor"`
+}
+
+type Edge struct {
+	Cursor string      `json:"cursor"`
+	Node   interface{} `json:"node"`
+}
+
+type Connection struct {
+	Edges      []Edge   `json:"edges"`
+	PageInfo   PageInfo `json:"pageInfo"`
+	TotalCount int      `json:"totalCount"`
+}
+
+// position of the row in ordered list: value of sort column and id for ties
+type Cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Id    int64  `json:"i"`
+}
+
+func EncodeCursor(cursor Cursor) string {
+	value, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+// decode cursor and check it was created for the same sorting
+func DecodeCursor(encoded string, sort string) (*Cursor, error) {
+	value, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(value, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("cursor was created for another sorting")
+	}
+
+	return &cursor, nil
+}
+
+// read "first" argument and check limits
+func First(args map[string]interface{}) (int, error) {
+	first := DefaultFirst
+	if val, ok := args["first"].(int); ok {
+		first = val
+	}
+
+	if first < 0 || first > MaxFirst {
+		return 0, fmt.Errorf("first must be between 0 and %d", MaxFirst)
+	}
+
+	return first, nil
+}
+
+// build connection from rows fetched with limit first+1
+func NewConnection(nodes []interface{}, cursors []string, first int, hasPrevious bool, totalCount int) *Connection {
+	connection := &Connection{
+		Edges:      []Edge{},
+		TotalCount: totalCount,
+		PageInfo:   PageInfo{HasPreviousPage: hasPrevious},
+	}
+
+	if len(nodes) > first {
+		nodes = nodes[:first]
+		connection.PageInfo.HasNextPage = true
+	}
+
+	for i, node := range nodes {
+		connection.Edges = append(connection.Edges, Edge{Cursor: cursors[i], Node: node})
+	}
+
+	if len(connection.Edges) > 0 {
+		connection.PageInfo.StartCursor = &connection.Edges[0].Cursor
+		connection.PageInfo.EndCursor = &connection.Edges[len(connection.Edges)-1].Cursor
+	}
+
+	return connection
+}
+
+var PageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+		},
+		"hasPreviousPage": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+		},
+		"startCursor": &graphql.Field{
+			Type: graphql.String,
+		},
+		"endCursor": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var SortDirectionType = graphql.NewEnum(graphql.EnumConfig{
+	Name: "SortDirection",
+	Values: graphql.EnumValueConfigMap{
+		"ASC": &graphql.EnumValueConfig{
+			Value: "ASC",
+		},
+		"DESC": &graphql.EnumValueConfig{
+			Value: "DESC",
+		},
+	},
+})
+
+// connection type with edges of nodeType, named <name>Connection and <name>Edge
+func ConnectionType(name string, nodeType graphql.Output) *graphql.Object {
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Edge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+			},
+			"node": &graphql.Field{
+				Type: nodeType,
+			},
+		},
+	})
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name + "Connection",
+		Fields: graphql.Fields{
+			"edges": &graphql.Field{
+				Type: graphql.NewList(edgeType),
+			},
+			"pageInfo": &graphql.Field{
+				Type: graphql.NewNonNull(PageInfoType),
+			},
+			"totalCount": &graphql.Field{
+				Type: graphql.Int,
+			},
+		},
+	})
+}
+
+// first and after arguments merged with extra arguments of the field
+func Args(extra graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	args := graphql.FieldConfigArgument{
+		"first": &graphql.ArgumentConfig{
+			Type:         graphql.Int,
+			DefaultValue: DefaultFirst,
+			Description:  fmt.Sprintf("Page size, %d at most", MaxFirst),
+		},
+		"after": &graphql.ArgumentConfig{
+			Type:        graphql.String,
+			Description: "endCursor of previous page",
+		},
+	}
+
+	for name, arg := range extra {
+		args[name] = arg
+	}
+
+	return args
+}
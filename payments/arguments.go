@@ -1,19 +1,164 @@
 package payments
 
-import "github.com/graphql-go/graphql"
+import (
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/Moranilt/go-graphql-location/pagination"
+	"github.com/graphql-go/graphql"
+)
 
 type Arguments struct {
-	Create graphql.FieldConfigArgument
+	Create     graphql.FieldConfigArgument
+	Transition graphql.FieldConfigArgument
+	Confirm    graphql.FieldConfigArgument
+	Cancel     graphql.FieldConfigArgument
+	Refund     graphql.FieldConfigArgument
+	Payments   graphql.FieldConfigArgument
+	Stats      graphql.FieldConfigArgument
 }
 
 func GetArguments() Arguments {
 	return Arguments{
-		Create: createArgs,
+		Create:     createArgs,
+		Transition: transitionArgs,
+		Confirm:    confirmArgs,
+		Cancel:     cancelArgs,
+		Refund:     refundArgs,
+		Payments:   paymentsArgs,
+		Stats:      statsArgs,
 	}
 }
 
 var createArgs = graphql.FieldConfigArgument{
 	"amount": &graphql.ArgumentConfig{
-		Type: graphql.NewNonNull(graphql.Float),
+		Type: graphql.NewNonNull(money.InputType),
+	},
+}
+
+var transitionArgs = graphql.FieldConfigArgument{
+	"id": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.Int),
+	},
+	"status": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(statusEnum),
+	},
+	"note": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "Reason of change, stored in event",
+	},
+}
+
+var confirmArgs = graphql.FieldConfigArgument{
+	"id": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.Int),
+	},
+	"card": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "Card number, mock provider declines 4000000000000002 and asks 3-D Secure for 4000000000003220",
+	},
+}
+
+var cancelArgs = graphql.FieldConfigArgument{
+	"payment_id": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.Int),
+	},
+}
+
+var refundArgs = graphql.FieldConfigArgument{
+	"payment_id": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.Int),
+	},
+	"amount": &graphql.ArgumentConfig{
+		Type:        money.InputType,
+		Description: "Rest of captured amount when empty, currency must match payment",
+	},
+	"reason": &graphql.ArgumentConfig{
+		Type: graphql.String,
+	},
+}
+
+var paymentsFilterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "PaymentsFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"status": &graphql.InputObjectFieldConfig{
+			Type:        graphql.NewList(graphql.NewNonNull(statusEnum)),
+			Description: "Any of statuses",
+		},
+		"currency": &graphql.InputObjectFieldConfig{
+			Type: graphql.String,
+		},
+		"created_from": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Created at or after, YYYY-MM-DD or RFC3339",
+		},
+		"created_to": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Created at or before, YYYY-MM-DD or RFC3339",
+		},
+		"amount_from": &graphql.InputObjectFieldConfig{
+			Type:        money.InputType,
+			Description: "Minimal amount, only payments in its currency match",
+		},
+		"amount_to": &graphql.InputObjectFieldConfig{
+			Type:        money.InputType,
+			Description: "Maximal amount, only payments in its currency match",
+		},
+	},
+})
+
+var paymentSortFieldEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "PaymentSortField",
+	Values: graphql.EnumValueConfigMap{
+		"CREATED_AT":  &graphql.EnumValueConfig{Value: "CREATED_AT"},
+		"CAPTURED_AT": &graphql.EnumValueConfig{Value: "CAPTURED_AT"},
+		"AMOUNT":      &graphql.EnumValueConfig{Value: "AMOUNT"},
+	},
+})
+
+var paymentsSortInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "PaymentsSort",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"field": &graphql.InputObjectFieldConfig{
+			Type:         paymentSortFieldEnum,
+			DefaultValue: "CREATED_AT",
+		},
+		"direction": &graphql.InputObjectFieldConfig{
+			Type:         pagination.SortDirectionType,
+			DefaultValue: "DESC",
+		},
+	},
+})
+
+var userIdArg = &graphql.ArgumentConfig{
+	Type:        graphql.Int,
+	Description: "Payments of another user, only for admins",
+}
+
+var paymentsArgs = pagination.Args(graphql.FieldConfigArgument{
+	"user_id": userIdArg,
+	"filter": &graphql.ArgumentConfig{
+		Type: paymentsFilterInput,
+	},
+	"sort": &graphql.ArgumentConfig{
+		Type: paymentsSortInput,
+	},
+})
+
+var statsIntervalEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "PaymentStatsInterval",
+	Values: graphql.EnumValueConfigMap{
+		"DAY":   &graphql.EnumValueConfig{Value: "DAY"},
+		"WEEK":  &graphql.EnumValueConfig{Value: "WEEK"},
+		"MONTH": &graphql.EnumValueConfig{Value: "MONTH"},
+	},
+})
+
+var statsArgs = graphql.FieldConfigArgument{
+	"user_id": userIdArg,
+	"interval": &graphql.ArgumentConfig{
+		Type:         statsIntervalEnum,
+		DefaultValue: "DAY",
+	},
+	"filter": &graphql.ArgumentConfig{
+		Type: paymentsFilterInput,
 	},
 }
@@ -0,0 +1,55 @@
+package payments
+
+import (
+	"fmt"
+
+	"github.com/Moranilt/go-graphql-location/ledger"
+	"github.com/jmoiron/sqlx"
+)
+
+// account of payer, captured money is stored in wallet of user
+func payerAccount(payment *Payment) ledger.Account {
+	if payment.UserId == nil {
+		return ledger.Suspense(payment.Currency)
+	}
+	return ledger.UserWallet(*payment.UserId, payment.Currency)
+}
+
+func providerAccount(payment *Payment) ledger.Account {
+	name := "none"
+	if payment.Provider != nil {
+		name = *payment.Provider
+	}
+	return ledger.ProviderFunds(name, payment.Currency)
+}
+
+// top-up of wallet by captured payment
+func postCapture(tx *sqlx.Tx, payment *Payment) error {
+	return ledger.Transfer(tx,
+		fmt.Sprintf("payment:%d:capture", payment.Id),
+		fmt.Sprintf("Payment %d captured", payment.Id),
+		providerAccount(payment), payerAccount(payment), payment.Amount,
+	)
+}
+
+// money leaves wallet when it is returned to payer. Wallet must have the amount, so spent
+// top-up can not be returned. Refund made in provider already is recorded with overdraft,
+// negative balance is debt of user then.
+func postRefund(tx *sqlx.Tx, payment *Payment, refundId uint64, amount int64, overdraft bool) error {
+	reference := fmt.Sprintf("refund:%d", refundId)
+	description := fmt.Sprintf("Refund %d of payment %d", refundId, payment.Id)
+
+	if payment.UserId == nil || overdraft {
+		return ledger.Transfer(tx, reference, description, payerAccount(payment), providerAccount(payment), amount)
+	}
+
+	return ledger.Charge(tx, reference, description, *payment.UserId, providerAccount(payment), amount)
+}
+
+// lock wallet of payer and check it before money is returned by provider
+func checkRefundFunds(tx *sqlx.Tx, payment *Payment, amount int64) error {
+	if payment.UserId == nil {
+		return nil
+	}
+	return ledger.CheckFunds(tx, *payment.UserId, payment.Currency, amount)
+}
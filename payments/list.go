@@ -0,0 +1,165 @@
+package payments
+
+import (
+	"fmt"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/Moranilt/go-graphql-location/pagination"
+	"github.com/graphql-go/graphql"
+	"github.com/lib/pq"
+)
+
+// whitelist of sort fields, values are SQL expressions
+var paymentSortColumns = map[string]string{
+	"CREATED_AT":  "COALESCE(payments.created_at, 'epoch'::timestamp)",
+	"CAPTURED_AT": "COALESCE(payments.captured_at, 'epoch'::timestamp)",
+	"AMOUNT":      "payments.amount",
+}
+
+type paymentRow struct {
+	Payment
+	SortValue string `db:"sort_value"`
+}
+
+// user_id argument for admins, current user otherwise
+func (r *Resolvers) targetUserId(params graphql.ResolveParams) (uint64, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return 0, err
+	}
+
+	target, ok := params.Args["user_id"].(int)
+	if !ok || uint64(target) == userId {
+		return userId, nil
+	}
+
+	if err := authorization.CheckRole(r.pgsql, userId, authorization.RoleAdmin); err != nil {
+		return 0, err
+	}
+
+	return uint64(target), nil
+}
+
+func (r *Resolvers) Payments(params graphql.ResolveParams) (*pagination.Connection, error) {
+	userId, err := r.targetUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	first, err := pagination.First(params.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	sortField, direction := "CREATED_AT", "DESC"
+	if sort, ok := params.Args["sort"].(map[string]interface{}); ok {
+		if val, ok := sort["field"].(string); ok {
+			sortField = val
+		}
+		if val, ok := sort["direction"].(string); ok {
+			direction = val
+		}
+	}
+
+	sortColumn, ok := paymentSortColumns[sortField]
+	if !ok || (direction != "ASC" && direction != "DESC") {
+		return nil, fmt.Errorf("unsupported sorting")
+	}
+
+	filter := &pagination.Filter{}
+	filter.Add("payments.user_id = ?", userId)
+	if values, ok := params.Args["filter"].(map[string]interface{}); ok {
+		if err := applyPaymentsFilter(filter, values); err != nil {
+			return nil, err
+		}
+	}
+
+	var totalCount int
+	err = r.pgsql.Get(&totalCount, "SELECT COUNT(*) FROM payments"+filter.Where(), filter.Args...)
+	if err != nil {
+		return nil, err
+	}
+
+	sortKey := sortField + ":" + direction
+	after, _ := params.Args["after"].(string)
+
+	if after != "" {
+		cursor, err := pagination.DecodeCursor(after, sortKey)
+		if err != nil {
+			return nil, err
+		}
+
+		operator := ">"
+		if direction == "DESC" {
+			operator = "<"
+		}
+		filter.Add(fmt.Sprintf("(%s, payments.id) %s (?, ?)", sortColumn, operator), cursor.Value, cursor.Id)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT payments.*, (%s)::text AS sort_value FROM payments%s ORDER BY %s %s, payments.id %s LIMIT %s",
+		sortColumn, filter.Where(), sortColumn, direction, direction, filter.Arg(first+1),
+	)
+
+	var rows []paymentRow
+	if err := r.pgsql.Select(&rows, query, filter.Args...); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]interface{}, len(rows))
+	cursors := make([]string, len(rows))
+	for i := range rows {
+		nodes[i] = &rows[i].Payment
+		cursors[i] = pagination.EncodeCursor(pagination.Cursor{
+			Sort:  sortKey,
+			Value: rows[i].SortValue,
+			Id:    int64(rows[i].Id),
+		})
+	}
+
+	return pagination.NewConnection(nodes, cursors, first, after != "", totalCount), nil
+}
+
+func applyPaymentsFilter(filter *pagination.Filter, values map[string]interface{}) error {
+	if statuses, ok := values["status"].([]interface{}); ok && len(statuses) > 0 {
+		list := make([]string, 0, len(statuses))
+		for _, status := range statuses {
+			if value, ok := status.(string); ok {
+				list = append(list, value)
+			}
+		}
+		filter.Add("payments.status = ANY(?)", pq.Array(list))
+	}
+
+	if currency, ok := values["currency"].(string); ok && currency != "" {
+		normalized, err := money.New(0, currency)
+		if err != nil {
+			return err
+		}
+		filter.Add("payments.currency = ?", normalized.Currency)
+	}
+
+	if err := filter.AddDateRange("payments.created_at", values, "created_from", "created_to"); err != nil {
+		return err
+	}
+
+	// amounts are comparable only in the same currency
+	if value, ok := values["amount_from"]; ok && value != nil {
+		amount, err := money.FromInput(value)
+		if err != nil {
+			return fmt.Errorf("amount_from: %s", err)
+		}
+		filter.Add("payments.currency = ? AND payments.amount >= ?", amount.Currency, amount.Amount)
+	}
+
+	if value, ok := values["amount_to"]; ok && value != nil {
+		amount, err := money.FromInput(value)
+		if err != nil {
+			return fmt.Errorf("amount_to: %s", err)
+		}
+		filter.Add("payments.currency = ? AND payments.amount <= ?", amount.Currency, amount.Amount)
+	}
+
+	return nil
+}
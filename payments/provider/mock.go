@@ -0,0 +1,193 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Cards recognized by mock provider, any other card number is approved.
+const (
+	CardSuccess  = "4242424242424242"
+	CardDecline  = "4000000000000002"
+	Card3DS      = "4000000000003220"
+	CardTimeout  = "4000000000000119"
+	CardNoFunds  = "4000000000009995"
+	mockIdPrefix = "mock_"
+)
+
+// Magic amounts work with any card, only minor units are checked:
+// x.02 is declined, x.20 requires 3-D Secure, x.19 times out.
+const (
+	AmountDecline = 2
+	Amount3DS     = 20
+	AmountTimeout = 19
+)
+
+// Mock is deterministic in-process provider for development and tests.
+// Intent ids are sequential, state is kept in memory.
+type Mock struct {
+	mutex   sync.Mutex
+	counter int
+	intents map[string]*Intent
+}
+
+func NewMock() *Mock {
+	return &Mock{intents: map[string]*Intent{}}
+}
+
+func (m *Mock) Name() string {
+	return "mock"
+}
+
+func (m *Mock) nextId(kind string) string {
+	m.counter++
+	return fmt.Sprintf("%s%s_%d", mockIdPrefix, kind, m.counter)
+}
+
+func (m *Mock) intent(intentId string) (*Intent, error) {
+	intent, ok := m.intents[intentId]
+	if !ok {
+		return nil, fmt.Errorf("intent %s not found", intentId)
+	}
+	return intent, nil
+}
+
+// wait for deadline of call like unresponsive gateway
+func timeout(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return ErrTimeout
+	}
+	<-ctx.Done()
+	return ErrTimeout
+}
+
+func (m *Mock) CreateIntent(ctx context.Context, amount int64, currency string, reference string) (*Intent, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	intent := &Intent{
+		Id:       m.nextId("pi"),
+		Status:   IntentRequiresConfirmation,
+		Amount:   amount,
+		Currency: currency,
+	}
+	m.intents[intent.Id] = intent
+
+	result := *intent
+	return &result, nil
+}
+
+func (m *Mock) Confirm(ctx context.Context, intentId string, card string) (*Intent, error) {
+	m.mutex.Lock()
+	intent, err := m.intent(intentId)
+	if err != nil {
+		m.mutex.Unlock()
+		return nil, err
+	}
+
+	cents := intent.Amount % 100
+	if card == CardTimeout || cents == AmountTimeout {
+		m.mutex.Unlock()
+		return nil, timeout(ctx)
+	}
+	defer m.mutex.Unlock()
+
+	switch intent.Status {
+	case IntentRequiresConfirmation:
+		switch {
+		case card == CardDecline || cents == AmountDecline:
+			intent.Status = IntentFailed
+			intent.FailureCode = "card_declined"
+			intent.FailureMessage = "Card was declined"
+		case card == CardNoFunds:
+			intent.Status = IntentFailed
+			intent.FailureCode = "insufficient_funds"
+			intent.FailureMessage = "Card has insufficient funds"
+		case card == Card3DS || cents == Amount3DS:
+			intent.Status = IntentRequiresAction
+			intent.NextActionURL = "https://mock.invalid/3ds/" + intent.Id
+		default:
+			intent.Status = IntentAuthorized
+		}
+	case IntentRequiresAction:
+		// second confirmation means customer passed the challenge
+		intent.Status = IntentAuthorized
+		intent.NextActionURL = ""
+	default:
+		return nil, fmt.Errorf("intent in status %s can not be confirmed", intent.Status)
+	}
+
+	result := *intent
+	return &result, nil
+}
+
+func (m *Mock) Capture(ctx context.Context, intentId string, amount int64) (*Intent, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	intent, err := m.intent(intentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if intent.Status != IntentAuthorized {
+		return nil, fmt.Errorf("intent in status %s can not be captured", intent.Status)
+	}
+
+	if amount <= 0 || amount > intent.Amount {
+		return nil, fmt.Errorf("capture amount must be between 1 and %d", intent.Amount)
+	}
+
+	intent.Status = IntentCaptured
+	intent.Captured = amount
+
+	result := *intent
+	return &result, nil
+}
+
+func (m *Mock) Cancel(ctx context.Context, intentId string) (*Intent, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	intent, err := m.intent(intentId)
+	if err != nil {
+		return nil, err
+	}
+
+	switch intent.Status {
+	case IntentRequiresConfirmation, IntentRequiresAction, IntentAuthorized:
+		intent.Status = IntentCancelled
+	default:
+		return nil, fmt.Errorf("intent in status %s can not be cancelled", intent.Status)
+	}
+
+	result := *intent
+	return &result, nil
+}
+
+func (m *Mock) Refund(ctx context.Context, intentId string, amount int64) (*Refund, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	intent, err := m.intent(intentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if intent.Status != IntentCaptured {
+		return nil, fmt.Errorf("intent in status %s can not be refunded", intent.Status)
+	}
+
+	if amount <= 0 || intent.Refunded+amount > intent.Captured {
+		return nil, fmt.Errorf("refund amount must be between 1 and %d", intent.Captured-intent.Refunded)
+	}
+
+	intent.Refunded += amount
+
+	return &Refund{Id: m.nextId("re"), IntentId: intent.Id, Amount: amount}, nil
+}
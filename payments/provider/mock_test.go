@@ -0,0 +1,188 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMockConfirm(t *testing.T) {
+	tests := []struct {
+		name        string
+		card        string
+		amount      int64
+		confirms    int
+		wantStatus  string
+		wantFailure string
+		wantErr     string
+	}{
+		{name: "success", card: CardSuccess, amount: 1000, confirms: 1, wantStatus: IntentAuthorized},
+		{name: "any other card", card: "5555555555554444", amount: 1000, confirms: 1, wantStatus: IntentAuthorized},
+		{name: "declined card", card: CardDecline, amount: 1000, confirms: 1, wantStatus: IntentFailed, wantFailure: "card_declined"},
+		{name: "declined amount", card: CardSuccess, amount: 1000 + AmountDecline, confirms: 1, wantStatus: IntentFailed, wantFailure: "card_declined"},
+		{name: "no funds", card: CardNoFunds, amount: 1000, confirms: 1, wantStatus: IntentFailed, wantFailure: "insufficient_funds"},
+		{name: "3-D Secure card", card: Card3DS, amount: 1000, confirms: 1, wantStatus: IntentRequiresAction},
+		{name: "3-D Secure amount", card: CardSuccess, amount: 1000 + Amount3DS, confirms: 1, wantStatus: IntentRequiresAction},
+		{name: "3-D Secure passed", card: Card3DS, amount: 1000, confirms: 2, wantStatus: IntentAuthorized},
+		{name: "confirmed twice", card: CardSuccess, amount: 1000, confirms: 2, wantErr: "intent in status authorized can not be confirmed"},
+		{name: "confirmed after decline", card: CardDecline, amount: 1000, confirms: 2, wantErr: "intent in status failed can not be confirmed"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			mock := NewMock()
+
+			intent, err := mock.CreateIntent(ctx, test.amount, "USD", "payment-1")
+			if err != nil {
+				t.Fatalf("CreateIntent: %v", err)
+			}
+
+			for i := 0; i < test.confirms; i++ {
+				intent, err = mock.Confirm(ctx, intent.Id, test.card)
+				if err != nil {
+					break
+				}
+			}
+
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("got error %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Confirm: %v", err)
+			}
+
+			if intent.Status != test.wantStatus || intent.FailureCode != test.wantFailure {
+				t.Fatalf("got status %s and failure %q, want %s and %q", intent.Status, intent.FailureCode, test.wantStatus, test.wantFailure)
+			}
+
+			if (intent.Status == IntentRequiresAction) != (intent.NextActionURL != "") {
+				t.Fatalf("got next action url %q in status %s", intent.NextActionURL, intent.Status)
+			}
+		})
+	}
+}
+
+func TestMockConfirmTimeout(t *testing.T) {
+	tests := []struct {
+		name   string
+		card   string
+		amount int64
+	}{
+		{name: "card", card: CardTimeout, amount: 1000},
+		{name: "amount", card: CardSuccess, amount: 1000 + AmountTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock := NewMock()
+			intent, err := mock.CreateIntent(context.Background(), test.amount, "USD", "payment-1")
+			if err != nil {
+				t.Fatalf("CreateIntent: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			started := time.Now()
+			if _, err := mock.Confirm(ctx, intent.Id, test.card); err != ErrTimeout {
+				t.Fatalf("got error %v, want timeout", err)
+			}
+
+			if time.Since(started) < 20*time.Millisecond {
+				t.Fatalf("confirmation returned before deadline")
+			}
+
+			// intent is not locked by call which timed out
+			if _, err := mock.Cancel(context.Background(), intent.Id); err != nil {
+				t.Fatalf("Cancel: %v", err)
+			}
+		})
+	}
+}
+
+func TestMockCaptureAndRefund(t *testing.T) {
+	tests := []struct {
+		name    string
+		capture int64
+		refunds []int64
+		wantErr string
+	}{
+		{name: "full capture and refund", capture: 1000, refunds: []int64{1000}},
+		{name: "partial capture", capture: 600, refunds: []int64{200, 400}},
+		{name: "capture above amount", capture: 1001, wantErr: "capture amount must be between 1 and 1000"},
+		{name: "zero capture", capture: 0, wantErr: "capture amount must be between 1 and 1000"},
+		{name: "refund above captured", capture: 600, refunds: []int64{601}, wantErr: "refund amount must be between 1 and 600"},
+		{name: "refunds above captured", capture: 600, refunds: []int64{400, 201}, wantErr: "refund amount must be between 1 and 200"},
+		{name: "zero refund", capture: 600, refunds: []int64{0}, wantErr: "refund amount must be between 1 and 600"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			mock := NewMock()
+
+			intent, err := mock.CreateIntent(ctx, 1000, "USD", "payment-1")
+			if err != nil {
+				t.Fatalf("CreateIntent: %v", err)
+			}
+
+			if _, err := mock.Confirm(ctx, intent.Id, CardSuccess); err != nil {
+				t.Fatalf("Confirm: %v", err)
+			}
+
+			_, err = mock.Capture(ctx, intent.Id, test.capture)
+			for _, amount := range test.refunds {
+				if err != nil {
+					break
+				}
+				_, err = mock.Refund(ctx, intent.Id, amount)
+			}
+
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("got error %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+		})
+	}
+}
+
+func TestMockStatusChecks(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMock()
+
+	intent, err := mock.CreateIntent(ctx, 1000, "USD", "payment-1")
+	if err != nil {
+		t.Fatalf("CreateIntent: %v", err)
+	}
+
+	if _, err := mock.Capture(ctx, intent.Id, 1000); err == nil {
+		t.Fatalf("intent is captured without confirmation")
+	}
+
+	if _, err := mock.Refund(ctx, intent.Id, 1000); err == nil {
+		t.Fatalf("intent is refunded without capture")
+	}
+
+	if _, err := mock.Cancel(ctx, intent.Id); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+
+	if _, err := mock.Confirm(ctx, intent.Id, CardSuccess); err == nil {
+		t.Fatalf("cancelled intent is confirmed")
+	}
+
+	if _, err := mock.Confirm(ctx, "mock_pi_999", CardSuccess); err == nil || err.Error() != "intent mock_pi_999 not found" {
+		t.Fatalf("got error %v for unknown intent", err)
+	}
+}
@@ -0,0 +1,110 @@
+// Package provider moves money through external payment gateways.
+// Gateway is selected by config, "mock" runs in process without network.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// statuses of payment intent on provider side
+const (
+	IntentRequiresConfirmation = "requires_confirmation"
+	// customer has to pass 3-D Secure challenge by NextActionURL and confirm again
+	IntentRequiresAction = "requires_action"
+	// money is reserved and can be captured or cancelled
+	IntentAuthorized = "authorized"
+	IntentCaptured   = "captured"
+	IntentCancelled  = "cancelled"
+	IntentFailed     = "failed"
+)
+
+// provider did not answer in time, state of intent is unknown and call can be retried
+var ErrTimeout = errors.New("payment provider did not respond in time")
+
+type Intent struct {
+	Id     string
+	Status string
+	// amount in minor units of currency, e.g. cents
+	Amount   int64
+	Captured int64
+	Refunded int64
+	Currency string
+	// 3-D Secure page when Status is IntentRequiresAction
+	NextActionURL string
+	// reason of decline when Status is IntentFailed
+	FailureCode    string
+	FailureMessage string
+}
+
+type Refund struct {
+	Id       string
+	IntentId string
+	Amount   int64
+}
+
+type PaymentProvider interface {
+	Name() string
+
+	// register payment, money is not moved until Confirm
+	CreateIntent(ctx context.Context, amount int64, currency string, reference string) (*Intent, error)
+
+	// authorize payment with card, result can require 3-D Secure action
+	Confirm(ctx context.Context, intentId string, card string) (*Intent, error)
+
+	// take authorized money, amount can be less than authorized
+	Capture(ctx context.Context, intentId string, amount int64) (*Intent, error)
+
+	// release authorization of not captured intent
+	Cancel(ctx context.Context, intentId string) (*Intent, error)
+
+	// return captured money to customer, partially or fully
+	Refund(ctx context.Context, intentId string, amount int64) (*Refund, error)
+}
+
+type Config struct {
+	// only "mock" is supported
+	Name string `yaml:"name"`
+	// "automatic" captures payment on confirmation, "manual" keeps it authorized
+	Capture string `yaml:"capture"`
+	// limit of single provider call
+	TimeoutSeconds int `yaml:"timeout_seconds"`
+	// key for signatures of webhooks, webhooks are disabled when empty
+	WebhookSecret string `yaml:"-"`
+}
+
+const (
+	CaptureAutomatic = "automatic"
+	CaptureManual    = "manual"
+
+	DefaultTimeout = 10 * time.Second
+)
+
+func (c Config) Timeout() time.Duration {
+	if c.TimeoutSeconds <= 0 {
+		return DefaultTimeout
+	}
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+func (c Config) Validate() error {
+	if c.Capture != "" && c.Capture != CaptureAutomatic && c.Capture != CaptureManual {
+		return fmt.Errorf("payment capture must be %s or %s", CaptureAutomatic, CaptureManual)
+	}
+
+	if c.Name != "" && c.Name != "mock" {
+		return fmt.Errorf("unknown payment provider: %s", c.Name)
+	}
+
+	return nil
+}
+
+func New(config Config) (PaymentProvider, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return NewMock(), nil
+}
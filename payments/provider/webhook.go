@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// header with "t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">"
+const SignatureHeader = "Webhook-Signature"
+
+// webhooks signed earlier or later than this are rejected, so captured requests can not be replayed
+const SignatureTolerance = 5 * time.Minute
+
+// types of webhook events
+const (
+	EventAuthorized = "payment_intent.authorized"
+	EventCaptured   = "payment_intent.succeeded"
+	EventFailed     = "payment_intent.payment_failed"
+	EventCancelled  = "payment_intent.canceled"
+	EventRefunded   = "charge.refunded"
+)
+
+type WebhookEvent struct {
+	Id      string           `json:"id"`
+	Type    string           `json:"type"`
+	Created int64            `json:"created"`
+	Data    WebhookEventData `json:"data"`
+}
+
+type WebhookEventData struct {
+	IntentId string `json:"intent_id"`
+	// total refunded amount in minor units for EventRefunded
+	AmountRefunded int64  `json:"amount_refunded,omitempty"`
+	FailureMessage string `json:"failure_message,omitempty"`
+}
+
+func signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// value of SignatureHeader for body
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), signature(secret, timestamp.Unix(), body))
+}
+
+// check SignatureHeader value, several v1 signatures are allowed during secret rotation
+func VerifyWebhook(secret string, header string, body []byte, now time.Time) error {
+	var timestamp int64
+	var signatures []string
+
+	for _, part := range strings.Split(header, ",") {
+		pair := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+
+		switch pair[0] {
+		case "t":
+			value, err := strconv.ParseInt(pair[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid signature timestamp")
+			}
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, pair[1])
+		}
+	}
+
+	if timestamp == 0 || len(signatures) == 0 {
+		return fmt.Errorf("invalid signature header")
+	}
+
+	signedAt := time.Unix(timestamp, 0)
+	if now.Sub(signedAt) > SignatureTolerance || signedAt.Sub(now) > SignatureTolerance {
+		return fmt.Errorf("signature timestamp is outside of tolerance")
+	}
+
+	expected := signature(secret, timestamp, body)
+	for _, value := range signatures {
+		if hmac.Equal([]byte(value), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("signature does not match")
+}
@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"id":"evt_1","type":"payment_intent.succeeded"}`)
+	now := time.Unix(1700000000, 0)
+
+	signedAt := func(at time.Time) string {
+		return signature(secret, at.Unix(), body)
+	}
+
+	tests := []struct {
+		name    string
+		header  string
+		body    []byte
+		wantErr string
+	}{
+		{name: "valid", header: SignWebhook(secret, now, body)},
+		{name: "spaces after comma", header: fmt.Sprintf("t=%d, v1=%s", now.Unix(), signedAt(now))},
+		{name: "signed at tolerance", header: SignWebhook(secret, now.Add(-SignatureTolerance), body)},
+		{name: "clock of sender ahead", header: SignWebhook(secret, now.Add(SignatureTolerance), body)},
+		{
+			name:    "older than tolerance",
+			header:  SignWebhook(secret, now.Add(-SignatureTolerance-time.Second), body),
+			wantErr: "signature timestamp is outside of tolerance",
+		},
+		{
+			name:    "newer than tolerance",
+			header:  SignWebhook(secret, now.Add(SignatureTolerance+time.Second), body),
+			wantErr: "signature timestamp is outside of tolerance",
+		},
+		{name: "wrong secret", header: SignWebhook("another", now, body), wantErr: "signature does not match"},
+		{name: "changed body", header: SignWebhook(secret, now, body), body: []byte(`{"id":"evt_2"}`), wantErr: "signature does not match"},
+		{
+			name:    "timestamp changed after signing",
+			header:  fmt.Sprintf("t=%d,v1=%s", now.Unix()+1, signedAt(now)),
+			wantErr: "signature does not match",
+		},
+		{
+			name:   "second of several v1 signatures",
+			header: fmt.Sprintf("t=%d,v1=%s,v1=%s", now.Unix(), signature("old", now.Unix(), body), signedAt(now)),
+		},
+		{
+			name:    "none of several v1 signatures",
+			header:  fmt.Sprintf("t=%d,v1=%s,v1=%s", now.Unix(), signature("old", now.Unix(), body), signature("older", now.Unix(), body)),
+			wantErr: "signature does not match",
+		},
+		{
+			name:    "only unknown scheme",
+			header:  fmt.Sprintf("t=%d,v0=%s", now.Unix(), signedAt(now)),
+			wantErr: "invalid signature header",
+		},
+		{name: "no timestamp", header: "v1=" + signedAt(now), wantErr: "invalid signature header"},
+		{name: "invalid timestamp", header: "t=abc,v1=" + signedAt(now), wantErr: "invalid signature timestamp"},
+		{name: "empty", header: "", wantErr: "invalid signature header"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			given := body
+			if test.body != nil {
+				given = test.body
+			}
+
+			err := VerifyWebhook(secret, test.header, given, now)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != test.wantErr {
+				t.Fatalf("got error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/graphql-go/graphql"
+	"github.com/jmoiron/sqlx"
+)
+
+// returned money, rows of payment_refunds are never updated
+type Refund struct {
+	Id        uint64 `json:"id" db:"id"`
+	PaymentId uint64 `json:"payment_id" db:"payment_id"`
+	// minor units of currency of payment
+	Amount   int64   `json:"amount" db:"amount"`
+	Currency string  `json:"currency" db:"currency"`
+	Reason   *string `json:"reason" db:"reason"`
+	// user who made the refund
+	ActorId *uint64 `json:"actor_id" db:"actor_id"`
+	// id of refund in payment provider
+	ProviderRefundId *string `json:"provider_refund_id" db:"provider_refund_id"`
+	CreatedAt        string  `json:"created_at" db:"created_at"`
+}
+
+func (refund *Refund) Money() money.Money {
+	return money.Money{Amount: refund.Amount, Currency: refund.Currency}
+}
+
+func (r *Resolvers) Refund(params graphql.ResolveParams) (*Payment, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	paymentId := uint64(params.Args["payment_id"].(int))
+	reason, _ := params.Args["reason"].(string)
+
+	tx, err := r.pgsql.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := r.checkAccess(tx, paymentId, userId, true); err != nil {
+		return nil, err
+	}
+
+	payment, err := r.load(tx, paymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	var amount int64
+	if value, ok := params.Args["amount"]; ok && value != nil {
+		requested, err := money.FromInput(value)
+		if err != nil {
+			return nil, err
+		}
+		if requested.Currency != payment.Currency {
+			return nil, fmt.Errorf("refund currency %s does not match payment currency %s", requested.Currency, payment.Currency)
+		}
+		if requested.Amount <= 0 {
+			return nil, fmt.Errorf("amount should be positive")
+		}
+		amount = requested.Amount
+	}
+
+	payment, err = r.refund(params.Context, tx, payment, amount, userId, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// refund locked payment, store refund and post it to ledger.
+// Zero amount refunds the rest of captured amount.
+func (r *Resolvers) refund(ctx context.Context, tx *sqlx.Tx, payment *Payment, amount int64, actorId uint64, reason string) (*Payment, error) {
+	if payment.Status != StatusCaptured && payment.Status != StatusPartiallyRefunded {
+		return nil, fmt.Errorf("payment in status %s can not be refunded", payment.Status)
+	}
+
+	refunded, err := refundedAmount(tx, payment.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// payments are always captured in full
+	remaining := payment.Amount - refunded
+	if amount == 0 {
+		amount = remaining
+	}
+
+	if amount > remaining {
+		return nil, fmt.Errorf(
+			"refund exceeds captured amount, at most %s %s can be refunded",
+			money.Money{Amount: remaining, Currency: payment.Currency}.Decimal(), payment.Currency,
+		)
+	}
+
+	if err := checkRefundFunds(tx, payment, amount); err != nil {
+		return nil, err
+	}
+
+	var providerRefundId *string
+	if payment.ProviderIntentId != nil {
+		providerCtx, cancel := r.providerContext(ctx)
+		defer cancel()
+
+		result, err := r.provider.Refund(providerCtx, *payment.ProviderIntentId, amount)
+		if err != nil {
+			return nil, err
+		}
+		providerRefundId = &result.Id
+	}
+
+	return r.recordRefund(tx, payment, amount, actorId, reason, providerRefundId, false)
+}
+
+// store refund made in provider, post it to ledger and change status of payment.
+// Overdraft allows wallet to go negative for refunds which can not be rejected anymore
+func (r *Resolvers) recordRefund(tx *sqlx.Tx, payment *Payment, amount int64, actorId uint64, reason string, providerRefundId *string, overdraft bool) (*Payment, error) {
+	var actor *uint64
+	if actorId != 0 {
+		actor = &actorId
+	}
+
+	var nullableReason *string
+	if reason != "" {
+		nullableReason = &reason
+	}
+
+	var refundId uint64
+	err := tx.Get(&refundId,
+		`INSERT INTO payment_refunds (payment_id, amount, currency, reason, actor_id, provider_refund_id)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		payment.Id, amount, payment.Currency, nullableReason, actor, providerRefundId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := postRefund(tx, payment, refundId, amount, overdraft); err != nil {
+		return nil, err
+	}
+
+	refunded, err := refundedAmount(tx, payment.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	status := StatusPartiallyRefunded
+	if refunded >= payment.Amount {
+		status = StatusRefunded
+	}
+
+	return r.setStatus(tx, payment.Id, status, actorId, reason)
+}
+
+// sum of refunds of payment in minor units
+func refundedAmount(q sqlx.Queryer, paymentId uint64) (int64, error) {
+	var refunded int64
+	err := sqlx.Get(q, &refunded, "SELECT COALESCE(SUM(amount), 0) FROM payment_refunds WHERE payment_id=$1", paymentId)
+	return refunded, err
+}
+
+// refunds of payment, oldest first
+func (r *Resolvers) refunds(paymentId uint64) ([]Refund, error) {
+	refunds := []Refund{}
+	err := r.pgsql.Select(&refunds, "SELECT * FROM payment_refunds WHERE payment_id=$1 ORDER BY id", paymentId)
+	return refunds, err
+}
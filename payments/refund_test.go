@@ -0,0 +1,191 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Moranilt/go-graphql-location/db/dbtest"
+	"github.com/Moranilt/go-graphql-location/ledger"
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/Moranilt/go-graphql-location/payments/provider"
+	"github.com/jmoiron/sqlx"
+)
+
+// user from seed of db/users.sql
+const testUserId = 1
+
+func TestRefundOfSpentTopUp(t *testing.T) {
+	ctx := context.Background()
+	db := dbtest.Open(t)
+	mock := provider.NewMock()
+	r := GetResolvers(db, nil, Options{Provider: mock, ProviderConfig: provider.Config{Name: "mock"}})
+
+	payment := capturedPayment(t, r, mock, 1000)
+	checkBalance(t, db, 1000)
+
+	// top-up is spent, e.g. on subscription
+	inTx(t, db, func(tx *sqlx.Tx) error {
+		return ledger.Charge(tx, "test:spend", "Spent top-up", testUserId, ledger.Revenue("subscriptions", "USD"), 600)
+	})
+
+	tx := db.MustBegin()
+	locked, err := r.load(tx, payment.Id)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if _, err := r.refund(ctx, tx, locked, 0, testUserId, ""); !errors.Is(err, ledger.ErrInsufficientFunds) {
+		t.Fatalf("refund of spent top-up: got error %v, want %v", err, ledger.ErrInsufficientFunds)
+	}
+	tx.Rollback()
+
+	// rest of wallet can be refunded, so provider did not return money for rejected refund
+	inTx(t, db, func(tx *sqlx.Tx) error {
+		locked, err := r.load(tx, payment.Id)
+		if err != nil {
+			return err
+		}
+
+		refunded, err := r.refund(ctx, tx, locked, 400, testUserId, "")
+		if err == nil && refunded.Status != StatusPartiallyRefunded {
+			t.Errorf("got status %s, want %s", refunded.Status, StatusPartiallyRefunded)
+		}
+		return err
+	})
+	checkBalance(t, db, 0)
+
+	var refunds int
+	if err := db.Get(&refunds, "SELECT COUNT(*) FROM payment_refunds WHERE payment_id=$1", payment.Id); err != nil || refunds != 1 {
+		t.Fatalf("got %d refunds, %v, want 1", refunds, err)
+	}
+}
+
+func TestRefundWebhook(t *testing.T) {
+	db := dbtest.Open(t)
+	mock := provider.NewMock()
+	r := GetResolvers(db, nil, Options{Provider: mock, ProviderConfig: provider.Config{Name: "mock"}})
+
+	payment := capturedPayment(t, r, mock, 1000)
+
+	applyEvent := func(id string, amountRefunded int64) string {
+		var status string
+		inTx(t, db, func(tx *sqlx.Tx) error {
+			locked, err := r.load(tx, payment.Id)
+			if err != nil {
+				return err
+			}
+
+			status, err = r.applyRefundEvent(tx, locked, provider.WebhookEvent{
+				Id:   id,
+				Type: provider.EventRefunded,
+				Data: provider.WebhookEventData{IntentId: *payment.ProviderIntentId, AmountRefunded: amountRefunded},
+			})
+			return err
+		})
+		return status
+	}
+
+	// partial refund in dashboard of provider
+	if status := applyEvent("evt_1", 300); status != WebhookProcessed {
+		t.Fatalf("got %s, want %s", status, WebhookProcessed)
+	}
+	checkBalance(t, db, 700)
+
+	// the same total again
+	if status := applyEvent("evt_2", 300); status != WebhookIgnored {
+		t.Fatalf("got %s, want %s", status, WebhookIgnored)
+	}
+
+	// wallet is spent before the rest is refunded in provider
+	inTx(t, db, func(tx *sqlx.Tx) error {
+		return ledger.Charge(tx, "test:spend", "Spent top-up", testUserId, ledger.Revenue("subscriptions", "USD"), 700)
+	})
+
+	if status := applyEvent("evt_3", 1000); status != WebhookProcessed {
+		t.Fatalf("got %s, want %s", status, WebhookProcessed)
+	}
+
+	// money is returned by provider already, so refund is recorded as debt
+	checkBalance(t, db, -700)
+
+	var stored Payment
+	if err := db.Get(&stored, "SELECT * FROM payments WHERE id=$1", payment.Id); err != nil {
+		t.Fatalf("select payment: %v", err)
+	}
+
+	if stored.Status != StatusRefunded {
+		t.Fatalf("got status %s, want %s", stored.Status, StatusRefunded)
+	}
+
+	refunded, err := refundedAmount(db, payment.Id)
+	if err != nil || refunded != 1000 {
+		t.Fatalf("got refunded %d, %v, want 1000", refunded, err)
+	}
+}
+
+// payment of test user captured in mock provider and in database
+func capturedPayment(t *testing.T, r *Resolvers, mock *provider.Mock, amount int64) *Payment {
+	t.Helper()
+	ctx := context.Background()
+
+	intent, err := mock.CreateIntent(ctx, amount, "USD", "test")
+	if err != nil {
+		t.Fatalf("CreateIntent: %v", err)
+	}
+
+	if _, err := mock.Confirm(ctx, intent.Id, provider.CardSuccess); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+
+	if _, err := mock.Capture(ctx, intent.Id, amount); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+
+	var payment *Payment
+	inTx(t, r.pgsql, func(tx *sqlx.Tx) error {
+		var paymentId uint64
+		err := tx.Get(&paymentId,
+			`INSERT INTO payments (user_id, amount, currency, status, provider, provider_intent_id)
+			VALUES ($1, $2, 'USD', $3, $4, $5) RETURNING id`,
+			testUserId, amount, StatusAuthorized, mock.Name(), intent.Id,
+		)
+		if err != nil {
+			return err
+		}
+
+		payment, err = r.setStatus(tx, paymentId, StatusCaptured, 0, "")
+		return err
+	})
+
+	return payment
+}
+
+func inTx(t *testing.T, db *sqlx.DB, apply func(tx *sqlx.Tx) error) {
+	t.Helper()
+
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	if err := apply(tx); err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+}
+
+func checkBalance(t *testing.T, db *sqlx.DB, want int64) {
+	t.Helper()
+
+	balances, err := ledger.Balances(db, testUserId)
+	if err != nil {
+		t.Fatalf("Balances: %v", err)
+	}
+
+	expected := money.Money{Amount: want, Currency: "USD"}
+	if len(balances) != 1 || balances[0] != expected {
+		t.Fatalf("got balances %v, want %v", balances, expected)
+	}
+}
@@ -1,9 +1,15 @@
 package payments
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 
 	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/invoices"
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/Moranilt/go-graphql-location/pagination"
+	"github.com/Moranilt/go-graphql-location/payments/provider"
 	"github.com/go-redis/redis/v8"
 	"github.com/graphql-go/graphql"
 	"github.com/jmoiron/sqlx"
@@ -11,6 +17,43 @@ import (
 
 type Resolverers interface {
 	Create(graphql.ResolveParams) (*PaymentsCreateReturn, error)
+
+	// Move payment to another status, see CanTransition for allowed changes.
+	// Owner of payment can only cancel it, admins can apply any allowed transition.
+	Transition(graphql.ResolveParams) (*Payment, error)
+
+	// Cancel pending or authorized payment, allowed to owner and admins
+	Cancel(graphql.ResolveParams) (*Payment, error)
+
+	// Return captured money to payer through payment provider, full rest by default.
+	// Allowed to owner and admins, refunds never exceed captured amount or balance of payer wallet.
+	Refund(graphql.ResolveParams) (*Payment, error)
+
+	// Payments of authorized user, admins can pass user_id of another user
+	Payments(graphql.ResolveParams) (*pagination.Connection, error)
+
+	// Count, total and average of paid payments grouped by period and currency
+	Stats(graphql.ResolveParams) ([]StatsBucket, error)
+
+	// Authorize pending payment of authorized user with card through payment provider.
+	// Payment is captured right away unless capture mode is manual. When provider requires
+	// 3-D Secure, payment stays pending and has to be confirmed again after the challenge.
+	Confirm(graphql.ResolveParams) (*Confirmation, error)
+
+	// Receive status update from payment provider, checks signature and stores event.
+	// Every event is applied once, repeated deliveries return stored result.
+	WebhookHandler(w http.ResponseWriter, req *http.Request)
+
+	// Apply stored webhook event again, used for failed events and manual replay
+	ProcessWebhookEvent(ctx context.Context, providerName string, eventId string, replay bool) (string, error)
+}
+
+// result of Confirm, decline is not an error because payment is stored as failed
+type Confirmation struct {
+	Payment        *Payment `json:"payment"`
+	NextActionURL  string   `json:"next_action_url"`
+	DeclineCode    string   `json:"decline_code"`
+	DeclineMessage string   `json:"decline_message"`
 }
 
 type PaymentsCreateReturn struct {
@@ -18,58 +61,348 @@ type PaymentsCreateReturn struct {
 }
 
 type PaymentsInput struct {
-	UserId uint64  `json:"user_id" db:"user_id"`
-	Amount float64 `json:"amount" db:"amount"`
+	UserId uint64      `json:"user_id" db:"user_id"`
+	Amount money.Money `json:"amount"`
 }
 
 type Resolvers struct {
 	pgsql       *sqlx.DB
 	RedisClient *redis.Client
+	auth        *authorization.Config
+	provider    provider.PaymentProvider
+	config      provider.Config
+	invoices    invoices.Issuer
 }
 
-func GetResolvers(pgsql *sqlx.DB, client *redis.Client) *Resolvers {
-	return &Resolvers{pgsql: pgsql, RedisClient: client}
+type Options struct {
+	Auth     *authorization.Config
+	Provider provider.PaymentProvider
+	// capture mode and timeout of provider calls
+	ProviderConfig provider.Config
+	// issues invoice for captured payment, invoices are not issued when empty
+	Invoices invoices.Issuer
+}
+
+// resolvers of PaymentType fields, set by GetResolvers
+var fieldResolvers *Resolvers
+
+func GetResolvers(pgsql *sqlx.DB, client *redis.Client, options Options) *Resolvers {
+	fieldResolvers = &Resolvers{
+		pgsql:       pgsql,
+		RedisClient: client,
+		auth:        options.Auth,
+		provider:    options.Provider,
+		config:      options.ProviderConfig,
+		invoices:    options.Invoices,
+	}
+	return fieldResolvers
+}
+
+// context for single provider call
+func (r *Resolvers) providerContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, r.config.Timeout())
+}
+
+// get id of authorized active user from access token in context
+func (r *Resolvers) currentUserId(params graphql.ResolveParams) (uint64, error) {
+	requestToken, _ := params.Context.Value(authorization.AuthHeaderKey).(string)
+	token, err := authorization.ExtractTokenMetadata(r.auth, requestToken)
+	if err != nil {
+		return 0, err
+	}
+
+	userId, err := authorization.FetchAuth(token, r.RedisClient, params.Context)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := authorization.CheckActive(params.Context, r.pgsql, userId); err != nil {
+		return 0, err
+	}
+
+	return userId, nil
 }
 
 func (r *Resolvers) Create(params graphql.ResolveParams) (*PaymentsCreateReturn, error) {
-	requestToken := params.Context.Value(authorization.AuthHeaderKey)
-	token, err := authorization.ExtractTokenMetadata(requestToken.(string))
 	args := params.Args
 	var PaymentInput PaymentsInput
 
+	userId, err := r.currentUserId(params)
 	if err != nil {
 		return nil, err
 	}
 
-	userId, err := authorization.FetchAuth(token, r.RedisClient, params.Context)
-
 	PaymentInput.UserId = userId
 
+	PaymentInput.Amount, err = money.FromInput(args["amount"])
 	if err != nil {
 		return nil, err
 	}
 
-	if val, ok := args["amount"]; ok {
-		PaymentInput.Amount = val.(float64)
+	if PaymentInput.Amount.Amount <= 0 {
+		return nil, fmt.Errorf("amount should be positive")
 	}
 
-	if PaymentInput.Amount == 0 {
-		return nil, fmt.Errorf("amount should not be empty")
+	tx, err := r.pgsql.Beginx()
+	if err != nil {
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	insertPayment := `INSERT INTO payments (user_id, amount) VALUES(:user_id, :amount) RETURNING id`
+	var paymentResult PaymentsCreateReturn
+	err = tx.Get(&paymentResult.Id, "INSERT INTO payments (user_id, amount, currency, status) VALUES($1, $2, $3, $4) RETURNING id",
+		PaymentInput.UserId, PaymentInput.Amount.Amount, PaymentInput.Amount.Currency, StatusPending)
+	if err != nil {
+		return nil, err
+	}
 
-	result, err := r.pgsql.NamedQuery(insertPayment, PaymentInput)
+	if err := insertEvent(tx, uint64(paymentResult.Id), nil, StatusPending, userId, ""); err != nil {
+		return nil, err
+	}
 
+	// payment is not stored when provider rejects it
+	ctx, cancel := r.providerContext(params.Context)
+	defer cancel()
+
+	intent, err := r.provider.CreateIntent(ctx, PaymentInput.Amount.Amount, PaymentInput.Amount.Currency, fmt.Sprintf("payment-%d", paymentResult.Id))
 	if err != nil {
 		return nil, err
 	}
 
-	var paymentResult PaymentsCreateReturn
+	_, err = tx.Exec("UPDATE payments SET provider=$2, provider_intent_id=$3 WHERE id=$1", paymentResult.Id, r.provider.Name(), intent.Id)
+	if err != nil {
+		return nil, err
+	}
 
-	if result.Next() {
-		result.Scan(&paymentResult.Id)
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
 	return &paymentResult, nil
 }
+
+func (r *Resolvers) Transition(params graphql.ResolveParams) (*Payment, error) {
+	paymentId := uint64(params.Args["id"].(int))
+	status := params.Args["status"].(string)
+	note, _ := params.Args["note"].(string)
+
+	return r.transition(params, paymentId, status, note)
+}
+
+func (r *Resolvers) Cancel(params graphql.ResolveParams) (*Payment, error) {
+	paymentId := uint64(params.Args["payment_id"].(int))
+
+	return r.transition(params, paymentId, StatusCancelled, "")
+}
+
+func (r *Resolvers) transition(params graphql.ResolveParams, paymentId uint64, status string, note string) (*Payment, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.pgsql.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := r.checkAccess(tx, paymentId, userId, status == StatusCancelled); err != nil {
+		return nil, err
+	}
+
+	payment, err := r.load(tx, paymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !CanTransition(payment.Status, status) {
+		return nil, fmt.Errorf("payment can not be changed from %s to %s", payment.Status, status)
+	}
+
+	switch status {
+	case StatusRefunded:
+		// rest of captured amount
+		payment, err = r.refund(params.Context, tx, payment, 0, userId, note)
+	case StatusPartiallyRefunded:
+		err = fmt.Errorf("use refundPayment with amount for partial refund")
+	default:
+		if err = r.applyToProvider(params.Context, payment, status); err == nil {
+			payment, err = r.setStatus(tx, paymentId, status, userId, note)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// owner of payment passes only when ownerAllowed, admins always pass
+func (r *Resolvers) checkAccess(tx *sqlx.Tx, paymentId uint64, userId uint64, ownerAllowed bool) error {
+	var ownerId *uint64
+	if err := tx.Get(&ownerId, "SELECT user_id FROM payments WHERE id=$1", paymentId); err != nil {
+		return fmt.Errorf("payment not found")
+	}
+
+	isOwner := ownerId != nil && *ownerId == userId
+	if isOwner && ownerAllowed {
+		return nil
+	}
+
+	if err := authorization.CheckRole(r.pgsql, userId, authorization.RoleAdmin); err != nil {
+		// payments of other users are not revealed
+		if !isOwner {
+			return fmt.Errorf("payment not found")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// history of payment status, oldest first
+func (r *Resolvers) events(paymentId uint64) ([]Event, error) {
+	events := []Event{}
+	err := r.pgsql.Select(&events, "SELECT * FROM payment_events WHERE payment_id=$1 ORDER BY id", paymentId)
+	return events, err
+}
+
+// lock and read payment in transaction
+func (r *Resolvers) load(tx *sqlx.Tx, paymentId uint64) (*Payment, error) {
+	var payment Payment
+	if err := tx.Get(&payment, "SELECT * FROM payments WHERE id=$1 FOR UPDATE", paymentId); err != nil {
+		return nil, fmt.Errorf("payment not found")
+	}
+	return &payment, nil
+}
+
+// move money for manual transition, statuses without money movement are only stored
+func (r *Resolvers) applyToProvider(ctx context.Context, payment *Payment, status string) error {
+	if payment.ProviderIntentId == nil {
+		return nil
+	}
+
+	ctx, cancel := r.providerContext(ctx)
+	defer cancel()
+
+	var err error
+	switch status {
+	case StatusCaptured:
+		_, err = r.provider.Capture(ctx, *payment.ProviderIntentId, payment.Amount)
+	case StatusCancelled:
+		_, err = r.provider.Cancel(ctx, *payment.ProviderIntentId)
+	}
+
+	return err
+}
+
+func (r *Resolvers) Confirm(params graphql.ResolveParams) (*Confirmation, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	paymentId := uint64(params.Args["id"].(int))
+	card := params.Args["card"].(string)
+
+	tx, err := r.pgsql.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	payment, err := r.load(tx, paymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.UserId == nil || *payment.UserId != userId {
+		return nil, fmt.Errorf("payment not found")
+	}
+
+	if payment.Status != StatusPending || payment.ProviderIntentId == nil {
+		return nil, fmt.Errorf("payment in status %s can not be confirmed", payment.Status)
+	}
+
+	ctx, cancel := r.providerContext(params.Context)
+	defer cancel()
+
+	intent, err := r.provider.Confirm(ctx, *payment.ProviderIntentId, card)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Confirmation{}
+	switch intent.Status {
+	case provider.IntentRequiresAction:
+		result.NextActionURL = intent.NextActionURL
+	case provider.IntentFailed:
+		result.DeclineCode = intent.FailureCode
+		result.DeclineMessage = intent.FailureMessage
+		payment, err = r.setStatus(tx, paymentId, StatusFailed, 0, intent.FailureMessage)
+	case provider.IntentAuthorized:
+		payment, err = r.setStatus(tx, paymentId, StatusAuthorized, 0, "")
+	default:
+		err = fmt.Errorf("unexpected status of payment intent: %s", intent.Status)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// authorization is committed before capture, so payment is never left pending when card
+	// is charged. When recording of capture fails, it is recorded by payment_intent.succeeded webhook
+	if intent.Status == provider.IntentAuthorized && r.config.Capture != provider.CaptureManual {
+		payment, err = r.capture(ctx, paymentId, intent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result.Payment = payment
+	return result, nil
+}
+
+// capture authorized intent and record it in separate transaction
+func (r *Resolvers) capture(ctx context.Context, paymentId uint64, intent *provider.Intent) (*Payment, error) {
+	if _, err := r.provider.Capture(ctx, intent.Id, intent.Amount); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.pgsql.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	payment, err := r.load(tx, paymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	// webhook of capture could be processed first
+	if payment.Status != StatusAuthorized {
+		return payment, nil
+	}
+
+	payment, err = r.setStatus(tx, paymentId, StatusCaptured, 0, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
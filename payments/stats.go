@@ -0,0 +1,83 @@
+package payments
+
+import (
+	"fmt"
+
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/Moranilt/go-graphql-location/pagination"
+	"github.com/graphql-go/graphql"
+	"github.com/lib/pq"
+)
+
+// units of grouping, values are date_trunc fields
+var statsIntervals = map[string]string{
+	"DAY":   "day",
+	"WEEK":  "week",
+	"MONTH": "month",
+}
+
+// aggregates of payments in one currency created in one period.
+// Amounts are in minor units and count only paid payments.
+type StatsBucket struct {
+	// start of period in UTC, YYYY-MM-DD
+	Period    string `json:"period" db:"period"`
+	Currency  string `json:"currency" db:"currency"`
+	Count     int    `json:"count" db:"count"`
+	PaidCount int    `json:"paid_count" db:"paid_count"`
+	Total     int64  `json:"total" db:"total"`
+	Refunded  int64  `json:"refunded" db:"refunded"`
+	Average   int64  `json:"average" db:"average"`
+}
+
+func (r *Resolvers) Stats(params graphql.ResolveParams) ([]StatsBucket, error) {
+	userId, err := r.targetUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	interval, _ := params.Args["interval"].(string)
+	field, ok := statsIntervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("unsupported interval")
+	}
+
+	filter := &pagination.Filter{}
+	filter.Add("payments.user_id = ?", userId)
+	if values, ok := params.Args["filter"].(map[string]interface{}); ok {
+		if err := applyPaymentsFilter(filter, values); err != nil {
+			return nil, err
+		}
+	}
+
+	period := fmt.Sprintf("to_char(date_trunc(%s, payments.created_at), 'YYYY-MM-DD')", filter.Arg(field))
+	paid := "payments.status = ANY(" + filter.Arg(pq.Array(paidStatuses)) + ")"
+
+	query := fmt.Sprintf(
+		`SELECT %s AS period, payments.currency,
+			COUNT(*) AS count,
+			COUNT(*) FILTER (WHERE %s) AS paid_count,
+			COALESCE(SUM(payments.amount) FILTER (WHERE %s), 0) AS total,
+			COALESCE(SUM(refunds.amount), 0) AS refunded,
+			COALESCE(ROUND(AVG(payments.amount) FILTER (WHERE %s)), 0)::bigint AS average
+		FROM payments
+		LEFT JOIN (SELECT payment_id, SUM(amount) AS amount FROM payment_refunds GROUP BY payment_id) refunds
+			ON refunds.payment_id = payments.id%s
+		GROUP BY 1, 2 ORDER BY 1, 2`,
+		period, paid, paid, paid, filter.Where(),
+	)
+
+	buckets := []StatsBucket{}
+	err = r.pgsql.Select(&buckets, query, filter.Args...)
+	return buckets, err
+}
+
+// resolver of Money field of PaymentStats
+func statsAmount(amount func(bucket StatsBucket) int64) graphql.FieldResolveFn {
+	return func(params graphql.ResolveParams) (interface{}, error) {
+		bucket, ok := params.Source.(StatsBucket)
+		if !ok {
+			return nil, nil
+		}
+		return money.Money{Amount: amount(bucket), Currency: bucket.Currency}, nil
+	}
+}
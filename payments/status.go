@@ -0,0 +1,143 @@
+package payments
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/Moranilt/go-graphql-location/invoices"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	StatusPending           = "pending"
+	StatusAuthorized        = "authorized"
+	StatusCaptured          = "captured"
+	StatusFailed            = "failed"
+	StatusCancelled         = "cancelled"
+	StatusRefunded          = "refunded"
+	StatusPartiallyRefunded = "partially_refunded"
+)
+
+var Statuses = []string{
+	StatusPending, StatusAuthorized, StatusCaptured, StatusFailed,
+	StatusCancelled, StatusRefunded, StatusPartiallyRefunded,
+}
+
+// allowed next statuses, statuses without entry are final
+var transitions = map[string][]string{
+	StatusPending:           {StatusAuthorized, StatusCaptured, StatusFailed, StatusCancelled},
+	StatusAuthorized:        {StatusCaptured, StatusFailed, StatusCancelled},
+	StatusCaptured:          {StatusPartiallyRefunded, StatusRefunded},
+	StatusPartiallyRefunded: {StatusPartiallyRefunded, StatusRefunded},
+}
+
+func CanTransition(from string, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// money was received for payments in these statuses
+var paidStatuses = []string{StatusCaptured, StatusPartiallyRefunded, StatusRefunded}
+
+func IsPaid(status string) bool {
+	for _, paid := range paidStatuses {
+		if status == paid {
+			return true
+		}
+	}
+	return false
+}
+
+// stored transition of payment, rows of payment_events are never updated
+type Event struct {
+	Id         uint64  `json:"id" db:"id"`
+	PaymentId  uint64  `json:"payment_id" db:"payment_id"`
+	FromStatus *string `json:"from_status" db:"from_status"`
+	ToStatus   string  `json:"to_status" db:"to_status"`
+	// empty for changes made by system or payment provider
+	ActorId   *uint64 `json:"actor_id" db:"actor_id"`
+	Note      *string `json:"note" db:"note"`
+	CreatedAt string  `json:"created_at" db:"created_at"`
+}
+
+func insertEvent(tx *sqlx.Tx, paymentId uint64, from *string, to string, actorId uint64, note string) error {
+	var actor *uint64
+	if actorId != 0 {
+		actor = &actorId
+	}
+
+	var nullableNote *string
+	if note != "" {
+		nullableNote = &note
+	}
+
+	_, err := tx.Exec(
+		"INSERT INTO payment_events (payment_id, from_status, to_status, actor_id, note) VALUES ($1, $2, $3, $4, $5)",
+		paymentId, from, to, actor, nullableNote,
+	)
+	return err
+}
+
+// change status of payment in transaction and store event, capture is posted to ledger.
+// Payment row is locked, so concurrent transitions are applied one by one.
+func Transition(tx *sqlx.Tx, paymentId uint64, to string, actorId uint64, note string) (*Payment, error) {
+	var current string
+	err := tx.Get(&current, "SELECT status FROM payments WHERE id=$1 FOR UPDATE", paymentId)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("payment not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !CanTransition(current, to) {
+		return nil, fmt.Errorf("payment can not be changed from %s to %s", current, to)
+	}
+
+	var payment Payment
+	err = tx.Get(&payment,
+		`UPDATE payments SET status=$2, updated_at=NOW(),
+			captured_at=CASE WHEN $2 = 'captured' THEN NOW() ELSE captured_at END
+		WHERE id=$1 RETURNING *`,
+		paymentId, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertEvent(tx, paymentId, &current, to, actorId, note); err != nil {
+		return nil, err
+	}
+
+	if to == StatusCaptured {
+		if err := postCapture(tx, &payment); err != nil {
+			return nil, err
+		}
+	}
+
+	return &payment, nil
+}
+
+// Transition which issues invoice when payment is captured
+func (r *Resolvers) setStatus(tx *sqlx.Tx, paymentId uint64, to string, actorId uint64, note string) (*Payment, error) {
+	payment, err := Transition(tx, paymentId, to, actorId, note)
+	if err != nil || to != StatusCaptured || r.invoices == nil {
+		return payment, err
+	}
+
+	_, err = r.invoices.Issue(tx, invoices.Source{
+		PaymentId:   &payment.Id,
+		UserId:      payment.UserId,
+		Description: fmt.Sprintf("Wallet top-up, payment #%d", payment.Id),
+		Amount:      payment.Money(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to issue invoice: %s", err)
+	}
+
+	return payment, nil
+}
@@ -0,0 +1,91 @@
+package payments
+
+import (
+	"testing"
+
+	"github.com/Moranilt/go-graphql-location/db/dbtest"
+)
+
+func TestCanTransition(t *testing.T) {
+	allowed := map[string][]string{
+		StatusPending:           {StatusAuthorized, StatusCaptured, StatusFailed, StatusCancelled},
+		StatusAuthorized:        {StatusCaptured, StatusFailed, StatusCancelled},
+		StatusCaptured:          {StatusPartiallyRefunded, StatusRefunded},
+		StatusPartiallyRefunded: {StatusPartiallyRefunded, StatusRefunded},
+		// final statuses
+		StatusFailed:    nil,
+		StatusCancelled: nil,
+		StatusRefunded:  nil,
+	}
+
+	for _, from := range Statuses {
+		for _, to := range Statuses {
+			want := false
+			for _, next := range allowed[from] {
+				want = want || next == to
+			}
+
+			t.Run(from+" to "+to, func(t *testing.T) {
+				if got := CanTransition(from, to); got != want {
+					t.Fatalf("got %v, want %v", got, want)
+				}
+			})
+		}
+	}
+
+	if CanTransition("unknown", StatusCaptured) || CanTransition(StatusPending, "unknown") {
+		t.Fatalf("unknown status is allowed")
+	}
+}
+
+func TestTransition(t *testing.T) {
+	db := dbtest.Open(t)
+
+	var paymentId uint64
+	err := db.Get(&paymentId, "INSERT INTO payments (user_id, amount, status) VALUES ($1, 1000, 'captured') RETURNING id", testUserId)
+	if err != nil {
+		t.Fatalf("insert payment: %v", err)
+	}
+
+	tests := []struct {
+		to      string
+		wantErr string
+	}{
+		{to: StatusCancelled, wantErr: "payment can not be changed from captured to cancelled"},
+		{to: StatusPartiallyRefunded},
+		{to: StatusPartiallyRefunded},
+		{to: StatusRefunded},
+		{to: StatusPartiallyRefunded, wantErr: "payment can not be changed from refunded to partially_refunded"},
+	}
+
+	events := 0
+	for _, test := range tests {
+		tx := db.MustBegin()
+		payment, err := Transition(tx, paymentId, test.to, 0, "")
+		if test.wantErr != "" {
+			tx.Rollback()
+			if err == nil || err.Error() != test.wantErr {
+				t.Fatalf("got error %v, want %s", err, test.wantErr)
+			}
+			continue
+		}
+
+		if err != nil {
+			tx.Rollback()
+			t.Fatalf("Transition to %s: %v", test.to, err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("commit failed: %v", err)
+		}
+		events++
+
+		if payment.Status != test.to {
+			t.Fatalf("got status %s, want %s", payment.Status, test.to)
+		}
+	}
+
+	var stored int
+	if err := db.Get(&stored, "SELECT COUNT(*) FROM payment_events WHERE payment_id=$1", paymentId); err != nil || stored != events {
+		t.Fatalf("got %d events, %v, want %d", stored, err, events)
+	}
+}
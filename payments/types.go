@@ -1,23 +1,47 @@
 package payments
 
-import "github.com/graphql-go/graphql"
+import (
+	"github.com/Moranilt/go-graphql-location/invoices"
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/Moranilt/go-graphql-location/pagination"
+	"github.com/graphql-go/graphql"
+)
 
 type Types struct {
 	CreatePayment *graphql.Object
+	Payment       *graphql.Object
+	Confirmation  *graphql.Object
+	Payments      *graphql.Object
+	Stats         *graphql.Object
 }
 
 type Payment struct {
-	Id        uint64  `json:"id" db:"id"`
-	UserId    uint64  `json:"user_id" db:"user_id"`
-	Amount    float64 `json:"amount" db:"amount"`
-	Payed     bool    `json:"payed" db:"payed"`
-	CreatedAt string  `json:"created_at" db:"created_at"`
-	PayedAt   *string `json:"payed_at" db:"payed_at"`
+	Id uint64 `json:"id" db:"id"`
+	// empty for payments of deleted users
+	UserId *uint64 `json:"user_id" db:"user_id"`
+	// minor units of currency
+	Amount     int64   `json:"amount" db:"amount"`
+	Currency   string  `json:"currency" db:"currency"`
+	Status     string  `json:"status" db:"status"`
+	CreatedAt  string  `json:"created_at" db:"created_at"`
+	UpdatedAt  string  `json:"updated_at" db:"updated_at"`
+	CapturedAt *string `json:"captured_at" db:"captured_at"`
+	// gateway which processes payment and id of payment there
+	Provider         *string `json:"provider" db:"provider"`
+	ProviderIntentId *string `json:"provider_intent_id" db:"provider_intent_id"`
+}
+
+func (p *Payment) Money() money.Money {
+	return money.Money{Amount: p.Amount, Currency: p.Currency}
 }
 
 func GetTypes() Types {
 	return Types{
 		CreatePayment: createPayment,
+		Payment:       paymentType,
+		Confirmation:  confirmationType,
+		Payments:      paymentsConnectionType,
+		Stats:         statsType,
 	}
 }
 
@@ -27,8 +51,243 @@ var createPayment = graphql.NewObject(graphql.ObjectConfig{
 	Fields: graphql.FieldsThunk(func() graphql.Fields {
 		return graphql.Fields{
 			"id": &graphql.Field{
-				Type: graphql.Float,
+				Type: graphql.Int,
 			},
 		}
 	}),
 })
+
+var statusEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "PaymentStatus",
+	Values: graphql.EnumValueConfigMap{
+		StatusPending:           &graphql.EnumValueConfig{Value: StatusPending},
+		StatusAuthorized:        &graphql.EnumValueConfig{Value: StatusAuthorized},
+		StatusCaptured:          &graphql.EnumValueConfig{Value: StatusCaptured},
+		StatusFailed:            &graphql.EnumValueConfig{Value: StatusFailed},
+		StatusCancelled:         &graphql.EnumValueConfig{Value: StatusCancelled},
+		StatusRefunded:          &graphql.EnumValueConfig{Value: StatusRefunded},
+		StatusPartiallyRefunded: &graphql.EnumValueConfig{Value: StatusPartiallyRefunded},
+	},
+})
+
+var eventType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PaymentEvent",
+	Fields: graphql.Fields{
+		"from_status": &graphql.Field{
+			Type:        statusEnum,
+			Description: "Empty for creation of payment",
+		},
+		"to_status": &graphql.Field{
+			Type: statusEnum,
+		},
+		"actor_id": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "User who made the change, empty for system and provider",
+		},
+		"note": &graphql.Field{
+			Type: graphql.String,
+		},
+		"created_at": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+func sourcePayment(params graphql.ResolveParams) *Payment {
+	switch source := params.Source.(type) {
+	case *Payment:
+		return source
+	case Payment:
+		return &source
+	}
+	return nil
+}
+
+var refundType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PaymentRefund",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"amount": &graphql.Field{
+			Type: money.Type,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				if refund, ok := params.Source.(Refund); ok {
+					return refund.Money(), nil
+				}
+				return nil, nil
+			},
+		},
+		"reason": &graphql.Field{
+			Type: graphql.String,
+		},
+		"actor_id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"created_at": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var paymentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PaymentType",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"user_id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"amount": &graphql.Field{
+			Type: money.Type,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				if payment := sourcePayment(params); payment != nil {
+					return payment.Money(), nil
+				}
+				return nil, nil
+			},
+		},
+		"status": &graphql.Field{
+			Type: statusEnum,
+		},
+		"events": &graphql.Field{
+			Type:        graphql.NewList(eventType),
+			Description: "Status changes, oldest first",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				payment := sourcePayment(params)
+				if payment == nil || fieldResolvers == nil {
+					return nil, nil
+				}
+				return fieldResolvers.events(payment.Id)
+			},
+		},
+		"refunds": &graphql.Field{
+			Type:        graphql.NewList(refundType),
+			Description: "Oldest first",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				payment := sourcePayment(params)
+				if payment == nil || fieldResolvers == nil {
+					return nil, nil
+				}
+				return fieldResolvers.refunds(payment.Id)
+			},
+		},
+		"refunded": &graphql.Field{
+			Type:        money.Type,
+			Description: "Total of refunds",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				payment := sourcePayment(params)
+				if payment == nil || fieldResolvers == nil {
+					return nil, nil
+				}
+				amount, err := refundedAmount(fieldResolvers.pgsql, payment.Id)
+				if err != nil {
+					return nil, err
+				}
+				return money.Money{Amount: amount, Currency: payment.Currency}, nil
+			},
+		},
+		"invoice": &graphql.Field{
+			Type:        invoices.GetTypes().Invoice,
+			Description: "Issued when payment is captured",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				payment := sourcePayment(params)
+				if payment == nil || fieldResolvers == nil {
+					return nil, nil
+				}
+				invoice, err := invoices.ForPayment(fieldResolvers.pgsql, payment.Id)
+				if err != nil || invoice == nil {
+					return nil, err
+				}
+				return invoice, nil
+			},
+		},
+		"payed": &graphql.Field{
+			Type:              graphql.Boolean,
+			DeprecationReason: "Use status",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				payment := sourcePayment(params)
+				return payment != nil && IsPaid(payment.Status), nil
+			},
+		},
+		"payed_at": &graphql.Field{
+			Type:              graphql.String,
+			DeprecationReason: "Use captured_at",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				if payment := sourcePayment(params); payment != nil {
+					return payment.CapturedAt, nil
+				}
+				return nil, nil
+			},
+		},
+		"captured_at": &graphql.Field{
+			Type: graphql.String,
+		},
+		"created_at": &graphql.Field{
+			Type: graphql.String,
+		},
+		"updated_at": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var confirmationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PaymentConfirmation",
+	Fields: graphql.Fields{
+		"payment": &graphql.Field{
+			Type: paymentType,
+		},
+		"next_action_url": &graphql.Field{
+			Type:        graphql.String,
+			Description: "3-D Secure page, confirm payment again after the challenge",
+		},
+		"decline_code": &graphql.Field{
+			Type: graphql.String,
+		},
+		"decline_message": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var paymentsConnectionType = pagination.ConnectionType("Payments", paymentType)
+
+var statsType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "PaymentStats",
+	Description: "Payments in one currency created in one period, amounts count only paid payments",
+	Fields: graphql.Fields{
+		"period": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Start of day, week or month in UTC, YYYY-MM-DD",
+		},
+		"currency": &graphql.Field{
+			Type: graphql.String,
+		},
+		"count": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "All payments including pending and failed",
+		},
+		"paid_count": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"total": &graphql.Field{
+			Type:    money.Type,
+			Resolve: statsAmount(func(bucket StatsBucket) int64 { return bucket.Total }),
+		},
+		"refunded": &graphql.Field{
+			Type:    money.Type,
+			Resolve: statsAmount(func(bucket StatsBucket) int64 { return bucket.Refunded }),
+		},
+		"net": &graphql.Field{
+			Type:        money.Type,
+			Description: "Total without refunds",
+			Resolve:     statsAmount(func(bucket StatsBucket) int64 { return bucket.Total - bucket.Refunded }),
+		},
+		"average": &graphql.Field{
+			Type:    money.Type,
+			Resolve: statsAmount(func(bucket StatsBucket) int64 { return bucket.Average }),
+		},
+	},
+})
@@ -0,0 +1,218 @@
+package payments
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/payments/provider"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+)
+
+// webhook bodies are small, larger requests are rejected
+const maxWebhookSize = 64 << 10
+
+// results of stored webhook events
+const (
+	WebhookProcessed = "processed"
+	// event does not change payment, e.g. status was already set by confirmation
+	WebhookIgnored = "ignored"
+	WebhookFailed  = "failed"
+)
+
+type WebhookEvent struct {
+	Id          uint64  `db:"id"`
+	Provider    string  `db:"provider"`
+	EventId     string  `db:"event_id"`
+	Type        string  `db:"type"`
+	Payload     string  `db:"payload"`
+	Status      *string `db:"status"`
+	Error       *string `db:"error"`
+	ReceivedAt  string  `db:"received_at"`
+	ProcessedAt *string `db:"processed_at"`
+}
+
+func (r *Resolvers) WebhookHandler(w http.ResponseWriter, req *http.Request) {
+	providerName := mux.Vars(req)["provider"]
+	if r.provider == nil || providerName != r.provider.Name() || r.config.WebhookSecret == "" {
+		http.NotFound(w, req)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxWebhookSize))
+	if err != nil {
+		http.Error(w, "request is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	err = provider.VerifyWebhook(r.config.WebhookSecret, req.Header.Get(provider.SignatureHeader), body, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var event provider.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.Id == "" || event.Type == "" {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+
+	// provider retries delivery, so the same event can come several times
+	_, err = r.pgsql.ExecContext(req.Context(),
+		"INSERT INTO webhook_events (provider, event_id, type, payload) VALUES ($1, $2, $3, $4) ON CONFLICT (provider, event_id) DO NOTHING",
+		providerName, event.Id, event.Type, string(body),
+	)
+	if err != nil {
+		log.Printf("unable to store webhook event %s: %s", event.Id, err)
+		http.Error(w, "unable to store event", http.StatusInternalServerError)
+		return
+	}
+
+	status, err := r.ProcessWebhookEvent(req.Context(), providerName, event.Id, false)
+	if err != nil {
+		log.Printf("webhook event %s failed: %s", event.Id, err)
+		// error status makes provider deliver event again later
+		http.Error(w, "event processing failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": status})
+}
+
+// apply stored event to payment. Processed and ignored events are skipped
+// unless replay is set, failed events are processed again.
+func (r *Resolvers) ProcessWebhookEvent(ctx context.Context, providerName string, eventId string, replay bool) (string, error) {
+	tx, err := r.pgsql.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var stored WebhookEvent
+	err = tx.GetContext(ctx, &stored, "SELECT * FROM webhook_events WHERE provider=$1 AND event_id=$2 FOR UPDATE", providerName, eventId)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("event %s is not stored", eventId)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if stored.Status != nil && *stored.Status != WebhookFailed && !replay {
+		return *stored.Status, nil
+	}
+
+	status, processErr := r.applyWebhookEvent(ctx, tx, providerName, stored.Payload)
+
+	// result is stored even when event failed, payment changes are rolled back then
+	if processErr != nil {
+		tx.Rollback()
+
+		message := processErr.Error()
+		_, err = r.pgsql.ExecContext(ctx,
+			"UPDATE webhook_events SET status=$2, error=$3, processed_at=NOW() WHERE id=$1",
+			stored.Id, WebhookFailed, message,
+		)
+		if err != nil {
+			return "", err
+		}
+		return WebhookFailed, processErr
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE webhook_events SET status=$2, error=NULL, processed_at=NOW() WHERE id=$1", stored.Id, status)
+	if err != nil {
+		return "", err
+	}
+
+	return status, tx.Commit()
+}
+
+// translate event into transition of payment
+func (r *Resolvers) applyWebhookEvent(ctx context.Context, tx *sqlx.Tx, providerName string, payload string) (string, error) {
+	var event provider.WebhookEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return "", err
+	}
+
+	var paymentId uint64
+	err := tx.GetContext(ctx, &paymentId,
+		"SELECT id FROM payments WHERE provider=$1 AND provider_intent_id=$2", providerName, event.Data.IntentId,
+	)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("payment with intent %s not found", event.Data.IntentId)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	payment, err := r.load(tx, paymentId)
+	if err != nil {
+		return "", err
+	}
+
+	var status, note string
+	switch event.Type {
+	case provider.EventAuthorized:
+		status = StatusAuthorized
+	case provider.EventCaptured:
+		status = StatusCaptured
+	case provider.EventFailed:
+		status, note = StatusFailed, event.Data.FailureMessage
+	case provider.EventCancelled:
+		status = StatusCancelled
+	case provider.EventRefunded:
+		return r.applyRefundEvent(tx, payment, event)
+	default:
+		return WebhookIgnored, nil
+	}
+
+	// status could be set already by response of provider call
+	if payment.Status == status || !CanTransition(payment.Status, status) {
+		return WebhookIgnored, nil
+	}
+
+	if note == "" {
+		note = "webhook " + event.Id
+	}
+
+	if _, err := r.setStatus(tx, paymentId, status, 0, note); err != nil {
+		return "", err
+	}
+
+	return WebhookProcessed, nil
+}
+
+// record refunds made in provider without refundPayment, e.g. in its dashboard.
+// Event has total refunded amount, refunds made by refundPayment are recorded already
+func (r *Resolvers) applyRefundEvent(tx *sqlx.Tx, payment *Payment, event provider.WebhookEvent) (string, error) {
+	refunded, err := refundedAmount(tx, payment.Id)
+	if err != nil {
+		return "", err
+	}
+
+	amount := event.Data.AmountRefunded - refunded
+	if amount <= 0 {
+		return WebhookIgnored, nil
+	}
+
+	if payment.Status != StatusCaptured && payment.Status != StatusPartiallyRefunded {
+		return "", fmt.Errorf("payment in status %s can not be refunded", payment.Status)
+	}
+
+	if event.Data.AmountRefunded > payment.Amount {
+		return "", fmt.Errorf("refunded amount %d exceeds amount of payment", event.Data.AmountRefunded)
+	}
+
+	// money is returned already, so refund is recorded even when wallet was spent
+	if _, err := r.recordRefund(tx, payment, amount, 0, "webhook "+event.Id, nil, true); err != nil {
+		return "", err
+	}
+
+	return WebhookProcessed, nil
+}
@@ -0,0 +1,184 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+var (
+	//go:embed fonts/DejaVuSans.ttf
+	dejaVuSans []byte
+	//go:embed fonts/DejaVuSans-Bold.ttf
+	dejaVuSansBold []byte
+	//go:embed fonts/DejaVuSansMono.ttf
+	dejaVuSansMono []byte
+)
+
+var fontFiles = []struct {
+	font Font
+	name string
+	data []byte
+}{
+	{Regular, "DejaVuSans", dejaVuSans},
+	{Bold, "DejaVuSans-Bold", dejaVuSansBold},
+	{Mono, "DejaVuSansMono", dejaVuSansMono},
+}
+
+var (
+	parseFonts  sync.Once
+	parsedFonts map[Font]*trueType
+	fontsErr    error
+)
+
+// fonts are parsed once on first use
+func loadFont(font Font) (*trueType, error) {
+	parseFonts.Do(func() {
+		parsedFonts = map[Font]*trueType{}
+		for _, file := range fontFiles {
+			parsed, err := parseTrueType(file.data)
+			if err != nil {
+				fontsErr = fmt.Errorf("font %s: %s", file.name, err)
+				return
+			}
+			parsedFonts[file.font] = parsed
+		}
+	})
+
+	if fontsErr != nil {
+		return nil, fontsErr
+	}
+
+	parsed, ok := parsedFonts[font]
+	if !ok {
+		return nil, fmt.Errorf("unknown font %s", font)
+	}
+
+	return parsed, nil
+}
+
+// glyphs of font which are used in document
+type usedFont struct {
+	font   *trueType
+	name   string
+	glyphs map[uint16]rune
+}
+
+func (u *usedFont) ids() []int {
+	ids := make([]int, 0, len(u.glyphs))
+	for id := range u.glyphs {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// in thousandths of font size, as widths are given in PDF
+func (u *usedFont) width(id uint16) int {
+	return u.font.advances[id] * 1000 / u.font.unitsPerEm
+}
+
+func (u *usedFont) scale(value int) int {
+	return value * 1000 / u.font.unitsPerEm
+}
+
+// subset fonts are named with tag of six letters, the same glyphs give the same tag
+func (u *usedFont) baseName() string {
+	hash := sha256.New()
+	for _, id := range u.ids() {
+		fmt.Fprintf(hash, "%d,", id)
+	}
+	sum := hash.Sum(nil)
+
+	tag := make([]byte, 6)
+	for i := range tag {
+		tag[i] = 'A' + sum[i]%26
+	}
+
+	return string(tag) + "+" + u.name
+}
+
+// number of objects written by usedFont.objects
+const fontObjects = 5
+
+// objects of Type0 font, CIDFont, descriptor, font file and ToUnicode map, first is referenced by pages
+func (u *usedFont) objects(first int) []string {
+	name := u.baseName()
+
+	widths := make([]string, 0, len(u.glyphs))
+	for _, id := range u.ids() {
+		widths = append(widths, fmt.Sprintf("%d [%d]", id, u.width(uint16(id))))
+	}
+
+	font := u.font
+	file := font.subset(u.usedIds())
+	return []string{
+		fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+			name, first+1, first+4),
+		fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /DW %d /W [%s] /CIDToGIDMap /Identity >>",
+			name, first+2, u.width(0), strings.Join(widths, " ")),
+		fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+			name, u.scale(font.bbox[0]), u.scale(font.bbox[1]), u.scale(font.bbox[2]), u.scale(font.bbox[3]),
+			u.scale(font.ascent), u.scale(font.descent), u.scale(font.capHeight), first+3),
+		compressedStream(file, fmt.Sprintf("/Length1 %d", len(file))),
+		stream(u.toUnicode()),
+	}
+}
+
+func (u *usedFont) usedIds() map[uint16]bool {
+	used := make(map[uint16]bool, len(u.glyphs))
+	for id := range u.glyphs {
+		used[id] = true
+	}
+	return used
+}
+
+// CMap which maps glyph ids back to text, so it can be copied and searched
+func (u *usedFont) toUnicode() string {
+	var out strings.Builder
+	out.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	out.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	out.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	out.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+
+	ids := u.ids()
+	// at most 100 mappings in one block
+	for start := 0; start < len(ids); start += 100 {
+		end := start + 100
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		fmt.Fprintf(&out, "%d beginbfchar\n", end-start)
+		for _, id := range ids[start:end] {
+			fmt.Fprintf(&out, "<%04X> <", id)
+			for _, unit := range utf16.Encode([]rune{u.glyphs[uint16(id)]}) {
+				fmt.Fprintf(&out, "%04X", unit)
+			}
+			out.WriteString(">\n")
+		}
+		out.WriteString("endbfchar\n")
+	}
+
+	out.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return out.String()
+}
+
+func stream(content string) string {
+	return fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+}
+
+func compressedStream(content []byte, entries string) string {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write(content)
+	writer.Close()
+
+	return fmt.Sprintf("<< /Length %d /Filter /FlateDecode %s >>\nstream\n%s\nendstream", compressed.Len(), entries, compressed.String())
+}
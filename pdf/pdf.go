@@ -0,0 +1,217 @@
+// Package pdf writes simple PDF documents with text and lines.
+// Fonts are embedded as subsets of DejaVu fonts, so text in most scripts is shown as is.
+// Text with characters which are missing in font is not written, WriteTo returns error.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// A4 in points
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+type Font string
+
+const (
+	Regular Font = "F1"
+	Bold    Font = "F2"
+	Mono    Font = "F3"
+)
+
+type Document struct {
+	title string
+	pages []*Page
+	fonts map[Font]*usedFont
+	// the first error of text, document is not written with it
+	err error
+}
+
+// coordinates are in points from the top left corner of the page
+type Page struct {
+	document *Document
+	content  bytes.Buffer
+}
+
+func New(title string) *Document {
+	return &Document{title: title, fonts: map[Font]*usedFont{}}
+}
+
+func (d *Document) AddPage() *Page {
+	page := &Page{document: d}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// glyph ids of text in font, which are added to subset of font
+func (d *Document) glyphs(font Font, text string) ([]uint16, *usedFont, error) {
+	used, ok := d.fonts[font]
+	if !ok {
+		parsed, err := loadFont(font)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, file := range fontFiles {
+			if file.font == font {
+				used = &usedFont{font: parsed, name: file.name, glyphs: map[uint16]rune{}}
+			}
+		}
+		d.fonts[font] = used
+	}
+
+	runes := []rune(text)
+	ids := make([]uint16, len(runes))
+	for i, r := range runes {
+		id, ok := used.font.cmap[r]
+		if !ok {
+			return nil, nil, fmt.Errorf("font %s has no glyph for %q", used.name, r)
+		}
+		ids[i] = id
+	}
+
+	// text of glyph for ToUnicode, the first character wins when several share glyph
+	for i, id := range ids {
+		if _, ok := used.glyphs[id]; !ok {
+			used.glyphs[id] = runes[i]
+		}
+	}
+
+	return ids, used, nil
+}
+
+func (p *Page) Text(font Font, size float64, x float64, y float64, text string) {
+	ids, _, err := p.document.glyphs(font, text)
+	if err != nil {
+		p.document.fail(err)
+		return
+	}
+
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td <%s> Tj ET\n",
+		font, number(size), number(x), number(PageHeight-y), hexGlyphs(ids))
+}
+
+// text in Mono font which ends at x
+func (p *Page) TextRight(size float64, x float64, y float64, text string) {
+	ids, used, err := p.document.glyphs(Mono, text)
+	if err != nil {
+		p.document.fail(err)
+		return
+	}
+
+	width := 0
+	for _, id := range ids {
+		width += used.width(id)
+	}
+	p.Text(Mono, size, x-float64(width)*size/1000, y, text)
+}
+
+func (p *Page) Line(x1 float64, y1 float64, x2 float64, y2 float64, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n",
+		number(width), number(x1), number(PageHeight-y1), number(x2), number(PageHeight-y2))
+}
+
+func (d *Document) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// write document, output is the same for the same content
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+
+	// objects are numbered from 1 in order of writing
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	pages := d.pages
+	if len(pages) == 0 {
+		pages = []*Page{{}}
+	}
+
+	// catalog, page tree, objects of used fonts and info come first, then page and its content
+	var fonts []*usedFont
+	var resources []string
+	for _, file := range fontFiles {
+		if used, ok := d.fonts[file.font]; ok && len(used.glyphs) > 0 {
+			resources = append(resources, fmt.Sprintf("/%s %d 0 R", file.font, 3+len(fonts)*fontObjects))
+			fonts = append(fonts, used)
+		}
+	}
+
+	firstPage := 3 + len(fonts)*fontObjects + 1
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+i*2)
+	}
+
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+
+	for _, font := range fonts {
+		for _, body := range font.objects(len(offsets) + 1) {
+			object(body)
+		}
+	}
+
+	object(fmt.Sprintf("<< /Title %s /Producer (go-graphql-location) >>", textString(d.title)))
+	info := len(offsets)
+
+	for i, page := range pages {
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			number(PageWidth), number(PageHeight), strings.Join(resources, " "), firstPage+i*2+1,
+		))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.content.Len(), page.content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, info, xref)
+
+	return out.WriteTo(w)
+}
+
+func number(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// two bytes per glyph for Identity-H encoding
+func hexGlyphs(ids []uint16) string {
+	var out strings.Builder
+	for _, id := range ids {
+		fmt.Fprintf(&out, "%04X", id)
+	}
+	return out.String()
+}
+
+// text outside of content stream, e.g. title, in UTF-16 with byte order mark
+func textString(text string) string {
+	var out strings.Builder
+	out.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&out, "%04X", unit)
+	}
+	out.WriteString(">")
+	return out.String()
+}
@@ -0,0 +1,98 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTextIsEmbedded(t *testing.T) {
+	document := New("Счёт ₽")
+	page := document.AddPage()
+	page.Text(Regular, 10, 50, 50, "Иван Петров, zł €")
+	page.Text(Bold, 10, 50, 70, "ИТОГО")
+	page.TextRight(10, 500, 90, "1 499,00 ₽")
+
+	var first, second bytes.Buffer
+	if _, err := document.WriteTo(&first); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if _, err := document.WriteTo(&second); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatalf("output differs for the same content")
+	}
+
+	output := first.String()
+	for _, want := range []string{
+		"/Subtype /Type0", "/Encoding /Identity-H", "/CIDToGIDMap /Identity", "/FontFile2",
+		"+DejaVuSans ", "+DejaVuSans-Bold ", "+DejaVuSansMono ",
+		// ToUnicode maps glyphs back to И, ₽ and ł
+		"<0418>", "<20BD>", "<0142>",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output has no %q", want)
+		}
+	}
+}
+
+func TestTextWithoutGlyph(t *testing.T) {
+	document := New("Invoice")
+	page := document.AddPage()
+	page.Text(Regular, 10, 50, 50, "Name")
+	page.Text(Regular, 10, 50, 70, "王小明")
+	page.Text(Regular, 10, 50, 90, "Amount")
+
+	var output bytes.Buffer
+	_, err := document.WriteTo(&output)
+	if err == nil || err.Error() != `font DejaVuSans has no glyph for '王'` {
+		t.Fatalf("got error %v, want missing glyph", err)
+	}
+
+	if output.Len() != 0 {
+		t.Fatalf("document is written with missing text")
+	}
+}
+
+func TestSubset(t *testing.T) {
+	font, err := loadFont(Regular)
+	if err != nil {
+		t.Fatalf("loadFont: %v", err)
+	}
+
+	used := map[uint16]bool{}
+	for _, r := range "Жй₽" {
+		used[font.cmap[r]] = true
+	}
+
+	subset, err := parseTrueType(font.subset(used))
+	if err != nil {
+		t.Fatalf("subset can not be parsed: %v", err)
+	}
+
+	if subset.numGlyphs != font.numGlyphs {
+		t.Fatalf("got %d glyphs, want the same ids as in font %d", subset.numGlyphs, font.numGlyphs)
+	}
+
+	if len(subset.tables["glyf"]) >= len(font.tables["glyf"])/10 {
+		t.Fatalf("subset keeps %d of %d bytes of glyphs", len(subset.tables["glyf"]), len(font.tables["glyf"]))
+	}
+
+	// glyphs are padded to four bytes
+	for id := range used {
+		if !bytes.HasPrefix(subset.glyph(id), font.glyph(id)) {
+			t.Errorf("glyph %d differs in subset", id)
+		}
+	}
+
+	// unused glyphs are empty
+	if unused := font.cmap['A']; len(subset.glyph(unused)) != 0 {
+		t.Errorf("unused glyph is kept")
+	}
+
+	if checksum(font.subset(used)) != 0xb1b0afba {
+		t.Errorf("checksum adjustment of head is wrong")
+	}
+}
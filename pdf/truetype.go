@@ -0,0 +1,357 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// parsed TrueType font, only tables which are needed for widths, cmap and subsets are read
+type trueType struct {
+	tables map[string][]byte
+
+	unitsPerEm int
+	bbox       [4]int
+	ascent     int
+	descent    int
+	capHeight  int
+
+	numGlyphs int
+	advances  []int
+	// offsets of glyphs in glyf, glyph i is glyf[offsets[i]:offsets[i+1]]
+	offsets []int
+	cmap    map[rune]uint16
+}
+
+// tables which are kept in subset, glyphs are taken by id but some readers require cmap as well
+var subsetTables = []string{"OS/2", "cmap", "cvt ", "fpgm", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "post", "prep"}
+
+func parseTrueType(data []byte) (*trueType, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("font is too short")
+	}
+
+	font := &trueType{tables: map[string][]byte{}}
+	count := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+count*16 {
+		return nil, fmt.Errorf("font table directory is truncated")
+	}
+
+	for i := 0; i < count; i++ {
+		record := data[12+i*16:]
+		tag := string(record[:4])
+		offset := int(binary.BigEndian.Uint32(record[8:]))
+		length := int(binary.BigEndian.Uint32(record[12:]))
+		if offset+length > len(data) {
+			return nil, fmt.Errorf("font table %s is truncated", tag)
+		}
+		font.tables[tag] = data[offset : offset+length]
+	}
+
+	for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "loca", "glyf", "cmap"} {
+		if _, ok := font.tables[tag]; !ok {
+			return nil, fmt.Errorf("font has no %s table", tag)
+		}
+	}
+
+	head := font.tables["head"]
+	font.unitsPerEm = int(binary.BigEndian.Uint16(head[18:]))
+	for i := range font.bbox {
+		font.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+i*2:])))
+	}
+	longOffsets := binary.BigEndian.Uint16(head[50:]) == 1
+
+	hhea := font.tables["hhea"]
+	font.ascent = int(int16(binary.BigEndian.Uint16(hhea[4:])))
+	font.descent = int(int16(binary.BigEndian.Uint16(hhea[6:])))
+	metrics := int(binary.BigEndian.Uint16(hhea[34:]))
+
+	font.capHeight = font.ascent
+	if os2 := font.tables["OS/2"]; len(os2) >= 90 && binary.BigEndian.Uint16(os2) >= 2 {
+		font.capHeight = int(int16(binary.BigEndian.Uint16(os2[88:])))
+	}
+
+	font.numGlyphs = int(binary.BigEndian.Uint16(font.tables["maxp"][4:]))
+
+	// glyphs after the last long metric have its advance
+	hmtx := font.tables["hmtx"]
+	if metrics == 0 || len(hmtx) < metrics*4 {
+		return nil, fmt.Errorf("font hmtx table is truncated")
+	}
+	font.advances = make([]int, font.numGlyphs)
+	for i := range font.advances {
+		metric := i
+		if metric >= metrics {
+			metric = metrics - 1
+		}
+		font.advances[i] = int(binary.BigEndian.Uint16(hmtx[metric*4:]))
+	}
+
+	loca := font.tables["loca"]
+	font.offsets = make([]int, font.numGlyphs+1)
+	for i := range font.offsets {
+		if longOffsets {
+			if len(loca) < (i+1)*4 {
+				return nil, fmt.Errorf("font loca table is truncated")
+			}
+			font.offsets[i] = int(binary.BigEndian.Uint32(loca[i*4:]))
+		} else {
+			if len(loca) < (i+1)*2 {
+				return nil, fmt.Errorf("font loca table is truncated")
+			}
+			font.offsets[i] = int(binary.BigEndian.Uint16(loca[i*2:])) * 2
+		}
+	}
+	if font.offsets[font.numGlyphs] > len(font.tables["glyf"]) {
+		return nil, fmt.Errorf("font glyf table is truncated")
+	}
+
+	cmap, err := parseCmap(font.tables["cmap"])
+	if err != nil {
+		return nil, err
+	}
+	font.cmap = cmap
+
+	return font, nil
+}
+
+// characters of Unicode cmap, format 12 covers characters outside of BMP as well
+func parseCmap(table []byte) (map[rune]uint16, error) {
+	if len(table) < 4 {
+		return nil, fmt.Errorf("font cmap table is truncated")
+	}
+
+	var best []byte
+	bestFormat := uint16(0)
+	count := int(binary.BigEndian.Uint16(table[2:]))
+	for i := 0; i < count && len(table) >= 4+(i+1)*8; i++ {
+		record := table[4+i*8:]
+		platform, encoding := binary.BigEndian.Uint16(record), binary.BigEndian.Uint16(record[2:])
+		offset := int(binary.BigEndian.Uint32(record[4:]))
+		unicode := platform == 0 || (platform == 3 && (encoding == 1 || encoding == 10))
+		if !unicode || offset+2 > len(table) {
+			continue
+		}
+
+		format := binary.BigEndian.Uint16(table[offset:])
+		if (format == 4 || format == 12) && format > bestFormat {
+			best, bestFormat = table[offset:], format
+		}
+	}
+
+	cmap := map[rune]uint16{}
+	switch bestFormat {
+	case 4:
+		if len(best) < 14 {
+			return nil, fmt.Errorf("font cmap subtable is truncated")
+		}
+		segments := int(binary.BigEndian.Uint16(best[6:])) / 2
+		if len(best) < 16+segments*8 {
+			return nil, fmt.Errorf("font cmap subtable is truncated")
+		}
+		ends, starts := best[14:], best[16+segments*2:]
+		deltas, rangeOffsets := best[16+segments*4:], best[16+segments*6:]
+
+		for i := 0; i < segments; i++ {
+			end := int(binary.BigEndian.Uint16(ends[i*2:]))
+			start := int(binary.BigEndian.Uint16(starts[i*2:]))
+			delta := binary.BigEndian.Uint16(deltas[i*2:])
+			rangeOffset := int(binary.BigEndian.Uint16(rangeOffsets[i*2:]))
+
+			for c := start; c <= end && c != 0xffff; c++ {
+				glyph := uint16(c) + delta
+				if rangeOffset != 0 {
+					// offset is relative to position of rangeOffset itself
+					position := 16 + segments*6 + i*2 + rangeOffset + (c-start)*2
+					if position+2 > len(best) {
+						return nil, fmt.Errorf("font cmap subtable is truncated")
+					}
+					glyph = binary.BigEndian.Uint16(best[position:])
+					if glyph != 0 {
+						glyph += delta
+					}
+				}
+				if glyph != 0 {
+					cmap[rune(c)] = glyph
+				}
+			}
+		}
+	case 12:
+		if len(best) < 16 {
+			return nil, fmt.Errorf("font cmap subtable is truncated")
+		}
+		groups := int(binary.BigEndian.Uint32(best[12:]))
+		if len(best) < 16+groups*12 {
+			return nil, fmt.Errorf("font cmap subtable is truncated")
+		}
+		for i := 0; i < groups; i++ {
+			group := best[16+i*12:]
+			start, end := binary.BigEndian.Uint32(group), binary.BigEndian.Uint32(group[4:])
+			glyph := binary.BigEndian.Uint32(group[8:])
+			for c := start; c <= end && c <= 0x10ffff; c++ {
+				cmap[rune(c)] = uint16(glyph + c - start)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("font has no unicode cmap")
+	}
+
+	return cmap, nil
+}
+
+func (font *trueType) glyph(id uint16) []byte {
+	return font.tables["glyf"][font.offsets[id]:font.offsets[id+1]]
+}
+
+// components of composite glyph, which have to be kept in subset with it
+func (font *trueType) components(id uint16) []uint16 {
+	glyph := font.glyph(id)
+	if len(glyph) < 10 || int16(binary.BigEndian.Uint16(glyph)) >= 0 {
+		return nil
+	}
+
+	const (
+		argsAreWords = 0x0001
+		haveScale    = 0x0008
+		moreFollow   = 0x0020
+		haveXYScale  = 0x0040
+		haveTwoByTwo = 0x0080
+	)
+
+	var components []uint16
+	for position := 10; position+4 <= len(glyph); {
+		flags := binary.BigEndian.Uint16(glyph[position:])
+		components = append(components, binary.BigEndian.Uint16(glyph[position+2:]))
+
+		position += 4
+		if flags&argsAreWords != 0 {
+			position += 4
+		} else {
+			position += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			position += 2
+		case flags&haveXYScale != 0:
+			position += 4
+		case flags&haveTwoByTwo != 0:
+			position += 8
+		}
+
+		if flags&moreFollow == 0 {
+			break
+		}
+	}
+
+	return components
+}
+
+// font with the same glyph ids which has data of used glyphs only, so text is drawn
+// with ids as CIDs and CIDToGIDMap is Identity
+func (font *trueType) subset(used map[uint16]bool) []byte {
+	keep := map[uint16]bool{0: true}
+	queue := []uint16{0}
+	for id := range used {
+		queue = append(queue, id)
+	}
+	for len(queue) > 0 {
+		id := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		keep[id] = true
+		for _, component := range font.components(id) {
+			if !keep[component] && int(component) < font.numGlyphs {
+				queue = append(queue, component)
+			}
+		}
+	}
+
+	var glyf []byte
+	loca := make([]byte, (font.numGlyphs+1)*4)
+	for id := 0; id < font.numGlyphs; id++ {
+		binary.BigEndian.PutUint32(loca[id*4:], uint32(len(glyf)))
+		if keep[uint16(id)] {
+			glyf = append(glyf, font.glyph(uint16(id))...)
+			for len(glyf)%4 != 0 {
+				glyf = append(glyf, 0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(loca[font.numGlyphs*4:], uint32(len(glyf)))
+
+	// long offsets in loca, checksum adjustment is computed over the whole font below
+	head := append([]byte(nil), font.tables["head"]...)
+	binary.BigEndian.PutUint32(head[8:], 0)
+	binary.BigEndian.PutUint16(head[50:], 1)
+
+	tables := map[string][]byte{"glyf": glyf, "loca": loca, "head": head}
+
+	// version 3 of post table has no glyph names
+	if post := font.tables["post"]; len(post) >= 32 {
+		post = append([]byte(nil), post[:32]...)
+		binary.BigEndian.PutUint32(post, 0x00030000)
+		tables["post"] = post
+	}
+	var tags []string
+	for _, tag := range subsetTables {
+		if _, ok := tables[tag]; !ok {
+			table, ok := font.tables[tag]
+			if !ok {
+				continue
+			}
+			tables[tag] = table
+		}
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	out := writeTables(tags, tables)
+
+	headOffset := int(binary.BigEndian.Uint32(out[12+sort.SearchStrings(tags, "head")*16+8:]))
+	binary.BigEndian.PutUint32(out[headOffset+8:], 0xb1b0afba-checksum(out))
+
+	return out
+}
+
+// sfnt file with tables in order of tags, tags have to be sorted
+func writeTables(tags []string, tables map[string][]byte) []byte {
+	count := len(tags)
+	searchRange, selector := 1, 0
+	for searchRange*2 <= count {
+		searchRange *= 2
+		selector++
+	}
+
+	header := make([]byte, 12+count*16)
+	binary.BigEndian.PutUint32(header, 0x00010000)
+	binary.BigEndian.PutUint16(header[4:], uint16(count))
+	binary.BigEndian.PutUint16(header[6:], uint16(searchRange*16))
+	binary.BigEndian.PutUint16(header[8:], uint16(selector))
+	binary.BigEndian.PutUint16(header[10:], uint16(count*16-searchRange*16))
+
+	out := header
+	for i, tag := range tags {
+		table := tables[tag]
+		record := out[12+i*16:]
+		copy(record, tag)
+		binary.BigEndian.PutUint32(record[4:], checksum(table))
+		binary.BigEndian.PutUint32(record[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(record[12:], uint32(len(table)))
+
+		out = append(out, table...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+
+	return out
+}
+
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
@@ -0,0 +1,58 @@
+// Package signedurl creates and verifies links which are valid until expiration time
+// without authorization header, e.g. for downloading files in browser.
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+func (s *Signer) signature(path string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s\n%d", path, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// baseURL + path with expires and signature query parameters
+func (s *Signer) Sign(baseURL string, path string, ttl time.Duration) (string, time.Time) {
+	expiresAt := time.Now().Add(ttl)
+	expires := expiresAt.Unix()
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.signature(path, expires))
+
+	return baseURL + path + "?" + query.Encode(), expiresAt
+}
+
+// check signature and expiration of request path and query
+func (s *Signer) Verify(path string, query url.Values) error {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid link")
+	}
+
+	expected := s.signature(path, expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return fmt.Errorf("invalid link")
+	}
+
+	if time.Now().Unix() > expires {
+		return fmt.Errorf("link is expired")
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type SMSSender interface {
+	// Send text message to phone number in E.164 format
+	Send(ctx context.Context, to string, text string) error
+}
+
+type Config struct {
+	// log or file
+	Backend string `yaml:"backend"`
+	// path of file for "file" backend
+	Path string `yaml:"path"`
+}
+
+// create sender by backend name from config. Empty backend is "log"
+func New(config Config) (SMSSender, error) {
+	switch config.Backend {
+	case "", "log":
+		return &LogSender{}, nil
+	case "file":
+		if config.Path == "" {
+			return nil, fmt.Errorf("file sms backend requires path")
+		}
+		return &FileSender{path: config.Path}, nil
+	}
+
+	return nil, fmt.Errorf("unknown sms backend: %s", config.Backend)
+}
+
+// sender for development, writes messages to the log
+type LogSender struct{}
+
+func (s *LogSender) Send(ctx context.Context, to string, text string) error {
+	log.Printf("sms to=%s: %s", to, text)
+	return nil
+}
+
+// sender for development and tests, appends messages to the file
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (s *FileSender) Send(ctx context.Context, to string, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s\t%s\t%q\n", time.Now().Format(time.RFC3339), to, text)
+	return err
+}
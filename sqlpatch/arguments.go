@@ -0,0 +1,93 @@
+package sqlpatch
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	gqlhandler "github.com/graphql-go/handler"
+)
+
+type variablesKeyType string
+
+// context key of variables as they were sent in request
+const variablesKey variablesKeyType = "variables"
+
+// Value of optional mutation argument
+type Value struct {
+	// argument was passed, with value or null
+	Present bool
+	// argument was explicitly set to null
+	Null  bool
+	Value interface{}
+}
+
+// WithVariables stores variables of request to context. graphql-go sets omitted variables
+// to nil in params.Info.VariableValues, so only sent variables tell omitted from null.
+func WithVariables(ctx context.Context, variables map[string]interface{}) context.Context {
+	return context.WithValue(ctx, variablesKey, variables)
+}
+
+// Variables stores variables of GraphQL request to context for Arg, body is kept for next handler.
+// Multipart requests are skipped, gqlupload stores variables of each operation.
+func Variables(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "unable to read request", http.StatusBadRequest)
+				return
+			}
+			r.Body.Close()
+		}
+
+		// options are parsed from copy of request, form values must not be parsed from original body
+		parsed := r.Clone(r.Context())
+		parsed.Body = ioutil.NopCloser(bytes.NewReader(body))
+		options := gqlhandler.NewRequestOptions(parsed)
+
+		r = r.WithContext(WithVariables(r.Context(), options.Variables))
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Arg distinguishes absent argument from explicit null, both of them are missing in params.Args.
+// graphql-go has no null literal, so null can be passed only by variable: argument refers
+// to variable which is sent with null value. Without variables in context argument is absent.
+func Arg(params graphql.ResolveParams, name string) Value {
+	if value, ok := params.Args[name]; ok {
+		return Value{Present: true, Value: value}
+	}
+
+	var variables map[string]interface{}
+	if params.Context != nil {
+		variables, _ = params.Context.Value(variablesKey).(map[string]interface{})
+	}
+	for _, field := range params.Info.FieldASTs {
+		for _, argument := range field.Arguments {
+			if argument.Name == nil || argument.Name.Value != name {
+				continue
+			}
+
+			if variable, ok := argument.Value.(*ast.Variable); ok && variable.Name != nil {
+				if value, ok := variables[variable.Name.Value]; ok && value == nil {
+					return Value{Present: true, Null: true}
+				}
+			}
+		}
+	}
+
+	return Value{}
+}
@@ -0,0 +1,93 @@
+package sqlpatch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	gqlhandler "github.com/graphql-go/handler"
+)
+
+func TestArg(t *testing.T) {
+	var got Value
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"update": &graphql.Field{
+					Type: graphql.String,
+					Args: graphql.FieldConfigArgument{
+						"phone": &graphql.ArgumentConfig{Type: graphql.String},
+					},
+					Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+						got = Arg(params, "phone")
+						return "ok", nil
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("NewSchema: %v", err)
+	}
+
+	handler := Variables(gqlhandler.New(&gqlhandler.Config{Schema: &schema}))
+
+	tests := []struct {
+		name string
+		body string
+		want Value
+	}{
+		{
+			name: "literal",
+			body: `{"query": "{ update(phone: \"+79990001122\") }"}`,
+			want: Value{Present: true, Value: "+79990001122"},
+		},
+		{
+			name: "variable with value",
+			body: `{"query": "query($phone: String) { update(phone: $phone) }", "variables": {"phone": "+79990001122"}}`,
+			want: Value{Present: true, Value: "+79990001122"},
+		},
+		{
+			name: "variable with null",
+			body: `{"query": "query($phone: String) { update(phone: $phone) }", "variables": {"phone": null}}`,
+			want: Value{Present: true, Null: true},
+		},
+		{
+			name: "omitted variable",
+			body: `{"query": "query($phone: String) { update(phone: $phone) }", "variables": {}}`,
+			want: Value{},
+		},
+		{
+			name: "without variables",
+			body: `{"query": "query($phone: String) { update(phone: $phone) }"}`,
+			want: Value{},
+		},
+		{
+			name: "omitted argument",
+			body: `{"query": "{ update }"}`,
+			want: Value{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got = Value{Value: "not resolved"}
+
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if !strings.Contains(recorder.Body.String(), `"update":"ok"`) {
+				t.Fatalf("request failed: %s", recorder.Body)
+			}
+
+			if got != test.want {
+				t.Fatalf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
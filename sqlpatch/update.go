@@ -0,0 +1,148 @@
+// Package sqlpatch builds partial UPDATE statements with bind parameters.
+package sqlpatch
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var identifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+type assignment struct {
+	column     string
+	expression string
+	args       []interface{}
+	value      interface{}
+	raw        bool
+}
+
+// Update collects assignments of columns for single table.
+// Values are always passed as bind parameters, nil value is stored as NULL.
+type Update struct {
+	table       string
+	assignments []assignment
+	err         error
+}
+
+func NewUpdate(table string) *Update {
+	u := &Update{table: table}
+	if !identifier.MatchString(table) {
+		u.err = fmt.Errorf("invalid table name: %s", table)
+	}
+
+	return u
+}
+
+// assign value to column, previous assignment of the same column is replaced
+func (u *Update) Set(column string, value interface{}) *Update {
+	return u.add(assignment{column: column, value: value})
+}
+
+// assign SQL expression to column, e.g. NOW(). Expression must be a constant,
+// user input has to be passed as args for ? placeholders
+func (u *Update) SetExpr(column string, expression string, args ...interface{}) *Update {
+	return u.add(assignment{column: column, expression: expression, args: args, raw: true})
+}
+
+func (u *Update) add(value assignment) *Update {
+	if !identifier.MatchString(value.column) {
+		u.err = fmt.Errorf("invalid column name: %s", value.column)
+		return u
+	}
+
+	for i := range u.assignments {
+		if u.assignments[i].column == value.column {
+			u.assignments[i] = value
+			return u
+		}
+	}
+
+	u.assignments = append(u.assignments, value)
+	return u
+}
+
+// check if column has assignment
+func (u *Update) Has(column string) bool {
+	for _, value := range u.assignments {
+		if value.column == column {
+			return true
+		}
+	}
+
+	return false
+}
+
+// number of assigned columns
+func (u *Update) Len() int {
+	return len(u.assignments)
+}
+
+// build statement. Condition and returning are SQL with ? placeholders for whereArgs,
+// returning may be empty
+func (u *Update) Build(condition string, returning string, whereArgs ...interface{}) (string, []interface{}, error) {
+	if u.err != nil {
+		return "", nil, u.err
+	}
+
+	if len(u.assignments) == 0 {
+		return "", nil, fmt.Errorf("nothing to update")
+	}
+
+	if condition == "" {
+		return "", nil, fmt.Errorf("update without condition is not allowed")
+	}
+
+	var args []interface{}
+	placeholder := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	// replace ? by numbered placeholders
+	bind := func(expression string, values []interface{}) (string, error) {
+		if count := strings.Count(expression, "?"); count != len(values) {
+			return "", fmt.Errorf("expression %q has %d placeholders for %d arguments", expression, count, len(values))
+		}
+
+		var result strings.Builder
+		index := 0
+		for _, r := range expression {
+			if r == '?' {
+				result.WriteString(placeholder(values[index]))
+				index++
+				continue
+			}
+			result.WriteRune(r)
+		}
+
+		return result.String(), nil
+	}
+
+	sets := make([]string, 0, len(u.assignments))
+	for _, value := range u.assignments {
+		if !value.raw {
+			sets = append(sets, value.column+"="+placeholder(value.value))
+			continue
+		}
+
+		expression, err := bind(value.expression, value.args)
+		if err != nil {
+			return "", nil, err
+		}
+		sets = append(sets, value.column+"="+expression)
+	}
+
+	where, err := bind(condition, whereArgs)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", u.table, strings.Join(sets, ", "), where)
+	if returning != "" {
+		query += " RETURNING " + returning
+	}
+
+	return query, args, nil
+}
@@ -0,0 +1,110 @@
+package sqlpatch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpdateBuild(t *testing.T) {
+	tests := []struct {
+		name      string
+		update    *Update
+		condition string
+		returning string
+		whereArgs []interface{}
+		wantQuery string
+		wantArgs  []interface{}
+		wantErr   string
+	}{
+		{
+			name:      "values and expressions",
+			update:    NewUpdate("users").Set("first_name", "Ivan").Set("phone", nil).SetExpr("updated_at", "NOW()"),
+			condition: "id = ?",
+			whereArgs: []interface{}{1},
+			wantQuery: "UPDATE users SET first_name=$1, phone=$2, updated_at=NOW() WHERE id = $3",
+			wantArgs:  []interface{}{"Ivan", nil, 1},
+		},
+		{
+			name: "expression with arguments",
+			update: NewUpdate("users").Set("phone", "+79990001122").
+				SetExpr("phone_verified_at", "CASE WHEN phone = ? THEN phone_verified_at END", "+79990001122"),
+			condition: "id = ? AND login = ?",
+			returning: "id, phone",
+			whereArgs: []interface{}{1, "user"},
+			wantQuery: "UPDATE users SET phone=$1, phone_verified_at=CASE WHEN phone = $2 THEN phone_verified_at END WHERE id = $3 AND login = $4 RETURNING id, phone",
+			wantArgs:  []interface{}{"+79990001122", "+79990001122", 1, "user"},
+		},
+		{
+			name:      "assignment of the same column is replaced",
+			update:    NewUpdate("users").Set("email", "old@mail.com").SetExpr("updated_at", "NOW()").Set("email", "new@mail.com"),
+			condition: "id = ?",
+			whereArgs: []interface{}{1},
+			wantQuery: "UPDATE users SET email=$1, updated_at=NOW() WHERE id = $2",
+			wantArgs:  []interface{}{"new@mail.com", 1},
+		},
+		{
+			name:      "invalid table",
+			update:    NewUpdate("users; DROP TABLE users").Set("email", "new@mail.com"),
+			condition: "id = ?",
+			whereArgs: []interface{}{1},
+			wantErr:   "invalid table name: users; DROP TABLE users",
+		},
+		{
+			name:      "invalid column",
+			update:    NewUpdate("users").Set("email=NULL--", "new@mail.com"),
+			condition: "id = ?",
+			whereArgs: []interface{}{1},
+			wantErr:   "invalid column name: email=NULL--",
+		},
+		{
+			name:      "nothing to update",
+			update:    NewUpdate("users"),
+			condition: "id = ?",
+			whereArgs: []interface{}{1},
+			wantErr:   "nothing to update",
+		},
+		{
+			name:    "without condition",
+			update:  NewUpdate("users").Set("email", "new@mail.com"),
+			wantErr: "update without condition is not allowed",
+		},
+		{
+			name:      "missing argument of condition",
+			update:    NewUpdate("users").Set("email", "new@mail.com"),
+			condition: "id = ? AND login = ?",
+			whereArgs: []interface{}{1},
+			wantErr:   `expression "id = ? AND login = ?" has 2 placeholders for 1 arguments`,
+		},
+		{
+			name:      "extra argument of expression",
+			update:    NewUpdate("users").SetExpr("updated_at", "NOW()", "2024-01-01"),
+			condition: "id = ?",
+			whereArgs: []interface{}{1},
+			wantErr:   `expression "NOW()" has 0 placeholders for 1 arguments`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, args, err := test.update.Build(test.condition, test.returning, test.whereArgs...)
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("got error %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+
+			if query != test.wantQuery {
+				t.Fatalf("got query %s, want %s", query, test.wantQuery)
+			}
+
+			if !reflect.DeepEqual(args, test.wantArgs) {
+				t.Fatalf("got args %v, want %v", args, test.wantArgs)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package subscriptions
+
+import "github.com/graphql-go/graphql"
+
+type Arguments struct {
+	Subscribe  graphql.FieldConfigArgument
+	ChangePlan graphql.FieldConfigArgument
+}
+
+func GetArguments() Arguments {
+	return Arguments{
+		Subscribe:  subscribeArgs,
+		ChangePlan: changePlanArgs,
+	}
+}
+
+var subscribeArgs = graphql.FieldConfigArgument{
+	"plan": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "Code of plan",
+	},
+}
+
+var changePlanArgs = graphql.FieldConfigArgument{
+	"plan": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "Code of new plan in the same currency",
+	},
+}
@@ -0,0 +1,309 @@
+package subscriptions
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/invoices"
+	"github.com/Moranilt/go-graphql-location/ledger"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ledger account which receives money for subscriptions
+const revenueAccount = "subscriptions"
+
+type BillingReport struct {
+	Renewed   int
+	Charged   int
+	Failed    int
+	Cancelled int
+	Expired   int
+}
+
+func insertCharge(tx *sqlx.Tx, subscription *Subscription, plan *Plan, kind string, amount int64, start time.Time, end time.Time) (*Charge, error) {
+	var charge Charge
+	err := tx.Get(&charge,
+		`INSERT INTO subscription_charges (subscription_id, plan_id, kind, amount, currency, period_start, period_end, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *`,
+		subscription.Id, plan.Id, kind, amount, plan.Currency, start, end, ChargePending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &charge, nil
+}
+
+// take charge from wallet and issue invoice for it, negative charge is returned to wallet.
+// ledger.ErrInsufficientFunds is returned when wallet has not enough money.
+func (r *Resolvers) pay(tx *sqlx.Tx, subscription *Subscription, charge *Charge, now time.Time) error {
+	reference := fmt.Sprintf("subscription_charge:%d", charge.Id)
+	description := fmt.Sprintf("Subscription %d, %s charge %d", subscription.Id, charge.Kind, charge.Id)
+	revenue := ledger.Revenue(revenueAccount, charge.Currency)
+
+	var err error
+	switch {
+	case charge.Amount > 0:
+		err = ledger.Charge(tx, reference, description, subscription.UserId, revenue, charge.Amount)
+	case charge.Amount < 0:
+		err = ledger.Transfer(tx, reference, description, revenue, ledger.UserWallet(subscription.UserId, charge.Currency), -charge.Amount)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE subscription_charges SET status=$2, attempts=attempts+1, paid_at=$3, next_attempt_at=NULL, failure=NULL
+		WHERE id=$1`,
+		charge.Id, ChargePaid, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	return r.issueInvoice(tx, subscription, charge)
+}
+
+// invoice of paid charge, credit of unused time is not a sale and has no invoice
+func (r *Resolvers) issueInvoice(tx *sqlx.Tx, subscription *Subscription, charge *Charge) error {
+	if r.invoices == nil || charge.Amount <= 0 {
+		return nil
+	}
+
+	plan, err := planById(tx, charge.PlanId)
+	if err != nil {
+		return err
+	}
+
+	period := charge.PeriodStart.Format("2006-01-02") + " to " + charge.PeriodEnd.Format("2006-01-02")
+	description := fmt.Sprintf("Subscription %s, %s", plan.Name, period)
+	if charge.Kind == ChargeProration {
+		description = fmt.Sprintf("Change of subscription to %s, %s", plan.Name, period)
+	}
+
+	_, err = r.invoices.Issue(tx, invoices.Source{
+		SubscriptionChargeId: &charge.Id,
+		UserId:               &subscription.UserId,
+		Description:          description,
+		Amount:               charge.Money(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to issue invoice: %s", err)
+	}
+
+	return nil
+}
+
+// store failed attempt and schedule next one, subscription expires after the last attempt
+func (r *Resolvers) fail(tx *sqlx.Tx, subscription *Subscription, charge *Charge, now time.Time, reason error) (bool, error) {
+	attempts := charge.Attempts + 1
+
+	var nextAttempt *time.Time
+	status := StatusPastDue
+	if attempts > len(r.retrySchedule) {
+		status = StatusExpired
+	} else {
+		next := now.Add(r.retrySchedule[attempts-1])
+		nextAttempt = &next
+	}
+
+	_, err := tx.Exec(
+		"UPDATE subscription_charges SET status=$2, attempts=$3, next_attempt_at=$4, failure=$5 WHERE id=$1",
+		charge.Id, ChargeFailed, attempts, nextAttempt, reason.Error(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec("UPDATE subscriptions SET status=$2, updated_at=$3 WHERE id=$1", subscription.Id, status, now)
+	return status == StatusExpired, err
+}
+
+func (r *Resolvers) RunBilling(ctx context.Context) (*BillingReport, error) {
+	report := &BillingReport{}
+	now := time.Now().UTC()
+	failures := 0
+
+	var subscriptionIds []uint64
+	err := r.pgsql.SelectContext(ctx, &subscriptionIds,
+		"SELECT id FROM subscriptions WHERE status = ANY($1) AND current_period_end <= $2 ORDER BY id",
+		pq.Array([]string{StatusTrialing, StatusActive}), now,
+	)
+	if err != nil {
+		return report, err
+	}
+
+	for _, subscriptionId := range subscriptionIds {
+		if err := r.renew(ctx, subscriptionId, now, report); err != nil {
+			failures++
+			log.Printf("renewal of subscription %d failed: %s", subscriptionId, err)
+		}
+	}
+
+	var chargeIds []uint64
+	err = r.pgsql.SelectContext(ctx, &chargeIds,
+		"SELECT id FROM subscription_charges WHERE status=$1 AND next_attempt_at <= $2 ORDER BY id",
+		ChargeFailed, now,
+	)
+	if err != nil {
+		return report, err
+	}
+
+	for _, chargeId := range chargeIds {
+		if err := r.retry(ctx, chargeId, now, report); err != nil {
+			failures++
+			log.Printf("retry of subscription charge %d failed: %s", chargeId, err)
+		}
+	}
+
+	if failures > 0 {
+		return report, fmt.Errorf("%d subscriptions were not billed", failures)
+	}
+
+	return report, nil
+}
+
+// cancel subscription or start next period and charge it
+func (r *Resolvers) renew(ctx context.Context, subscriptionId uint64, now time.Time, report *BillingReport) error {
+	tx, err := r.pgsql.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// another instance could renew it since select
+	var subscription Subscription
+	err = tx.Get(&subscription,
+		"SELECT * FROM subscriptions WHERE id=$1 AND status = ANY($2) AND current_period_end <= $3 FOR UPDATE SKIP LOCKED",
+		subscriptionId, pq.Array([]string{StatusTrialing, StatusActive}), now,
+	)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if subscription.CancelAtPeriodEnd {
+		_, err := tx.Exec(
+			"UPDATE subscriptions SET status=$2, cancelled_at=current_period_end, updated_at=$3 WHERE id=$1",
+			subscription.Id, StatusCancelled, now,
+		)
+		if err != nil {
+			return err
+		}
+		report.Cancelled++
+		return tx.Commit()
+	}
+
+	plan, err := planById(tx, subscription.PlanId)
+	if err != nil {
+		return err
+	}
+
+	start := subscription.CurrentPeriodEnd
+	end := plan.PeriodEnd(start)
+
+	err = tx.Get(&subscription,
+		`UPDATE subscriptions SET status=$2, current_period_start=$3, current_period_end=$4, updated_at=$5
+		WHERE id=$1 RETURNING *`,
+		subscription.Id, StatusActive, start, end, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	charge, err := insertCharge(tx, &subscription, plan, ChargeRenewal, plan.Price, start, end)
+	if err != nil {
+		return err
+	}
+
+	report.Renewed++
+	if err := r.settle(tx, &subscription, charge, now, report); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// next attempt of failed charge
+func (r *Resolvers) retry(ctx context.Context, chargeId uint64, now time.Time, report *BillingReport) error {
+	tx, err := r.pgsql.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var charge Charge
+	err = tx.Get(&charge,
+		"SELECT * FROM subscription_charges WHERE id=$1 AND status=$2 AND next_attempt_at <= $3 FOR UPDATE SKIP LOCKED",
+		chargeId, ChargeFailed, now,
+	)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var subscription Subscription
+	err = tx.Get(&subscription, "SELECT * FROM subscriptions WHERE id=$1 FOR UPDATE", charge.SubscriptionId)
+	if err != nil {
+		return err
+	}
+
+	// subscription was cancelled while charge was failing
+	if subscription.Status != StatusPastDue {
+		_, err := tx.Exec("UPDATE subscription_charges SET next_attempt_at=NULL WHERE id=$1", charge.Id)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if err := r.settle(tx, &subscription, &charge, now, report); err != nil {
+		return err
+	}
+
+	if subscription.Status != StatusActive {
+		return tx.Commit()
+	}
+
+	_, err = tx.Exec("UPDATE subscriptions SET status=$2, updated_at=$3 WHERE id=$1", subscription.Id, StatusActive, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// pay charge or store failure when wallet has not enough money
+func (r *Resolvers) settle(tx *sqlx.Tx, subscription *Subscription, charge *Charge, now time.Time, report *BillingReport) error {
+	err := r.pay(tx, subscription, charge, now)
+	if err == nil {
+		report.Charged++
+		subscription.Status = StatusActive
+		return nil
+	}
+
+	if err != ledger.ErrInsufficientFunds {
+		return err
+	}
+
+	expired, err := r.fail(tx, subscription, charge, now, err)
+	if err != nil {
+		return err
+	}
+
+	report.Failed++
+	subscription.Status = StatusPastDue
+	if expired {
+		report.Expired++
+		subscription.Status = StatusExpired
+	}
+
+	return nil
+}
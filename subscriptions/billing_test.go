@@ -0,0 +1,114 @@
+package subscriptions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/db/dbtest"
+	"github.com/Moranilt/go-graphql-location/invoices"
+	"github.com/Moranilt/go-graphql-location/ledger"
+	"github.com/jmoiron/sqlx"
+)
+
+// user from seed of db/users.sql
+const testUserId = 1
+
+func TestPayIssuesInvoice(t *testing.T) {
+	db := dbtest.Open(t)
+	r := GetResolvers(db, nil, Options{
+		Invoices: invoices.GetResolvers(db, nil, invoices.Options{Config: invoices.Config{Prefix: "INV", TaxName: "VAT", TaxRate: 2000}}),
+	})
+	now := time.Now().UTC()
+
+	tx := db.MustBegin()
+	defer tx.Rollback()
+
+	err := ledger.Transfer(tx, "test:top-up", "Top-up", ledger.ProviderFunds("mock", "USD"), ledger.UserWallet(testUserId, "USD"), 2000)
+	if err != nil {
+		t.Fatalf("top-up: %v", err)
+	}
+
+	plan, err := activePlan(tx, "pro")
+	if err != nil {
+		t.Fatalf("activePlan: %v", err)
+	}
+
+	var subscription Subscription
+	err = tx.Get(&subscription,
+		`INSERT INTO subscriptions (user_id, plan_id, status, current_period_start, current_period_end, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $4, $4) RETURNING *`,
+		testUserId, plan.Id, StatusActive, now, plan.PeriodEnd(now),
+	)
+	if err != nil {
+		t.Fatalf("insert subscription: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		kind        string
+		amount      int64
+		wantInvoice bool
+	}{
+		{name: "initial", kind: ChargeInitial, amount: plan.Price, wantInvoice: true},
+		{name: "upgrade", kind: ChargeProration, amount: 300, wantInvoice: true},
+		{name: "credit of downgrade", kind: ChargeProration, amount: -500},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			charge, err := insertCharge(tx, &subscription, plan, test.kind, test.amount, now, plan.PeriodEnd(now))
+			if err != nil {
+				t.Fatalf("insertCharge: %v", err)
+			}
+
+			if err := r.pay(tx, &subscription, charge, now); err != nil {
+				t.Fatalf("pay: %v", err)
+			}
+
+			invoice, err := invoices.ForSubscriptionCharge(tx, charge.Id)
+			if err != nil {
+				t.Fatalf("ForSubscriptionCharge: %v", err)
+			}
+
+			if !test.wantInvoice {
+				if invoice != nil {
+					t.Fatalf("got invoice %s for credit", invoice.Number)
+				}
+				return
+			}
+
+			if invoice == nil {
+				t.Fatalf("invoice is not issued")
+			}
+
+			if invoice.Total != test.amount || invoice.PaymentId != nil || invoice.UserId == nil || *invoice.UserId != testUserId {
+				t.Fatalf("got invoice %+v, want total %d of user %d", invoice, test.amount, testUserId)
+			}
+		})
+	}
+
+	// unpaid charge has no invoice
+	charge, err := insertCharge(tx, &subscription, plan, ChargeRenewal, plan.Price, now, plan.PeriodEnd(now))
+	if err != nil {
+		t.Fatalf("insertCharge: %v", err)
+	}
+
+	if err := r.pay(tx, &subscription, charge, now); err != ledger.ErrInsufficientFunds {
+		t.Fatalf("got error %v, want %v", err, ledger.ErrInsufficientFunds)
+	}
+
+	checkInvoices(t, tx, 2)
+}
+
+func checkInvoices(t *testing.T, tx *sqlx.Tx, want int) {
+	t.Helper()
+
+	var count int
+	if err := tx.Get(&count, "SELECT COUNT(*) FROM invoices WHERE subscription_charge_id IS NOT NULL"); err != nil {
+		t.Fatalf("count invoices: %v", err)
+	}
+
+	if count != want {
+		t.Fatalf("got %d invoices, want %d", count, want)
+	}
+}
@@ -0,0 +1,355 @@
+package subscriptions
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/invoices"
+	"github.com/go-redis/redis/v8"
+	"github.com/graphql-go/graphql"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type Resolverers interface {
+	// active plans ordered by price
+	Plans(graphql.ResolveParams) ([]Plan, error)
+
+	// current subscription of authorized user or the last ended one, empty when user never subscribed
+	Subscription(graphql.ResolveParams) (*Subscription, error)
+
+	// Subscribe authorized user to plan. Plans with trial are charged at the end of trial,
+	// other plans are charged from wallet right away.
+	Subscribe(graphql.ResolveParams) (*Subscription, error)
+
+	// Stop renewal, subscription is cancelled at the end of paid period.
+	// Past due subscription is cancelled immediately.
+	Cancel(graphql.ResolveParams) (*Subscription, error)
+
+	// Switch to another plan in the same currency. Unused time of current plan is credited
+	// and remaining time of new plan is charged, period restarts when interval differs.
+	ChangePlan(graphql.ResolveParams) (*Subscription, error)
+
+	// Renew subscriptions whose period is over and retry failed charges
+	RunBilling(ctx context.Context) (*BillingReport, error)
+}
+
+type Resolvers struct {
+	pgsql         *sqlx.DB
+	RedisClient   *redis.Client
+	auth          *authorization.Config
+	retrySchedule []time.Duration
+	invoices      invoices.Issuer
+}
+
+type Options struct {
+	Auth *authorization.Config
+	// DefaultRetrySchedule when empty
+	RetrySchedule []time.Duration
+	// issues invoice for paid charges, invoices are not issued when nil
+	Invoices invoices.Issuer
+}
+
+// resolvers of Subscription fields, set by GetResolvers
+var fieldResolvers *Resolvers
+
+func GetResolvers(pgsql *sqlx.DB, client *redis.Client, options Options) *Resolvers {
+	retrySchedule := options.RetrySchedule
+	if len(retrySchedule) == 0 {
+		retrySchedule = DefaultRetrySchedule
+	}
+
+	fieldResolvers = &Resolvers{
+		pgsql:         pgsql,
+		RedisClient:   client,
+		auth:          options.Auth,
+		retrySchedule: retrySchedule,
+		invoices:      options.Invoices,
+	}
+	return fieldResolvers
+}
+
+// get id of authorized active user from access token in context
+func (r *Resolvers) currentUserId(params graphql.ResolveParams) (uint64, error) {
+	requestToken, _ := params.Context.Value(authorization.AuthHeaderKey).(string)
+	token, err := authorization.ExtractTokenMetadata(r.auth, requestToken)
+	if err != nil {
+		return 0, err
+	}
+
+	userId, err := authorization.FetchAuth(token, r.RedisClient, params.Context)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := authorization.CheckActive(params.Context, r.pgsql, userId); err != nil {
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+func (r *Resolvers) Plans(params graphql.ResolveParams) ([]Plan, error) {
+	plans := []Plan{}
+	err := r.pgsql.Select(&plans, "SELECT * FROM plans WHERE active ORDER BY price, id")
+	return plans, err
+}
+
+func (r *Resolvers) Subscription(params graphql.ResolveParams) (*Subscription, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscription Subscription
+	err = r.pgsql.Get(&subscription,
+		"SELECT * FROM subscriptions WHERE user_id=$1 ORDER BY status = ANY($2) DESC, id DESC LIMIT 1",
+		userId, pq.Array(liveStatuses),
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+func (r *Resolvers) Subscribe(params graphql.ResolveParams) (*Subscription, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.pgsql.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	plan, err := activePlan(tx, params.Args["plan"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := liveSubscription(tx, userId); err == nil {
+		return nil, fmt.Errorf("user already has subscription")
+	} else if err != errNoSubscription {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	status, end := StatusActive, plan.PeriodEnd(now)
+	var trialEnd *time.Time
+	if plan.TrialDays > 0 {
+		status, end = StatusTrialing, now.AddDate(0, 0, plan.TrialDays)
+		trialEnd = &end
+	}
+
+	var subscription Subscription
+	err = tx.Get(&subscription,
+		`INSERT INTO subscriptions (user_id, plan_id, status, current_period_start, current_period_end, trial_end, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $4, $4) RETURNING *`,
+		userId, plan.Id, status, now, end, trialEnd,
+	)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return nil, fmt.Errorf("user already has subscription")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if status == StatusActive {
+		charge, err := insertCharge(tx, &subscription, plan, ChargeInitial, plan.Price, now, end)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := r.pay(tx, &subscription, charge, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+func (r *Resolvers) Cancel(params graphql.ResolveParams) (*Subscription, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.pgsql.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	subscription, err := liveSubscription(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if subscription.Status == StatusPastDue {
+		// unpaid period is not provided, retries of its charge are stopped
+		err = tx.Get(subscription,
+			"UPDATE subscriptions SET status=$2, cancelled_at=$3, updated_at=$3 WHERE id=$1 RETURNING *",
+			subscription.Id, StatusCancelled, now,
+		)
+		if err == nil {
+			_, err = tx.Exec(
+				"UPDATE subscription_charges SET next_attempt_at=NULL WHERE subscription_id=$1 AND status=$2",
+				subscription.Id, ChargeFailed,
+			)
+		}
+	} else {
+		err = tx.Get(subscription,
+			"UPDATE subscriptions SET cancel_at_period_end=TRUE, updated_at=$2 WHERE id=$1 RETURNING *",
+			subscription.Id, now,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (r *Resolvers) ChangePlan(params graphql.ResolveParams) (*Subscription, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.pgsql.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	subscription, err := liveSubscription(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if subscription.Status == StatusPastDue {
+		return nil, fmt.Errorf("subscription is past due, top up wallet to pay for current period first")
+	}
+
+	current, err := planById(tx, subscription.PlanId)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := activePlan(tx, params.Args["plan"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if plan.Id == current.Id {
+		return nil, fmt.Errorf("subscription already has plan %s", plan.Code)
+	}
+
+	if plan.Currency != current.Currency {
+		return nil, fmt.Errorf("plan %s is sold in %s, current plan in %s", plan.Code, plan.Currency, current.Currency)
+	}
+
+	now := time.Now().UTC()
+	start, end := subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd
+
+	// trial continues on new plan
+	if subscription.Status == StatusActive {
+		total, remaining := end.Sub(start), end.Sub(now)
+		amount := prorate(plan.Price, remaining, total) - prorate(current.Price, remaining, total)
+
+		if plan.Interval != current.Interval || plan.IntervalCount != current.IntervalCount {
+			start, end = now, plan.PeriodEnd(now)
+			amount = plan.Price - prorate(current.Price, remaining, total)
+		}
+
+		if amount != 0 {
+			charge, err := insertCharge(tx, subscription, plan, ChargeProration, amount, now, end)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := r.pay(tx, subscription, charge, now); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = tx.Get(subscription,
+		`UPDATE subscriptions SET plan_id=$2, current_period_start=$3, current_period_end=$4, updated_at=$5
+		WHERE id=$1 RETURNING *`,
+		subscription.Id, plan.Id, start, end, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+var errNoSubscription = fmt.Errorf("user has no active subscription")
+
+// lock subscription of user which is not ended
+func liveSubscription(tx *sqlx.Tx, userId uint64) (*Subscription, error) {
+	var subscription Subscription
+	err := tx.Get(&subscription,
+		"SELECT * FROM subscriptions WHERE user_id=$1 AND status = ANY($2) FOR UPDATE",
+		userId, pq.Array(liveStatuses),
+	)
+	if err == sql.ErrNoRows {
+		return nil, errNoSubscription
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+func activePlan(q sqlx.Queryer, code string) (*Plan, error) {
+	var plan Plan
+	err := sqlx.Get(q, &plan, "SELECT * FROM plans WHERE code=$1 AND active", code)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("plan %s not found", code)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &plan, nil
+}
+
+func planById(q sqlx.Queryer, planId uint64) (*Plan, error) {
+	var plan Plan
+	if err := sqlx.Get(q, &plan, "SELECT * FROM plans WHERE id=$1", planId); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (r *Resolvers) charges(subscriptionId uint64) ([]Charge, error) {
+	charges := []Charge{}
+	err := r.pgsql.Select(&charges, "SELECT * FROM subscription_charges WHERE subscription_id=$1 ORDER BY id DESC", subscriptionId)
+	return charges, err
+}
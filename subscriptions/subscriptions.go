@@ -0,0 +1,148 @@
+// Package subscriptions sells plans which are paid from wallet of user every period.
+// Billing renews subscriptions at period end and retries failed charges by RetrySchedule.
+package subscriptions
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/money"
+)
+
+const (
+	StatusTrialing  = "trialing"
+	StatusActive    = "active"
+	StatusPastDue   = "past_due"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+)
+
+// user can have single subscription in these statuses
+var liveStatuses = []string{StatusTrialing, StatusActive, StatusPastDue}
+
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+	IntervalYear  = "year"
+)
+
+const (
+	ChargeInitial   = "initial"
+	ChargeRenewal   = "renewal"
+	ChargeProration = "proration"
+)
+
+const (
+	ChargePending = "pending"
+	ChargePaid    = "paid"
+	ChargeFailed  = "failed"
+)
+
+// time between runs of billing
+const BillingInterval = 15 * time.Minute
+
+// delays of retries after failed charge, subscription expires when all of them fail
+var DefaultRetrySchedule = []time.Duration{24 * time.Hour, 3 * 24 * time.Hour, 5 * 24 * time.Hour}
+
+type Plan struct {
+	Id   uint64 `json:"id" db:"id"`
+	Code string `json:"code" db:"code"`
+	Name string `json:"name" db:"name"`
+	// minor units of currency for one period
+	Price         int64  `json:"price" db:"price"`
+	Currency      string `json:"currency" db:"currency"`
+	Interval      string `json:"interval" db:"interval"`
+	IntervalCount int    `json:"interval_count" db:"interval_count"`
+	TrialDays     int    `json:"trial_days" db:"trial_days"`
+	// inactive plans are not sold, existing subscriptions are renewed
+	Active    bool      `json:"active" db:"active"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+func (p *Plan) Money() money.Money {
+	return money.Money{Amount: p.Price, Currency: p.Currency}
+}
+
+// end of period which starts at start
+func (p *Plan) PeriodEnd(start time.Time) time.Time {
+	switch p.Interval {
+	case IntervalDay:
+		return start.AddDate(0, 0, p.IntervalCount)
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7*p.IntervalCount)
+	case IntervalYear:
+		return addMonths(start, 12*p.IntervalCount)
+	default:
+		return addMonths(start, p.IntervalCount)
+	}
+}
+
+// same day of later month, day is clamped to the end of shorter month: Jan 31 + 1 month = Feb 28
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+
+	return first.AddDate(0, 0, day-1)
+}
+
+// all times are stored in UTC
+type Subscription struct {
+	Id                 uint64     `json:"id" db:"id"`
+	UserId             uint64     `json:"user_id" db:"user_id"`
+	PlanId             uint64     `json:"plan_id" db:"plan_id"`
+	Status             string     `json:"status" db:"status"`
+	CurrentPeriodStart time.Time  `json:"current_period_start" db:"current_period_start"`
+	CurrentPeriodEnd   time.Time  `json:"current_period_end" db:"current_period_end"`
+	TrialEnd           *time.Time `json:"trial_end" db:"trial_end"`
+	// subscription is cancelled instead of renewal
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end" db:"cancel_at_period_end"`
+	CancelledAt       *time.Time `json:"cancelled_at" db:"cancelled_at"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// money taken from wallet for subscription
+type Charge struct {
+	Id             uint64 `json:"id" db:"id"`
+	SubscriptionId uint64 `json:"subscription_id" db:"subscription_id"`
+	PlanId         uint64 `json:"plan_id" db:"plan_id"`
+	Kind           string `json:"kind" db:"kind"`
+	// minor units, negative for credit of unused time on plan change
+	Amount        int64      `json:"amount" db:"amount"`
+	Currency      string     `json:"currency" db:"currency"`
+	PeriodStart   time.Time  `json:"period_start" db:"period_start"`
+	PeriodEnd     time.Time  `json:"period_end" db:"period_end"`
+	Status        string     `json:"status" db:"status"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at" db:"next_attempt_at"`
+	Failure       *string    `json:"failure" db:"failure"`
+	PaidAt        *time.Time `json:"paid_at" db:"paid_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+func (c *Charge) Money() money.Money {
+	return money.Money{Amount: c.Amount, Currency: c.Currency}
+}
+
+// price of remaining part of period, rounded half up
+func prorate(price int64, remaining time.Duration, total time.Duration) int64 {
+	if remaining <= 0 || total <= 0 {
+		return 0
+	}
+	if remaining >= total {
+		return price
+	}
+
+	// price * remaining overflows int64, durations are in nanoseconds
+	numerator := new(big.Int).Mul(big.NewInt(price), big.NewInt(int64(remaining)))
+	numerator.Mul(numerator, big.NewInt(2))
+	denominator := new(big.Int).Mul(big.NewInt(int64(total)), big.NewInt(2))
+	numerator.Add(numerator, big.NewInt(int64(total)))
+
+	return numerator.Quo(numerator, denominator).Int64()
+}
@@ -0,0 +1,67 @@
+package subscriptions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProrate(t *testing.T) {
+	const day = 24 * time.Hour
+	year := 365 * day
+
+	tests := []struct {
+		name      string
+		price     int64
+		remaining time.Duration
+		total     time.Duration
+		want      int64
+	}{
+		{name: "whole period", price: 1499, remaining: 30 * day, total: 30 * day, want: 1499},
+		{name: "more than period", price: 1499, remaining: 31 * day, total: 30 * day, want: 1499},
+		{name: "half", price: 1000, remaining: 15 * day, total: 30 * day, want: 500},
+		{name: "third rounded down", price: 1000, remaining: 10 * day, total: 30 * day, want: 333},
+		{name: "two thirds rounded up", price: 1000, remaining: 20 * day, total: 30 * day, want: 667},
+		{name: "half of minor unit rounded up", price: 1, remaining: 15 * day, total: 30 * day, want: 1},
+		{name: "less than half of minor unit", price: 1, remaining: 14 * day, total: 30 * day, want: 0},
+		{name: "one second", price: 1499, remaining: time.Second, total: 30 * day, want: 0},
+		{name: "less than second", price: 1000, remaining: 250 * time.Millisecond, total: time.Second, want: 250},
+		{name: "period ended", price: 1499, remaining: 0, total: 30 * day, want: 0},
+		{name: "period ended in past", price: 1499, remaining: -day, total: 30 * day, want: 0},
+		{name: "empty period", price: 1499, remaining: day, total: 0, want: 0},
+		{name: "free plan", price: 0, remaining: 15 * day, total: 30 * day, want: 0},
+		// price * remaining in nanoseconds does not fit int64
+		{name: "large price of long period", price: 1 << 40, remaining: year / 4, total: year, want: 1 << 38},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := prorate(test.price, test.remaining, test.total); got != test.want {
+				t.Fatalf("prorate(%d, %s, %s) = %d, want %d", test.price, test.remaining, test.total, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPeriodEnd(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		interval string
+		count    int
+		want     time.Time
+	}{
+		{interval: IntervalDay, count: 1, want: time.Date(2024, time.February, 1, 10, 0, 0, 0, time.UTC)},
+		{interval: IntervalWeek, count: 2, want: time.Date(2024, time.February, 14, 10, 0, 0, 0, time.UTC)},
+		// day is clamped to the end of shorter month
+		{interval: IntervalMonth, count: 1, want: time.Date(2024, time.February, 29, 10, 0, 0, 0, time.UTC)},
+		{interval: IntervalMonth, count: 3, want: time.Date(2024, time.April, 30, 10, 0, 0, 0, time.UTC)},
+		{interval: IntervalYear, count: 1, want: time.Date(2025, time.January, 31, 10, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		plan := Plan{Interval: test.interval, IntervalCount: test.count}
+		if got := plan.PeriodEnd(start); !got.Equal(test.want) {
+			t.Errorf("%d %s after %s = %s, want %s", test.count, test.interval, start, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package subscriptions
+
+import (
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/invoices"
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/graphql-go/graphql"
+)
+
+type Types struct {
+	Plan         *graphql.Object
+	Subscription *graphql.Object
+}
+
+func GetTypes() Types {
+	return Types{
+		Plan:         planType,
+		Subscription: subscriptionType,
+	}
+}
+
+// time in RFC3339, subscriptions use time.Time because billing calculates periods
+var dateTimeType = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "DateTime",
+	Description: "Time in RFC3339 format",
+	Serialize: func(value interface{}) interface{} {
+		switch value := value.(type) {
+		case time.Time:
+			return value.UTC().Format(time.RFC3339)
+		case *time.Time:
+			if value == nil {
+				return nil
+			}
+			return value.UTC().Format(time.RFC3339)
+		}
+		return nil
+	},
+})
+
+func sourcePlan(params graphql.ResolveParams) *Plan {
+	switch source := params.Source.(type) {
+	case *Plan:
+		return source
+	case Plan:
+		return &source
+	}
+	return nil
+}
+
+func sourceSubscription(params graphql.ResolveParams) *Subscription {
+	switch source := params.Source.(type) {
+	case *Subscription:
+		return source
+	case Subscription:
+		return &source
+	}
+	return nil
+}
+
+var intervalEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "PlanInterval",
+	Values: graphql.EnumValueConfigMap{
+		IntervalDay:   &graphql.EnumValueConfig{Value: IntervalDay},
+		IntervalWeek:  &graphql.EnumValueConfig{Value: IntervalWeek},
+		IntervalMonth: &graphql.EnumValueConfig{Value: IntervalMonth},
+		IntervalYear:  &graphql.EnumValueConfig{Value: IntervalYear},
+	},
+})
+
+var planType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Plan",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"code": &graphql.Field{
+			Type: graphql.String,
+		},
+		"name": &graphql.Field{
+			Type: graphql.String,
+		},
+		"price": &graphql.Field{
+			Type:        money.Type,
+			Description: "Price of one period",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				if plan := sourcePlan(params); plan != nil {
+					return plan.Money(), nil
+				}
+				return nil, nil
+			},
+		},
+		"interval": &graphql.Field{
+			Type: intervalEnum,
+		},
+		"interval_count": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "Number of intervals in period, e.g. 3 months",
+		},
+		"trial_days": &graphql.Field{
+			Type: graphql.Int,
+		},
+	},
+})
+
+var statusEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "SubscriptionStatus",
+	Values: graphql.EnumValueConfigMap{
+		StatusTrialing:  &graphql.EnumValueConfig{Value: StatusTrialing},
+		StatusActive:    &graphql.EnumValueConfig{Value: StatusActive},
+		StatusPastDue:   &graphql.EnumValueConfig{Value: StatusPastDue},
+		StatusCancelled: &graphql.EnumValueConfig{Value: StatusCancelled},
+		StatusExpired:   &graphql.EnumValueConfig{Value: StatusExpired},
+	},
+})
+
+var chargeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "SubscriptionCharge",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"kind": &graphql.Field{
+			Type:        graphql.String,
+			Description: "initial, renewal or proration",
+		},
+		"amount": &graphql.Field{
+			Type:        money.Type,
+			Description: "Negative for credit of unused time on plan change",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				if charge, ok := params.Source.(Charge); ok {
+					return charge.Money(), nil
+				}
+				return nil, nil
+			},
+		},
+		"period_start": &graphql.Field{
+			Type: dateTimeType,
+		},
+		"period_end": &graphql.Field{
+			Type: dateTimeType,
+		},
+		"status": &graphql.Field{
+			Type:        graphql.String,
+			Description: "pending, paid or failed",
+		},
+		"attempts": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"next_attempt_at": &graphql.Field{
+			Type:        dateTimeType,
+			Description: "Next retry of failed charge, wallet should be topped up before it",
+		},
+		"failure": &graphql.Field{
+			Type: graphql.String,
+		},
+		"paid_at": &graphql.Field{
+			Type: dateTimeType,
+		},
+		"invoice": &graphql.Field{
+			Type:        invoices.GetTypes().Invoice,
+			Description: "Issued when charge is paid, credits have no invoice",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				charge, ok := params.Source.(Charge)
+				if !ok || fieldResolvers == nil {
+					return nil, nil
+				}
+				invoice, err := invoices.ForSubscriptionCharge(fieldResolvers.pgsql, charge.Id)
+				if err != nil || invoice == nil {
+					return nil, err
+				}
+				return invoice, nil
+			},
+		},
+	},
+})
+
+var subscriptionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Subscription",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.Int,
+		},
+		"status": &graphql.Field{
+			Type: statusEnum,
+		},
+		"plan": &graphql.Field{
+			Type: planType,
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				subscription := sourceSubscription(params)
+				if subscription == nil || fieldResolvers == nil {
+					return nil, nil
+				}
+				return planById(fieldResolvers.pgsql, subscription.PlanId)
+			},
+		},
+		"current_period_start": &graphql.Field{
+			Type: dateTimeType,
+		},
+		"current_period_end": &graphql.Field{
+			Type:        dateTimeType,
+			Description: "Next charge or end of subscription when it is cancelled",
+		},
+		"trial_end": &graphql.Field{
+			Type: dateTimeType,
+		},
+		"cancel_at_period_end": &graphql.Field{
+			Type: graphql.Boolean,
+		},
+		"cancelled_at": &graphql.Field{
+			Type: dateTimeType,
+		},
+		"charges": &graphql.Field{
+			Type:        graphql.NewList(chargeType),
+			Description: "Newest first",
+			Resolve: func(params graphql.ResolveParams) (interface{}, error) {
+				subscription := sourceSubscription(params)
+				if subscription == nil || fieldResolvers == nil {
+					return nil, nil
+				}
+				return fieldResolvers.charges(subscription.Id)
+			},
+		},
+		"created_at": &graphql.Field{
+			Type: dateTimeType,
+		},
+	},
+})
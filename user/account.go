@@ -0,0 +1,120 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/locale"
+	"github.com/Moranilt/go-graphql-location/mailer"
+	"github.com/graphql-go/graphql"
+)
+
+const DefaultDeletionGracePeriod = time.Hour * 24 * 30
+
+func (r *Resolvers) RequestAccountDeletion(params graphql.ResolveParams) (interface{}, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleteAfter time.Time
+	err = r.pgsql.Get(&deleteAfter,
+		"UPDATE users SET delete_after=COALESCE(delete_after, NOW() + $2 * INTERVAL '1 second') WHERE id=$1 RETURNING delete_after",
+		userId, int64(r.deletionGracePeriod.Seconds()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Notify(params.Context, userId, NotificationAccount, func(to string, f *locale.Formatter) mailer.Message {
+		return mailer.Message{
+			To:      to,
+			Subject: "Your account will be deleted",
+			Body: fmt.Sprintf(
+				"Your account and personal data will be deleted on %s.\n\nYou can cancel deletion until then in account settings.",
+				f.DateTime(deleteAfter),
+			),
+		}
+	})
+	if err != nil {
+		log.Printf("unable to send deletion notice to user %d: %s", userId, err)
+	}
+
+	return map[string]interface{}{"delete_after": deleteAfter.Format(time.RFC3339)}, nil
+}
+
+func (r *Resolvers) CancelAccountDeletion(params graphql.ResolveParams) (interface{}, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.pgsql.Exec("UPDATE users SET delete_after=NULL WHERE id=$1", userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"delete_after": nil}, nil
+}
+
+// delete users whose grace period is over. Payments stay for accounting,
+// foreign key sets their user_id to NULL. Failed users are retried on next run
+func (r *Resolvers) PurgeDeletedAccounts(ctx context.Context) (int, error) {
+	var userIds []uint64
+	err := r.pgsql.Select(&userIds, "SELECT id FROM users WHERE delete_after <= NOW()")
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	failures := 0
+	for _, userId := range userIds {
+		deleted, err := r.purgeAccount(ctx, userId)
+		if err != nil {
+			failures++
+			log.Printf("deletion of account %d failed: %s", userId, err)
+			continue
+		}
+
+		if deleted {
+			purged++
+			log.Printf("account %d is deleted", userId)
+		}
+	}
+
+	if err := r.removeExpiredExports(); err != nil {
+		return purged, err
+	}
+
+	if failures > 0 {
+		return purged, fmt.Errorf("%d accounts were not deleted", failures)
+	}
+
+	return purged, nil
+}
+
+// returns false when deletion was cancelled since select
+func (r *Resolvers) purgeAccount(ctx context.Context, userId uint64) (bool, error) {
+	if err := authorization.RevokeUserSessions(userId, r.RedisClient, ctx); err != nil {
+		return false, fmt.Errorf("unable to revoke sessions: %s", err)
+	}
+
+	var avatarKey *string
+	err := r.pgsql.GetContext(ctx, &avatarKey, "DELETE FROM users WHERE id=$1 AND delete_after <= NOW() RETURNING avatar_key", userId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if avatarKey != nil {
+		r.deleteAvatar(ctx, *avatarKey)
+	}
+
+	return true, nil
+}
@@ -1,23 +1,121 @@
 package user
 
-import "github.com/graphql-go/graphql"
+import (
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/gqlupload"
+	"github.com/Moranilt/go-graphql-location/pagination"
+	"github.com/graphql-go/graphql"
+)
 
 type Arguments struct {
-	Login        graphql.FieldConfigArgument
-	Create       graphql.FieldConfigArgument
-	Update       graphql.FieldConfigArgument
-	RefreshToken graphql.FieldConfigArgument
+	Users            graphql.FieldConfigArgument
+	SearchUsers      graphql.FieldConfigArgument
+	Login            graphql.FieldConfigArgument
+	Create           graphql.FieldConfigArgument
+	Update           graphql.FieldConfigArgument
+	RefreshToken     graphql.FieldConfigArgument
+	RequestLoginCode graphql.FieldConfigArgument
+	LoginWithCode    graphql.FieldConfigArgument
+	OidcAuthURL      graphql.FieldConfigArgument
+	OidcCallback     graphql.FieldConfigArgument
+	IdentityUnlink   graphql.FieldConfigArgument
+	VerifyPhone      graphql.FieldConfigArgument
+	ApproveDevice    graphql.FieldConfigArgument
+	SetStatus        graphql.FieldConfigArgument
+	UploadAvatar     graphql.FieldConfigArgument
+	UpdateSettings   graphql.FieldConfigArgument
+	IsLoginAvailable graphql.FieldConfigArgument
+	IsEmailAvailable graphql.FieldConfigArgument
 }
 
 func GetArguments() Arguments {
 	return Arguments{
-		Login:        loginArgs,
-		Create:       createArgs,
-		Update:       updateArgs,
-		RefreshToken: refreshTokenArgs,
+		Users:            usersArgs,
+		SearchUsers:      searchUsersArgs,
+		Login:            loginArgs,
+		Create:           createArgs,
+		Update:           updateArgs,
+		RefreshToken:     refreshTokenArgs,
+		RequestLoginCode: requestLoginCodeArgs,
+		LoginWithCode:    loginWithCodeArgs,
+		OidcAuthURL:      oidcAuthURLArgs,
+		OidcCallback:     oidcCallbackArgs,
+		IdentityUnlink:   identityUnlinkArgs,
+		VerifyPhone:      verifyPhoneArgs,
+		ApproveDevice:    approveDeviceArgs,
+		SetStatus:        setStatusArgs,
+		UploadAvatar:     uploadAvatarArgs,
+		UpdateSettings:   updateSettingsArgs,
+		IsLoginAvailable: isLoginAvailableArgs,
+		IsEmailAvailable: isEmailAvailableArgs,
 	}
 }
 
+var usersFilterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UsersFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Part of first name or last name",
+		},
+		"email": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Part of email",
+		},
+		"created_from": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Registered at or after, YYYY-MM-DD or RFC3339",
+		},
+		"created_to": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Registered at or before, YYYY-MM-DD or RFC3339",
+		},
+		"has_payments": &graphql.InputObjectFieldConfig{
+			Type: graphql.Boolean,
+		},
+	},
+})
+
+var userSortFieldEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "UserSortField",
+	Values: graphql.EnumValueConfigMap{
+		"FIRST_NAME": &graphql.EnumValueConfig{Value: "FIRST_NAME"},
+		"LAST_NAME":  &graphql.EnumValueConfig{Value: "LAST_NAME"},
+		"EMAIL":      &graphql.EnumValueConfig{Value: "EMAIL"},
+		"CREATED_AT": &graphql.EnumValueConfig{Value: "CREATED_AT"},
+	},
+})
+
+var usersSortInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UsersSort",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"field": &graphql.InputObjectFieldConfig{
+			Type:         userSortFieldEnum,
+			DefaultValue: "FIRST_NAME",
+		},
+		"direction": &graphql.InputObjectFieldConfig{
+			Type:         pagination.SortDirectionType,
+			DefaultValue: "ASC",
+		},
+	},
+})
+
+var usersArgs = pagination.Args(graphql.FieldConfigArgument{
+	"filter": &graphql.ArgumentConfig{
+		Type: usersFilterInput,
+	},
+	"sort": &graphql.ArgumentConfig{
+		Type: usersSortInput,
+	},
+})
+
+var searchUsersArgs = pagination.Args(graphql.FieldConfigArgument{
+	"query": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "Part of name, email, login or phone",
+	},
+})
+
 var loginArgs = graphql.FieldConfigArgument{
 	"login": &graphql.ArgumentConfig{
 		Type: graphql.NewNonNull(graphql.String),
@@ -68,3 +166,130 @@ var refreshTokenArgs = graphql.FieldConfigArgument{
 		Type: graphql.NewNonNull(graphql.String),
 	},
 }
+
+var requestLoginCodeArgs = graphql.FieldConfigArgument{
+	"email": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.String),
+	},
+}
+
+var loginWithCodeArgs = graphql.FieldConfigArgument{
+	"email": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.String),
+	},
+	"code": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "Code from email or token from login link",
+	},
+}
+
+var oidcAuthURLArgs = graphql.FieldConfigArgument{
+	"provider": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.String),
+	},
+	"link": &graphql.ArgumentConfig{
+		Type:         graphql.Boolean,
+		DefaultValue: false,
+		Description:  "Start flow for linking provider to authorized user",
+	},
+}
+
+var oidcCallbackArgs = graphql.FieldConfigArgument{
+	"provider": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.String),
+	},
+	"code": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.String),
+	},
+	"state": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.String),
+	},
+}
+
+var identityUnlinkArgs = graphql.FieldConfigArgument{
+	"provider": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.String),
+	},
+}
+
+var verifyPhoneArgs = graphql.FieldConfigArgument{
+	"code": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.String),
+	},
+}
+
+var approveDeviceArgs = graphql.FieldConfigArgument{
+	"user_code": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.String),
+		Description: "Code shown on device",
+	},
+	"deny": &graphql.ArgumentConfig{
+		Type:         graphql.Boolean,
+		DefaultValue: false,
+	},
+}
+
+var statusEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "UserStatus",
+	Values: graphql.EnumValueConfigMap{
+		"active":               &graphql.EnumValueConfig{Value: authorization.StatusActive},
+		"suspended":            &graphql.EnumValueConfig{Value: authorization.StatusSuspended},
+		"deactivated":          &graphql.EnumValueConfig{Value: authorization.StatusDeactivated},
+		"pending_verification": &graphql.EnumValueConfig{Value: authorization.StatusPendingVerification},
+	},
+})
+
+var setStatusArgs = graphql.FieldConfigArgument{
+	"user_id": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.Int),
+	},
+	"status": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(statusEnum),
+	},
+	"reason": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "Required for all statuses except active",
+	},
+}
+
+var uploadAvatarArgs = graphql.FieldConfigArgument{
+	"file": &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(gqlupload.Upload),
+		Description: "JPEG, PNG or GIF image up to 5 MB",
+	},
+}
+
+var updateSettingsArgs = graphql.FieldConfigArgument{
+	"locale": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "One of en, ru, de, fr, es with optional region, e.g. en-GB",
+	},
+	"timezone": &graphql.ArgumentConfig{
+		Type:        graphql.String,
+		Description: "IANA timezone",
+	},
+	"currency": &graphql.ArgumentConfig{
+		Type: graphql.String,
+	},
+	"notify_account": &graphql.ArgumentConfig{
+		Type: graphql.Boolean,
+	},
+	"notify_payments": &graphql.ArgumentConfig{
+		Type: graphql.Boolean,
+	},
+	"notify_marketing": &graphql.ArgumentConfig{
+		Type: graphql.Boolean,
+	},
+}
+
+var isLoginAvailableArgs = graphql.FieldConfigArgument{
+	"login": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.String),
+	},
+}
+
+var isEmailAvailableArgs = graphql.FieldConfigArgument{
+	"email": &graphql.ArgumentConfig{
+		Type: graphql.NewNonNull(graphql.String),
+	},
+}
@@ -0,0 +1,203 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Moranilt/go-graphql-location/gqlupload"
+	"github.com/Moranilt/go-graphql-location/imaging"
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	MaxAvatarSize = 5 << 20
+	// larger images are rejected before decoding to limit memory usage
+	MaxAvatarDimension = 4096
+	DefaultAvatarSize  = 128
+)
+
+// square sizes of stored avatar, ascending
+var AvatarSizes = []int{64, 128, 256}
+
+var avatarContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// key of avatar file with given size, avatar_key column stores common prefix
+func avatarFileKey(prefix string, size int) string {
+	return prefix + "-" + strconv.Itoa(size) + ".jpg"
+}
+
+// smallest standard size which is not less than requested
+func avatarSize(requested int) int {
+	for _, size := range AvatarSizes {
+		if size >= requested {
+			return size
+		}
+	}
+
+	return AvatarSizes[len(AvatarSizes)-1]
+}
+
+func resolveAvatarURL(params graphql.ResolveParams) (interface{}, error) {
+	var user *UserType
+	switch source := params.Source.(type) {
+	case *UserType:
+		user = source
+	case UserType:
+		user = &source
+	}
+
+	if user == nil || user.Avatar_key == nil || fieldResolvers == nil || fieldResolvers.blobs == nil {
+		return nil, nil
+	}
+
+	size, _ := params.Args["size"].(int)
+	return fieldResolvers.blobs.URL(avatarFileKey(*user.Avatar_key, avatarSize(size))), nil
+}
+
+// read and check uploaded image, returns decoded image
+func readAvatar(file *gqlupload.File) (image.Image, error) {
+	if file.Size > MaxAvatarSize {
+		return nil, fmt.Errorf("avatar must not be larger than %d MB", MaxAvatarSize>>20)
+	}
+
+	upload, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer upload.Close()
+
+	content, err := ioutil.ReadAll(io.LimitReader(upload, MaxAvatarSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) > MaxAvatarSize {
+		return nil, fmt.Errorf("avatar must not be larger than %d MB", MaxAvatarSize>>20)
+	}
+
+	// content type from request is not trusted
+	if contentType := http.DetectContentType(content); !avatarContentTypes[contentType] {
+		return nil, fmt.Errorf("avatar must be JPEG, PNG or GIF image")
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %s", err)
+	}
+
+	if config.Width < 1 || config.Height < 1 || config.Width > MaxAvatarDimension || config.Height > MaxAvatarDimension {
+		return nil, fmt.Errorf("avatar must not be larger than %dx%d pixels", MaxAvatarDimension, MaxAvatarDimension)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %s", err)
+	}
+
+	return img, nil
+}
+
+func (r *Resolvers) UploadAvatar(params graphql.ResolveParams) (*UserType, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.blobs == nil {
+		return nil, fmt.Errorf("file uploads are not configured")
+	}
+
+	file, ok := params.Args["file"].(*gqlupload.File)
+	if !ok {
+		return nil, fmt.Errorf("file is required")
+	}
+
+	img, err := readAvatar(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// new name for every upload, so cached old avatar is never served by the same url
+	version := make([]byte, 8)
+	if _, err := rand.Read(version); err != nil {
+		return nil, err
+	}
+	prefix := fmt.Sprintf("avatars/%d/%s", userId, hex.EncodeToString(version))
+
+	ctx := params.Context
+	stored := []string{}
+	for _, size := range AvatarSizes {
+		var buf bytes.Buffer
+		thumbnail := imaging.SquareThumbnail(img, size, color.White)
+
+		if err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 85}); err != nil {
+			r.deleteBlobs(ctx, stored)
+			return nil, err
+		}
+
+		key := avatarFileKey(prefix, size)
+		if err := r.blobs.Put(ctx, key, "image/jpeg", &buf); err != nil {
+			r.deleteBlobs(ctx, stored)
+			return nil, err
+		}
+		stored = append(stored, key)
+	}
+
+	var oldPrefix *string
+	err = r.pgsql.Get(&oldPrefix, "SELECT avatar_key FROM users WHERE id=$1", userId)
+	if err != nil {
+		r.deleteBlobs(ctx, stored)
+		return nil, err
+	}
+
+	_, err = r.pgsql.Exec("UPDATE users SET avatar_key=$2, updated_at=NOW() WHERE id=$1", userId, prefix)
+	if err != nil {
+		r.deleteBlobs(ctx, stored)
+		return nil, err
+	}
+
+	if oldPrefix != nil {
+		r.deleteAvatar(ctx, *oldPrefix)
+	}
+
+	return r.loadUser(userId)
+}
+
+// remove all sizes of avatar
+func (r *Resolvers) deleteAvatar(ctx context.Context, prefix string) {
+	if r.blobs == nil {
+		return
+	}
+
+	keys := []string{}
+	for _, size := range AvatarSizes {
+		keys = append(keys, avatarFileKey(prefix, size))
+	}
+	r.deleteBlobs(ctx, keys)
+}
+
+// remove files, failures are only logged because database is already updated
+func (r *Resolvers) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := r.blobs.Delete(ctx, key); err != nil {
+			log.Printf("unable to delete %s: %s", key, err)
+		}
+	}
+}
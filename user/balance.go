@@ -0,0 +1,39 @@
+package user
+
+import (
+	"fmt"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/ledger"
+	"github.com/graphql-go/graphql"
+)
+
+// resolver of User.balance, available for the user and admins
+func resolveBalance(params graphql.ResolveParams) (interface{}, error) {
+	var userId uint64
+	switch source := params.Source.(type) {
+	case *UserType:
+		userId = uint64(source.Id)
+	case UserType:
+		userId = uint64(source.Id)
+	default:
+		return nil, nil
+	}
+
+	if fieldResolvers == nil {
+		return nil, fmt.Errorf("balance is not available")
+	}
+
+	viewerId, err := fieldResolvers.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if viewerId != userId {
+		if err := authorization.CheckRole(fieldResolvers.pgsql, viewerId, authorization.RoleAdmin); err != nil {
+			return nil, err
+		}
+	}
+
+	return ledger.Balances(fieldResolvers.pgsql, userId)
+}
@@ -0,0 +1,477 @@
+package user
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const DefaultImportBatchSize = 200
+
+// columns accepted by ImportUsers, phone is optional
+var importColumns = []string{"first_name", "last_name", "login", "password", "email", "phone"}
+
+// columns available for ExportUsers, password is never exported
+var ExportColumns = []string{
+	"id", "login", "email", "first_name", "last_name", "phone", "phone_verified_at",
+	"status", "role", "last_login", "created_at", "updated_at",
+}
+
+var DefaultExportColumns = []string{"id", "login", "email", "first_name", "last_name", "phone", "status", "role", "created_at"}
+
+type ImportOptions struct {
+	// "csv" with header row or "jsonl" with object per line
+	Format    string
+	BatchSize int
+	// validate and check duplicates without inserting
+	DryRun bool
+}
+
+// result of single row, Line is number of line in source file
+type ImportRowError struct {
+	Line  int
+	Login string
+	Email string
+	Error string
+}
+
+type ImportReport struct {
+	Total    int
+	Imported int
+	Errors   []ImportRowError
+}
+
+type importRow struct {
+	line  int
+	input UserInput
+}
+
+// read users from CSV or JSONL and insert them in batches.
+// Invalid and duplicate rows are skipped and listed in report.
+func ImportUsers(ctx context.Context, pgsql *sqlx.DB, source io.Reader, options ImportOptions) (*ImportReport, error) {
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultImportBatchSize
+	}
+
+	report := &ImportReport{}
+	seen := map[string]int{}
+	batch := make([]importRow, 0, options.BatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := importBatch(ctx, pgsql, batch, options.DryRun, report)
+		batch = batch[:0]
+		return err
+	}
+
+	err := readImportRows(source, options.Format, func(line int, values map[string]string) error {
+		report.Total++
+
+		input, err := importInput(values)
+		if err == nil {
+			err = checkDuplicate(seen, line, input)
+		}
+
+		if err != nil {
+			report.Errors = append(report.Errors, ImportRowError{Line: line, Login: values["login"], Email: values["email"], Error: err.Error()})
+			return nil
+		}
+
+		batch = append(batch, importRow{line: line, input: input})
+		if len(batch) == options.BatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	return report, flush()
+}
+
+// key of values for rows which could not be parsed
+const rowErrorKey = "\x00error"
+
+// call handle for every row of source with values by column name
+func readImportRows(source io.Reader, format string, handle func(line int, values map[string]string) error) error {
+	switch format {
+	case "csv":
+		reader := csv.NewReader(source)
+		reader.TrimLeadingSpace = true
+
+		header, err := reader.Read()
+		if err != nil {
+			return fmt.Errorf("unable to read header: %s", err)
+		}
+		for i := range header {
+			header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+		}
+
+		line := 1
+
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			// header is the first line, quoted line breaks are not counted
+			line++
+			values := map[string]string{}
+			for i, column := range header {
+				if i < len(record) {
+					values[column] = record[i]
+				}
+			}
+
+			if err := handle(line, values); err != nil {
+				return err
+			}
+		}
+
+	case "jsonl":
+		scanner := bufio.NewScanner(source)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+		line := 0
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			var object map[string]interface{}
+			values := map[string]string{}
+			if err := json.Unmarshal([]byte(text), &object); err != nil {
+				values[rowErrorKey] = fmt.Sprintf("invalid JSON: %s", err)
+			}
+			for column, value := range object {
+				if text, ok := value.(string); ok {
+					values[column] = text
+				}
+			}
+
+			if err := handle(line, values); err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	}
+
+	return fmt.Errorf("unsupported format: %s", format)
+}
+
+// validate row and build input, password is not hashed yet
+func importInput(values map[string]string) (UserInput, error) {
+	var input UserInput
+
+	if message, ok := values[rowErrorKey]; ok {
+		return input, fmt.Errorf("%s", message)
+	}
+
+	fields := map[string]*string{
+		"first_name": &input.First_name,
+		"last_name":  &input.Last_name,
+		"login":      &input.Login,
+		"email":      &input.Email,
+	}
+	for _, column := range importColumns {
+		target, ok := fields[column]
+		if !ok {
+			continue
+		}
+
+		value, err := validateField(column, values[column])
+		if err != nil {
+			return input, err
+		}
+		*target = value
+	}
+
+	input.Password = values["password"]
+	if input.Password == "" {
+		return input, fmt.Errorf("password can not be empty")
+	}
+	// bcrypt ignores the rest of longer passwords
+	if len(input.Password) > 72 {
+		return input, fmt.Errorf("password is too long")
+	}
+
+	if phone := strings.TrimSpace(values["phone"]); phone != "" {
+		normalized, err := NormalizePhone(phone)
+		if err != nil {
+			return input, err
+		}
+		input.Phone = &normalized
+	}
+
+	return input, nil
+}
+
+// unique columns must not repeat in file
+func checkDuplicate(seen map[string]int, line int, input UserInput) error {
+	keys := []string{"login:" + input.Login, "email:" + input.Email}
+	if input.Phone != nil {
+		keys = append(keys, "phone:"+*input.Phone)
+	}
+
+	for _, key := range keys {
+		if previous, ok := seen[key]; ok {
+			return fmt.Errorf("%s is duplicate of line %d", strings.SplitN(key, ":", 2)[0], previous)
+		}
+	}
+
+	for _, key := range keys {
+		seen[key] = line
+	}
+
+	return nil
+}
+
+func importBatch(ctx context.Context, pgsql *sqlx.DB, rows []importRow, dryRun bool, report *ImportReport) error {
+	existing, err := existingIdentifiers(ctx, pgsql, rows)
+	if err != nil {
+		return err
+	}
+
+	valid := make([]importRow, 0, len(rows))
+	for _, row := range rows {
+		if column := existing.conflict(row.input); column != "" {
+			report.Errors = append(report.Errors, ImportRowError{
+				Line: row.line, Login: row.input.Login, Email: row.input.Email,
+				Error: fmt.Sprintf("user with this %s already exists", column),
+			})
+			continue
+		}
+		valid = append(valid, row)
+	}
+
+	if dryRun {
+		report.Imported += len(valid)
+		return nil
+	}
+
+	if err := hashPasswords(valid); err != nil {
+		return err
+	}
+
+	tx, err := pgsql.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	imported := 0
+	failed := []ImportRowError{}
+	for _, row := range valid {
+		// conflict can still happen when user was registered after the check
+		result, err := tx.ExecContext(ctx,
+			`INSERT INTO users (first_name, last_name, login, password, phone, email)
+			VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING`,
+			row.input.First_name, row.input.Last_name, row.input.Login, row.input.Password, row.input.Phone, row.input.Email,
+		)
+		if err != nil {
+			return err
+		}
+
+		if inserted, _ := result.RowsAffected(); inserted == 0 {
+			failed = append(failed, ImportRowError{
+				Line: row.line, Login: row.input.Login, Email: row.input.Email,
+				Error: "user with this login, email or phone already exists",
+			})
+			continue
+		}
+		imported++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	report.Imported += imported
+	report.Errors = append(report.Errors, failed...)
+	return nil
+}
+
+type identifiers map[string]bool
+
+func (i identifiers) conflict(input UserInput) string {
+	switch {
+	case i["login:"+input.Login]:
+		return "login"
+	case i["email:"+input.Email]:
+		return "email"
+	case input.Phone != nil && i["phone:"+*input.Phone]:
+		return "phone"
+	}
+	return ""
+}
+
+// logins, emails and phones of batch which are already registered
+func existingIdentifiers(ctx context.Context, pgsql *sqlx.DB, rows []importRow) (identifiers, error) {
+	logins, emails, phones := []string{}, []string{}, []string{}
+	for _, row := range rows {
+		logins = append(logins, row.input.Login)
+		emails = append(emails, row.input.Email)
+		if row.input.Phone != nil {
+			phones = append(phones, *row.input.Phone)
+		}
+	}
+
+	var found []struct {
+		Login string  `db:"login"`
+		Email string  `db:"email"`
+		Phone *string `db:"phone"`
+	}
+	err := pgsql.SelectContext(ctx, &found,
+		"SELECT login, email, phone FROM users WHERE login = ANY($1) OR email = ANY($2) OR phone = ANY($3)",
+		pq.Array(logins), pq.Array(emails), pq.Array(phones),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	result := identifiers{}
+	for _, user := range found {
+		result["login:"+user.Login] = true
+		result["email:"+user.Email] = true
+		if user.Phone != nil {
+			result["phone:"+*user.Phone] = true
+		}
+	}
+
+	return result, nil
+}
+
+// bcrypt is slow on purpose, so passwords of batch are hashed in parallel
+func hashPasswords(rows []importRow) error {
+	jobs := make(chan int)
+	errs := make(chan error, len(rows))
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < runtime.NumCPU(); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				hashed, err := bcrypt.GenerateFromPassword([]byte(rows[i].input.Password), bcrypt.DefaultCost)
+				if err != nil {
+					errs <- err
+					continue
+				}
+				rows[i].input.Password = string(hashed)
+			}
+		}()
+	}
+
+	for i := range rows {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+// write users ordered by id in CSV with header or JSONL
+func ExportUsers(ctx context.Context, pgsql *sqlx.DB, target io.Writer, format string, columns []string) error {
+	allowed := map[string]bool{}
+	for _, column := range ExportColumns {
+		allowed[column] = true
+	}
+	for _, column := range columns {
+		if !allowed[column] {
+			return fmt.Errorf("unknown field %s, available: %s", column, strings.Join(ExportColumns, ", "))
+		}
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("no fields selected")
+	}
+	if format != "csv" && format != "jsonl" {
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	selects := make([]string, len(columns))
+	for i, column := range columns {
+		// text keeps values in the same form for both formats
+		selects[i] = fmt.Sprintf("%s::text AS %s", column, column)
+	}
+
+	rows, err := pgsql.QueryContext(ctx, "SELECT "+strings.Join(selects, ", ")+" FROM users ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	writer := bufio.NewWriter(target)
+	csvWriter := csv.NewWriter(writer)
+	encoder := json.NewEncoder(writer)
+
+	if format == "csv" {
+		if err := csvWriter.Write(columns); err != nil {
+			return err
+		}
+	}
+
+	values := make([]*string, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+
+		if format == "csv" {
+			record := make([]string, len(columns))
+			for i, value := range values {
+				if value != nil {
+					record[i] = *value
+				}
+			}
+			if err := csvWriter.Write(record); err != nil {
+				return err
+			}
+			continue
+		}
+
+		object := make(map[string]*string, len(columns))
+		for i, column := range columns {
+			object[column] = values[i]
+		}
+		if err := encoder.Encode(object); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
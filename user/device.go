@@ -0,0 +1,25 @@
+package user
+
+import (
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/graphql-go/graphql"
+)
+
+func (r *Resolvers) ApproveDevice(params graphql.ResolveParams) (interface{}, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	approve := true
+	if deny, ok := params.Args["deny"].(bool); ok && deny {
+		approve = false
+	}
+
+	clientID, err := authorization.ApproveDeviceCode(params.Args["user_code"].(string), userId, approve, r.RedisClient, params.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"client_id": clientID, "approved": approve}, nil
+}
@@ -0,0 +1,198 @@
+package user
+
+import (
+	"archive/zip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
+)
+
+const ExportTTL = time.Hour * 24
+
+var exportFileName = regexp.MustCompile(`^[a-f0-9]{32}\.zip$`)
+
+// profile fields for export, without password hash and service columns
+type exportProfile struct {
+	Id              int     `json:"id"`
+	Login           string  `json:"login"`
+	Email           string  `json:"email"`
+	FirstName       string  `json:"first_name"`
+	LastName        string  `json:"last_name"`
+	Phone           *string `json:"phone"`
+	PhoneVerifiedAt *string `json:"phone_verified_at"`
+	Role            string  `json:"role"`
+	LastLogin       string  `json:"last_login"`
+	CreatedAt       string  `json:"created_at"`
+	UpdatedAt       string  `json:"updated_at"`
+}
+
+const exportReadme = `Export of your account data.
+
+profile.json     - account information
+payments.json    - payments
+identities.json  - linked external identity providers
+sessions.json    - active sessions (logged in devices)
+settings.json    - preferences and notification opt-ins
+`
+
+func (r *Resolvers) ExportMyData(params graphql.ResolveParams) (interface{}, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := r.loadUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := authorization.UserSessions(userId, r.RedisClient, params.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	fileName := hex.EncodeToString(id) + ".zip"
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", exportProfile{
+			Id:              user.Id,
+			Login:           user.Login,
+			Email:           user.Email,
+			FirstName:       user.First_name,
+			LastName:        user.Last_name,
+			Phone:           user.Phone,
+			PhoneVerifiedAt: user.Phone_verified_at,
+			Role:            user.Role,
+			LastLogin:       user.Last_login,
+			CreatedAt:       user.Created_at,
+			UpdatedAt:       user.Updated_at,
+		}},
+		{"payments.json", user.Payments},
+		{"identities.json", user.Identities},
+		{"sessions.json", sessions},
+		{"settings.json", user.Settings},
+	}
+
+	if err := os.MkdirAll(r.exportsDir, 0700); err != nil {
+		return nil, err
+	}
+
+	// write to temporary file, so incomplete archive is never served
+	tmp, err := ioutil.TempFile(r.exportsDir, "export-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	archive := zip.NewWriter(tmp)
+
+	readme, err := archive.Create("README.txt")
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	readme.Write([]byte(exportReadme))
+
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			tmp.Close()
+			return nil, err
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.content); err != nil {
+			tmp.Close()
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(r.exportsDir, fileName)); err != nil {
+		return nil, err
+	}
+
+	url, expiresAt := r.signer.Sign(r.publicURL, "/exports/"+fileName, ExportTTL)
+
+	return map[string]string{
+		"url":        url,
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// download archive by signed link from ExportMyData
+func (r *Resolvers) ExportHandler(w http.ResponseWriter, req *http.Request) {
+	fileName := mux.Vars(req)["file"]
+
+	if !exportFileName.MatchString(fileName) {
+		http.NotFound(w, req)
+		return
+	}
+
+	if err := r.signer.Verify(req.URL.Path, req.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	path := filepath.Join(r.exportsDir, fileName)
+	if _, err := os.Stat(path); err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="account-data-%s"`, fileName))
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeFile(w, req, path)
+}
+
+// remove archives older than ExportTTL, links to them are expired anyway
+func (r *Resolvers) removeExpiredExports() error {
+	entries, err := ioutil.ReadDir(r.exportsDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || time.Since(entry.ModTime()) < ExportTTL {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(r.exportsDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package user
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/pagination"
+	"github.com/graphql-go/graphql"
+	"github.com/jmoiron/sqlx"
+)
+
+const historySortKey = "id:DESC"
+
+// single changed field, rows of user_history are never updated
+type HistoryEntry struct {
+	Id         int64   `json:"id" db:"id"`
+	User_id    int     `json:"user_id" db:"user_id"`
+	Actor_id   *int    `json:"actor_id" db:"actor_id"`
+	Field      string  `json:"field" db:"field"`
+	Old_value  *string `json:"old_value" db:"old_value"`
+	New_value  *string `json:"new_value" db:"new_value"`
+	Created_at string  `json:"created_at" db:"created_at"`
+}
+
+// columns of users which are tracked by Update
+type profileFields struct {
+	First_name string  `db:"first_name"`
+	Last_name  string  `db:"last_name"`
+	Phone      *string `db:"phone"`
+	Email      string  `db:"email"`
+}
+
+const profileColumns = "first_name, last_name, phone, email"
+
+func (p *profileFields) values() map[string]*string {
+	return map[string]*string{
+		"first_name": &p.First_name,
+		"last_name":  &p.Last_name,
+		"phone":      p.Phone,
+		"email":      &p.Email,
+	}
+}
+
+func sameValue(a *string, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// append entries for fields which differ in before and after.
+// Must be called in transaction of change, actorId is 0 for system changes.
+func recordChanges(tx *sqlx.Tx, userId uint64, actorId uint64, before map[string]*string, after map[string]*string) error {
+	fields := make([]string, 0, len(after))
+	for field := range after {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var actor *uint64
+	if actorId != 0 {
+		actor = &actorId
+	}
+
+	for _, field := range fields {
+		if sameValue(before[field], after[field]) {
+			continue
+		}
+
+		_, err := tx.Exec(
+			"INSERT INTO user_history (user_id, actor_id, field, old_value, new_value) VALUES ($1, $2, $3, $4, $5)",
+			userId, actor, field, before[field], after[field],
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolver of User.history, available for the user and admins
+func resolveHistory(params graphql.ResolveParams) (interface{}, error) {
+	var userId uint64
+	switch source := params.Source.(type) {
+	case *UserType:
+		userId = uint64(source.Id)
+	case UserType:
+		userId = uint64(source.Id)
+	default:
+		return nil, nil
+	}
+
+	if fieldResolvers == nil {
+		return nil, fmt.Errorf("history is not available")
+	}
+
+	return fieldResolvers.history(params, userId)
+}
+
+func (r *Resolvers) history(params graphql.ResolveParams, userId uint64) (*pagination.Connection, error) {
+	viewerId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if viewerId != userId {
+		if err := authorization.CheckRole(r.pgsql, viewerId, authorization.RoleAdmin); err != nil {
+			return nil, err
+		}
+	}
+
+	first, err := pagination.First(params.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &pagination.Filter{}
+	filter.Add("user_id = ?", userId)
+
+	var totalCount int
+	err = r.pgsql.Get(&totalCount, "SELECT COUNT(*) FROM user_history"+filter.Where(), filter.Args...)
+	if err != nil {
+		return nil, err
+	}
+
+	after, _ := params.Args["after"].(string)
+	if after != "" {
+		cursor, err := pagination.DecodeCursor(after, historySortKey)
+		if err != nil {
+			return nil, err
+		}
+		filter.Add("id < ?", cursor.Id)
+	}
+
+	var entries []HistoryEntry
+	query := "SELECT * FROM user_history" + filter.Where() + " ORDER BY id DESC LIMIT " + filter.Arg(first+1)
+	if err := r.pgsql.Select(&entries, query, filter.Args...); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]interface{}, len(entries))
+	cursors := make([]string, len(entries))
+	for i := range entries {
+		nodes[i] = &entries[i]
+		cursors[i] = pagination.EncodeCursor(pagination.Cursor{
+			Sort:  historySortKey,
+			Value: strconv.FormatInt(entries[i].Id, 10),
+			Id:    entries[i].Id,
+		})
+	}
+
+	return pagination.NewConnection(nodes, cursors, first, after != "", totalCount), nil
+}
@@ -0,0 +1,89 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	"github.com/lib/pq"
+)
+
+// logins and emails are stored lower case, so they are unique regardless of case
+func NormalizeLogin(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+func NormalizeEmail(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// error codes in extensions of GraphQL errors
+const (
+	ErrorCodeTaken   = "ALREADY_TAKEN"
+	ErrorCodeInvalid = "INVALID_VALUE"
+)
+
+// error of single argument, Field and Code are returned in extensions of GraphQL error
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+func (e *FieldError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":  e.Code,
+		"field": e.Field,
+	}
+}
+
+func takenError(field string) error {
+	return &FieldError{Field: field, Code: ErrorCodeTaken, Message: fmt.Sprintf("%s is already taken", field)}
+}
+
+// unique constraints of users and fields they protect
+var uniqueConstraints = map[string]string{
+	"users_login_key": "login",
+	"users_email_key": "email",
+	"users_phone_key": "phone",
+}
+
+// replace unique violation of users table by FieldError, other errors are returned as is
+func constraintError(err error) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok || pqErr.Code != "23505" {
+		return err
+	}
+
+	if field, ok := uniqueConstraints[pqErr.Constraint]; ok {
+		return takenError(field)
+	}
+
+	return err
+}
+
+func (r *Resolvers) IsLoginAvailable(params graphql.ResolveParams) (bool, error) {
+	login, err := validateField("login", params.Args["login"].(string))
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err = r.pgsql.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE login=$1)", login)
+	return !exists, err
+}
+
+func (r *Resolvers) IsEmailAvailable(params graphql.ResolveParams) (bool, error) {
+	email, err := validateField("email", params.Args["email"].(string))
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err = r.pgsql.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)", email)
+	return !exists, err
+}
@@ -0,0 +1,198 @@
+package user
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/graphql-go/graphql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Identity struct {
+	Id        int    `json:"id" db:"id"`
+	UserId    int    `json:"user_id" db:"user_id"`
+	Provider  string `json:"provider" db:"provider"`
+	Subject   string `json:"subject" db:"subject"`
+	Email     string `json:"email" db:"email"`
+	CreatedAt string `json:"created_at" db:"created_at"`
+}
+
+func (r *Resolvers) OidcProviders() []string {
+	return r.oidc.Names()
+}
+
+func (r *Resolvers) OidcAuthURL(params graphql.ResolveParams) (interface{}, error) {
+	var linkUserId uint64
+
+	if link, ok := params.Args["link"].(bool); ok && link {
+		userId, err := r.currentUserId(params)
+		if err != nil {
+			return nil, err
+		}
+		linkUserId = userId
+	}
+
+	authURL, state, err := r.oidc.Start(params.Context, r.RedisClient, params.Args["provider"].(string), linkUserId)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"url": authURL, "state": state}, nil
+}
+
+func (r *Resolvers) OidcLogin(params graphql.ResolveParams) (*authorization.Tokens, error) {
+	provider := params.Args["provider"].(string)
+	session, claims, err := r.oidc.Finish(params.Context, r.RedisClient, provider, params.Args["code"].(string), params.Args["state"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if session.LinkUserId != 0 {
+		return nil, fmt.Errorf("login session was started for linking, use identityLink")
+	}
+
+	var userId int
+	err = r.pgsql.Get(&userId, "SELECT user_id FROM user_identities WHERE provider=$1 AND subject=$2", provider, claims.Subject)
+
+	if err == sql.ErrNoRows {
+		userId, err = r.createFromIdentity(provider, claims.Subject, claims.Email, claims.EmailVerified, claims.GivenName, claims.FamilyName)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := authorization.CreateToken(r.auth, userId, r.RedisClient, params.Context)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &authorization.Tokens{AccessToken: token.AccessToken, RefreshToken: token.RefreshToken}, nil
+}
+
+// register new user for external identity. Existing accounts are never taken over by email,
+// the user has to log in and link the provider themselves
+func (r *Resolvers) createFromIdentity(provider string, subject string, email string, emailVerified bool, firstName string, lastName string) (int, error) {
+	if email == "" || !emailVerified {
+		return 0, fmt.Errorf("identity provider did not return verified email")
+	}
+	email = NormalizeEmail(email)
+
+	var exists bool
+	err := r.pgsql.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE email=$1 OR login=$1)", email)
+	if err != nil {
+		return 0, err
+	}
+
+	if exists {
+		return 0, fmt.Errorf("account with this email already exists, login and link %s in profile", provider)
+	}
+
+	// password login is not possible for such users until they set password
+	randomPassword := make([]byte, 32)
+	if _, err := rand.Read(randomPassword); err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(randomPassword)), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.pgsql.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userId int
+	err = tx.Get(&userId, `INSERT INTO users (first_name, last_name, login, password, email) 
+				VALUES($1, $2, $3, $4, $5) RETURNING id`, firstName, lastName, email, string(hashedPassword), email)
+	if err != nil {
+		return 0, constraintError(err)
+	}
+
+	_, err = tx.Exec("INSERT INTO user_identities (user_id, provider, subject, email) VALUES($1, $2, $3, $4)", userId, provider, subject, email)
+	if err != nil {
+		return 0, err
+	}
+
+	return userId, tx.Commit()
+}
+
+func (r *Resolvers) IdentityLink(params graphql.ResolveParams) (interface{}, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := params.Args["provider"].(string)
+	session, claims, err := r.oidc.Finish(params.Context, r.RedisClient, provider, params.Args["code"].(string), params.Args["state"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if session.LinkUserId != userId {
+		return nil, fmt.Errorf("login session was started by another user")
+	}
+
+	var linkedUserId uint64
+	err = r.pgsql.Get(&linkedUserId, "SELECT user_id FROM user_identities WHERE provider=$1 AND subject=$2", provider, claims.Subject)
+
+	if err == nil && linkedUserId != userId {
+		return nil, fmt.Errorf("this %s account is linked to another user", provider)
+	}
+
+	if err == nil {
+		return r.identity(userId, provider)
+	}
+
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	_, err = r.pgsql.Exec("INSERT INTO user_identities (user_id, provider, subject, email) VALUES($1, $2, $3, $4)", userId, provider, claims.Subject, claims.Email)
+	if err != nil {
+		return nil, fmt.Errorf("unable to link %s: %s", provider, err)
+	}
+
+	return r.identity(userId, provider)
+}
+
+func (r *Resolvers) IdentityUnlink(params graphql.ResolveParams) (interface{}, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := params.Args["provider"].(string)
+	result, err := r.pgsql.Exec("DELETE FROM user_identities WHERE user_id=$1 AND provider=$2", userId, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if deleted == 0 {
+		return nil, fmt.Errorf("%s is not linked", provider)
+	}
+
+	return map[string]string{"provider": provider}, nil
+}
+
+func (r *Resolvers) identity(userId uint64, provider string) (*Identity, error) {
+	var identity Identity
+	err := r.pgsql.Get(&identity, "SELECT * FROM user_identities WHERE user_id=$1 AND provider=$2", userId, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity, nil
+}
@@ -0,0 +1,130 @@
+package user
+
+import (
+	"fmt"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/pagination"
+	"github.com/graphql-go/graphql"
+)
+
+// whitelist of sort fields, values are SQL expressions
+var userSortColumns = map[string]string{
+	"FIRST_NAME": "users.first_name",
+	"LAST_NAME":  "users.last_name",
+	"EMAIL":      "users.email",
+	"CREATED_AT": "COALESCE(users.created_at, 'epoch'::timestamp)",
+}
+
+type userRow struct {
+	UserType
+	SortValue string `db:"sort_value"`
+}
+
+func (r *Resolvers) Users(params graphql.ResolveParams) (*pagination.Connection, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// list exposes contacts and allows to filter by them
+	if err := authorization.CheckRole(r.pgsql, userId, authorization.RoleAdmin, authorization.RoleSupport); err != nil {
+		return nil, err
+	}
+
+	first, err := pagination.First(params.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	sortField, direction := "FIRST_NAME", "ASC"
+	if sort, ok := params.Args["sort"].(map[string]interface{}); ok {
+		if val, ok := sort["field"].(string); ok {
+			sortField = val
+		}
+		if val, ok := sort["direction"].(string); ok {
+			direction = val
+		}
+	}
+
+	sortColumn, ok := userSortColumns[sortField]
+	if !ok || (direction != "ASC" && direction != "DESC") {
+		return nil, fmt.Errorf("unsupported sorting")
+	}
+
+	filter := &pagination.Filter{}
+	if values, ok := params.Args["filter"].(map[string]interface{}); ok {
+		if err := applyUsersFilter(filter, values); err != nil {
+			return nil, err
+		}
+	}
+
+	var totalCount int
+	err = r.pgsql.Get(&totalCount, "SELECT COUNT(*) FROM users"+filter.Where(), filter.Args...)
+	if err != nil {
+		return nil, err
+	}
+
+	sortKey := sortField + ":" + direction
+	after, _ := params.Args["after"].(string)
+
+	if after != "" {
+		cursor, err := pagination.DecodeCursor(after, sortKey)
+		if err != nil {
+			return nil, err
+		}
+
+		operator := ">"
+		if direction == "DESC" {
+			operator = "<"
+		}
+		filter.Add(fmt.Sprintf("(%s, users.id) %s (?, ?)", sortColumn, operator), cursor.Value, cursor.Id)
+	}
+
+	query := fmt.Sprintf(
+		"SELECT users.*, (%s)::text AS sort_value FROM users%s ORDER BY %s %s, users.id %s LIMIT %s",
+		sortColumn, filter.Where(), sortColumn, direction, direction, filter.Arg(first+1),
+	)
+
+	var rows []userRow
+	if err := r.pgsql.Select(&rows, query, filter.Args...); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]interface{}, len(rows))
+	cursors := make([]string, len(rows))
+	for i := range rows {
+		nodes[i] = &rows[i].UserType
+		cursors[i] = pagination.EncodeCursor(pagination.Cursor{
+			Sort:  sortKey,
+			Value: rows[i].SortValue,
+			Id:    int64(rows[i].Id),
+		})
+	}
+
+	return pagination.NewConnection(nodes, cursors, first, after != "", totalCount), nil
+}
+
+func applyUsersFilter(filter *pagination.Filter, values map[string]interface{}) error {
+	if name, ok := values["name"].(string); ok && name != "" {
+		filter.Add("users.first_name || ' ' || users.last_name ILIKE ?", pagination.Contains(name))
+	}
+
+	if email, ok := values["email"].(string); ok && email != "" {
+		filter.Add("users.email ILIKE ?", pagination.Contains(email))
+	}
+
+	if err := filter.AddDateRange("users.created_at", values, "created_from", "created_to"); err != nil {
+		return err
+	}
+
+	if hasPayments, ok := values["has_payments"].(bool); ok {
+		condition := "EXISTS (SELECT 1 FROM payments WHERE payments.user_id = users.id)"
+		if !hasPayments {
+			condition = "NOT " + condition
+		}
+		filter.Add(condition)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+)
+
+// convert phone number to E.164 format (+ and up to 15 digits).
+// Spaces, dashes, dots and parentheses are removed, leading 00 is replaced by +.
+func NormalizePhone(phone string) (string, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+
+	if strings.HasPrefix(cleaned, "00") {
+		cleaned = "+" + cleaned[2:]
+	}
+
+	if !strings.HasPrefix(cleaned, "+") {
+		return "", fmt.Errorf("phone must be in international format with country code")
+	}
+
+	digits := cleaned[1:]
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("phone must contain only digits")
+		}
+	}
+
+	// country codes never start with 0, shortest numbers are 7 digits with country code
+	if len(digits) < 7 || len(digits) > 15 || digits[0] == '0' {
+		return "", fmt.Errorf("phone has invalid length or country code")
+	}
+
+	return cleaned, nil
+}
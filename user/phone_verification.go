@@ -0,0 +1,94 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/graphql-go/graphql"
+)
+
+const phoneCodePurpose = "phone"
+
+type phoneStatus struct {
+	Phone      *string `db:"phone"`
+	VerifiedAt *string `db:"phone_verified_at"`
+}
+
+func (r *Resolvers) phoneStatus(userId uint64) (*phoneStatus, error) {
+	var status phoneStatus
+	err := r.pgsql.Get(&status, "SELECT phone, phone_verified_at FROM users WHERE id=$1", userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if status.Phone == nil || *status.Phone == "" {
+		return nil, fmt.Errorf("phone is not set")
+	}
+
+	return &status, nil
+}
+
+// code is bound to user and phone, so changing phone makes sent code useless
+func phoneCodeSubject(userId uint64, phone string) string {
+	return fmt.Sprintf("%d:%s", userId, phone)
+}
+
+func (r *Resolvers) RequestPhoneVerification(params graphql.ResolveParams) (interface{}, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := r.phoneStatus(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if status.VerifiedAt != nil {
+		return nil, fmt.Errorf("phone is already verified")
+	}
+
+	phone := *status.Phone
+	code, err := authorization.CreateOneTimeCode(phoneCodePurpose, phoneCodeSubject(userId, phone), r.RedisClient, params.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.sms.Send(params.Context, phone, fmt.Sprintf("Your verification code is %s", code.Code))
+	if err != nil {
+		return nil, fmt.Errorf("unable to send sms: %s", err)
+	}
+
+	return map[string]interface{}{"phone": phone, "verified": false}, nil
+}
+
+func (r *Resolvers) VerifyPhone(params graphql.ResolveParams) (interface{}, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := r.phoneStatus(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	phone := *status.Phone
+	code := strings.TrimSpace(params.Args["code"].(string))
+	err = authorization.VerifyOneTimeCode(phoneCodePurpose, phoneCodeSubject(userId, phone), code, r.RedisClient, params.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.pgsql.Exec("UPDATE users SET phone_verified_at=NOW() WHERE id=$1 AND phone=$2", userId, phone)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return nil, fmt.Errorf("phone was changed, request a new code")
+	}
+
+	return map[string]interface{}{"phone": phone, "verified": true}, nil
+}
@@ -1,11 +1,24 @@
 package user
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/blobstore"
+	"github.com/Moranilt/go-graphql-location/locale"
+	"github.com/Moranilt/go-graphql-location/mailer"
+	"github.com/Moranilt/go-graphql-location/oidc"
+	"github.com/Moranilt/go-graphql-location/pagination"
 	"github.com/Moranilt/go-graphql-location/payments"
+	"github.com/Moranilt/go-graphql-location/signedurl"
+	"github.com/Moranilt/go-graphql-location/sms"
+	"github.com/Moranilt/go-graphql-location/sqlpatch"
 	"github.com/go-redis/redis/v8"
 	"github.com/graphql-go/graphql"
 	"github.com/jmoiron/sqlx"
@@ -13,8 +26,14 @@ import (
 )
 
 type Resolverers interface {
-	// Returning a list of all users from table users
-	AllUsers() ([]UserType, error)
+	// Returning a page of users from table users.
+	// It takes first and after for cursor pagination, filter and sort from graphql.ResolveParams.
+	// Available for admin and support roles only.
+	Users(params graphql.ResolveParams) (*pagination.Connection, error)
+
+	// Search users by part of name, email, login or phone, ranked by relevance.
+	// Available for admin and support roles only.
+	SearchUsers(params graphql.ResolveParams) (*pagination.Connection, error)
 
 	// Get information of a single user.
 	// It takes user_id from access_token
@@ -33,7 +52,8 @@ type Resolverers interface {
 	// Update user ingormation.
 	// It takes arguments from graphql.ResolvePrams, authorization key from Context
 	// Extracts userId from token and stroing new data to users table.
-	Update(params graphql.ResolveParams) (interface{}, error)
+	// Only passed arguments are changed, phone can be cleared by null. Returns updated user.
+	Update(params graphql.ResolveParams) (*UserType, error)
 
 	// Action for logout user.
 	// It takes authorization header key from graphql.ResolvePrams Context and extracting
@@ -43,20 +63,172 @@ type Resolverers interface {
 	// Refreshing tokens.
 	// It takes refresh token from request and using authorization.RefreshToken
 	RefreshToken(params graphql.ResolveParams) (*authorization.Tokens, error)
+
+	// Passwordless login, first step.
+	// Creates one-time code and login link for email and sends it to the user.
+	// Always succeeds for unknown emails to not reveal registered users.
+	RequestLoginCode(params graphql.ResolveParams) (interface{}, error)
+
+	// Passwordless login, second step.
+	// It takes email and code (or token from login link), verifies it with
+	// authorization.VerifyOneTimeCode and returns tokens from authorization.CreateToken
+	LoginWithCode(params graphql.ResolveParams) (*authorization.Tokens, error)
+
+	// Names of configured OpenID Connect providers
+	OidcProviders() []string
+
+	// Start login with external identity provider.
+	// Returns url of provider login page and state. When "link" argument is true
+	// user must be authorized and the flow can be finished only with IdentityLink.
+	OidcAuthURL(params graphql.ResolveParams) (interface{}, error)
+
+	// Finish login with external identity provider.
+	// It takes code and state from provider redirect, verifies ID token and returns tokens
+	// of linked user. New user is registered when identity is not linked yet.
+	OidcLogin(params graphql.ResolveParams) (*authorization.Tokens, error)
+
+	// Link external identity to authorized user.
+	// It takes code and state from provider redirect of flow started with "link" argument.
+	IdentityLink(params graphql.ResolveParams) (interface{}, error)
+
+	// Remove link between authorized user and identity provider
+	IdentityUnlink(params graphql.ResolveParams) (interface{}, error)
+
+	// Send one-time code to the phone of authorized user by SMS
+	RequestPhoneVerification(params graphql.ResolveParams) (interface{}, error)
+
+	// Check code from SMS and mark phone of authorized user as verified
+	VerifyPhone(params graphql.ResolveParams) (interface{}, error)
+
+	// Approve or deny device authorization (RFC 8628) by user code shown on device.
+	// After approval device receives tokens of authorized user from token endpoint.
+	ApproveDevice(params graphql.ResolveParams) (interface{}, error)
+
+	// Schedule deletion of authorized user after grace period.
+	// Account can be restored by CancelAccountDeletion until then.
+	RequestAccountDeletion(params graphql.ResolveParams) (interface{}, error)
+
+	// Cancel scheduled deletion of authorized user
+	CancelAccountDeletion(params graphql.ResolveParams) (interface{}, error)
+
+	// Delete accounts with expired grace period and old export archives.
+	// Called periodically by background worker, returns number of deleted accounts.
+	PurgeDeletedAccounts(ctx context.Context) (int, error)
+
+	// Create zip archive with profile, payments, identities and sessions of authorized user.
+	// Returns signed link for ExportHandler which expires in ExportTTL.
+	ExportMyData(params graphql.ResolveParams) (interface{}, error)
+
+	// Change account status (active, suspended, deactivated, pending_verification) with reason.
+	// Available for admins only. Sessions of not active user are revoked immediately.
+	SetStatus(params graphql.ResolveParams) (*UserType, error)
+
+	// Serve archive created by ExportMyData, checks signature of link
+	ExportHandler(w http.ResponseWriter, req *http.Request)
+
+	// Send email to user when category is allowed by settings, used by other packages as well
+	Notify(ctx context.Context, userId uint64, category string, compose func(email string, f *locale.Formatter) mailer.Message) error
+
+	// Replace avatar of authorized user with image from multipart request.
+	// Image is checked, cropped to square and stored in AvatarSizes as JPEG.
+	UploadAvatar(params graphql.ResolveParams) (*UserType, error)
+
+	// Change preferences of authorized user, only passed arguments are changed.
+	// Emails are formatted and filtered according to these settings.
+	UpdateSettings(params graphql.ResolveParams) (*Settings, error)
+
+	// Check if login or email can be used for registration.
+	// Values are compared after normalization, case does not matter.
+	IsLoginAvailable(params graphql.ResolveParams) (bool, error)
+	IsEmailAvailable(params graphql.ResolveParams) (bool, error)
 }
 
 type Resolvers struct {
-	pgsql       *sqlx.DB
-	RedisClient *redis.Client
+	pgsql        *sqlx.DB
+	RedisClient  *redis.Client
+	auth         *authorization.Config
+	mailer       mailer.Mailer
+	loginLinkURL string
+	oidc         *oidc.Registry
+	sms          sms.SMSSender
+
+	deletionGracePeriod time.Duration
+	exportsDir          string
+	publicURL           string
+	signer              *signedurl.Signer
+	blobs               blobstore.BlobStore
 }
 
-func GetResolvers(pgsql *sqlx.DB, client *redis.Client) Resolverers {
-	return &Resolvers{pgsql: pgsql, RedisClient: client}
+// services used by user resolvers besides storages
+type Options struct {
+	Auth   *authorization.Config
+	Mailer mailer.Mailer
+	// page of client app which takes email and code from passwordless login link
+	LoginLinkURL string
+	Oidc         *oidc.Registry
+	SMS          sms.SMSSender
+	// time between deletion request and purge, DefaultDeletionGracePeriod when empty
+	DeletionGracePeriod time.Duration
+	// directory for data export archives
+	ExportsDir string
+	// base url of this server for links to exports
+	PublicURL string
+	Signer    *signedurl.Signer
+	// storage of avatars, uploads are disabled when empty
+	Blobs blobstore.BlobStore
+}
+
+// resolvers of User type fields like avatarUrl and history, set by GetResolvers
+var fieldResolvers *Resolvers
+
+func GetResolvers(pgsql *sqlx.DB, client *redis.Client, options Options) Resolverers {
+	if options.DeletionGracePeriod <= 0 {
+		options.DeletionGracePeriod = DefaultDeletionGracePeriod
+	}
+
+	fieldResolvers = &Resolvers{
+		pgsql:        pgsql,
+		RedisClient:  client,
+		auth:         options.Auth,
+		mailer:       options.Mailer,
+		loginLinkURL: options.LoginLinkURL,
+		oidc:         options.Oidc,
+		sms:          options.SMS,
+
+		deletionGracePeriod: options.DeletionGracePeriod,
+		exportsDir:          options.ExportsDir,
+		publicURL:           options.PublicURL,
+		signer:              options.Signer,
+		blobs:               options.Blobs,
+	}
+
+	return fieldResolvers
+}
+
+// get id of authorized user from access token in context
+func (r *Resolvers) currentUserId(params graphql.ResolveParams) (uint64, error) {
+	authToken, _ := params.Context.Value(authorization.AuthHeaderKey).(string)
+	token, err := authorization.ExtractTokenMetadata(r.auth, authToken)
+
+	if err != nil {
+		return 0, fmt.Errorf("auth required")
+	}
+
+	userId, err := authorization.FetchAuth(token, r.RedisClient, params.Context)
+	if err != nil {
+		return 0, fmt.Errorf("auth required")
+	}
+
+	if err := authorization.CheckActive(params.Context, r.pgsql, userId); err != nil {
+		return 0, err
+	}
+
+	return userId, nil
 }
 
 func (r *Resolvers) User(params graphql.ResolveParams) (*UserType, error) {
 	requestToken := params.Context.Value(authorization.AuthHeaderKey)
-	token, err := authorization.ExtractTokenMetadata(requestToken.(string))
+	token, err := authorization.ExtractTokenMetadata(r.auth, requestToken.(string))
 
 	if err != nil {
 		return nil, err
@@ -67,8 +239,17 @@ func (r *Resolvers) User(params graphql.ResolveParams) (*UserType, error) {
 		return nil, err
 	}
 
+	if err := authorization.CheckActive(params.Context, r.pgsql, userId); err != nil {
+		return nil, err
+	}
+
+	return r.loadUser(userId)
+}
+
+// get user with payments and linked identities
+func (r *Resolvers) loadUser(userId uint64) (*UserType, error) {
 	var user UserType
-	err = r.pgsql.Get(&user, "SELECT * FROM users WHERE id=$1", userId)
+	err := r.pgsql.Get(&user, "SELECT * FROM users WHERE id=$1", userId)
 
 	if err != nil {
 		return nil, err
@@ -83,26 +264,30 @@ func (r *Resolvers) User(params graphql.ResolveParams) (*UserType, error) {
 
 	user.Payments = payments
 
-	return &user, nil
-}
+	var identities []Identity
+	err = r.pgsql.Select(&identities, "SELECT * FROM user_identities WHERE user_id=$1 ORDER BY provider", userId)
 
-func (r *Resolvers) AllUsers() ([]UserType, error) {
-	var users []UserType
+	if err != nil {
+		return nil, err
+	}
 
-	err := r.pgsql.Select(&users, "SELECT * FROM users ORDER BY first_name")
+	user.Identities = identities
 
+	settings, err := r.loadSettings(context.Background(), userId)
 	if err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	user.Settings = settings
+
+	return &user, nil
 }
 
 func (r *Resolvers) Login(params graphql.ResolveParams) (*authorization.Tokens, error) {
 	args := params.Args
 	var user UserLogin
 
-	err := r.pgsql.Get(&user, "SELECT id, password FROM users WHERE login=$1", args["login"])
+	err := r.pgsql.Get(&user, "SELECT id, password FROM users WHERE login=$1", NormalizeLogin(args["login"].(string)))
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +298,7 @@ func (r *Resolvers) Login(params graphql.ResolveParams) (*authorization.Tokens,
 		return nil, fmt.Errorf("authorization failed")
 	}
 
-	token, err := authorization.CreateToken(user.Id, r.RedisClient, params.Context)
+	token, err := authorization.CreateToken(r.auth, user.Id, r.RedisClient, params.Context)
 
 	if err != nil {
 		return nil, err
@@ -127,12 +312,21 @@ func (r *Resolvers) Create(params graphql.ResolveParams) (*authorization.Tokens,
 
 	var Input UserInput
 
-	if val, ok := args["first_name"]; ok {
-		Input.First_name = val.(string)
+	fields := []struct {
+		column string
+		target *string
+	}{
+		{"first_name", &Input.First_name},
+		{"last_name", &Input.Last_name},
+		{"login", &Input.Login},
+		{"email", &Input.Email},
 	}
-
-	if val, ok := args["login"]; ok {
-		Input.Login = val.(string)
+	for _, field := range fields {
+		value, err := validateField(field.column, args[field.column].(string))
+		if err != nil {
+			return nil, err
+		}
+		*field.target = value
 	}
 
 	if val, ok := args["password"]; ok {
@@ -143,30 +337,25 @@ func (r *Resolvers) Create(params graphql.ResolveParams) (*authorization.Tokens,
 		Input.Password = string(hashedPassword)
 	}
 
-	if val, ok := args["last_name"]; ok {
-		Input.Last_name = val.(string)
-	}
-
-	if val, ok := args["phone"]; ok {
-		Input.Phone = val.(string)
-	}
-
-	if val, ok := args["email"]; ok {
-		Input.Email = val.(string)
+	if val, ok := args["phone"]; ok && val.(string) != "" {
+		phone, err := NormalizePhone(val.(string))
+		if err != nil {
+			return nil, err
+		}
+		Input.Phone = &phone
 	}
 
-	insertUser := `INSERT INTO users (first_name, last_name, login, password, phone, email) 
-				VALUES(:first_name, :last_name, :login, :password, :phone, :email) RETURNING id`
-	result, err := r.pgsql.NamedQuery(insertUser, Input)
-
+	var lastId int
+	err := r.pgsql.Get(&lastId,
+		`INSERT INTO users (first_name, last_name, login, password, phone, email)
+		VALUES($1, $2, $3, $4, $5, $6) RETURNING id`,
+		Input.First_name, Input.Last_name, Input.Login, Input.Password, Input.Phone, Input.Email,
+	)
 	if err != nil {
-		return nil, err
+		return nil, constraintError(err)
 	}
 
-	var lastId int
-	result.Scan(&lastId)
-
-	token, err := authorization.CreateToken(lastId, r.RedisClient, params.Context)
+	token, err := authorization.CreateToken(r.auth, lastId, r.RedisClient, params.Context)
 
 	if err != nil {
 		return nil, fmt.Errorf("unable to create token: %s", err)
@@ -175,9 +364,9 @@ func (r *Resolvers) Create(params graphql.ResolveParams) (*authorization.Tokens,
 	return &authorization.Tokens{AccessToken: token.AccessToken, RefreshToken: token.RefreshToken}, nil
 }
 
-func (r *Resolvers) Update(params graphql.ResolveParams) (interface{}, error) {
+func (r *Resolvers) Update(params graphql.ResolveParams) (*UserType, error) {
 	authToken := params.Context.Value(authorization.AuthHeaderKey).(string)
-	token, err := authorization.ExtractTokenMetadata(authToken)
+	token, err := authorization.ExtractTokenMetadata(r.auth, authToken)
 
 	if err != nil {
 		return nil, fmt.Errorf("auth required")
@@ -188,34 +377,117 @@ func (r *Resolvers) Update(params graphql.ResolveParams) (interface{}, error) {
 		return nil, fmt.Errorf("undefined user_id")
 	}
 
-	updateColumns := []string{
-		"first_name",
-		"last_name",
-		"phone",
-		"email",
+	if err := authorization.CheckActive(params.Context, r.pgsql, userId); err != nil {
+		return nil, err
 	}
 
-	var result []string
+	update := sqlpatch.NewUpdate("users")
+
+	// required columns, null is not allowed
+	for _, columnName := range []string{"first_name", "last_name", "email"} {
+		arg := sqlpatch.Arg(params, columnName)
+		if !arg.Present {
+			continue
+		}
+
+		if arg.Null {
+			return nil, fmt.Errorf("%s can not be null", columnName)
+		}
+
+		value, err := validateField(columnName, arg.Value.(string))
+		if err != nil {
+			return nil, err
+		}
+		update.Set(columnName, value)
+	}
 
-	for _, columnName := range updateColumns {
-		if val, ok := params.Args[columnName]; ok {
-			result = append(result, columnName+"='"+val.(string)+"'")
+	phone := sqlpatch.Arg(params, "phone")
+	if phone.Present && (phone.Null || strings.TrimSpace(phone.Value.(string)) == "") {
+		update.Set("phone", nil)
+		update.SetExpr("phone_verified_at", "NULL")
+	} else if phone.Present {
+		normalized, err := NormalizePhone(phone.Value.(string))
+		if err != nil {
+			return nil, err
 		}
+		update.Set("phone", normalized)
+		// new phone has to be verified again
+		update.SetExpr("phone_verified_at", "CASE WHEN phone = ? THEN phone_verified_at END", normalized)
 	}
 
-	queryString := strings.Join(result, ",")
-	updateUser := fmt.Sprintf("UPDATE users SET %s WHERE id=$1 RETURNING id", queryString)
-	queryResult := r.pgsql.QueryRowx(updateUser, userId)
+	if update.Len() == 0 {
+		return nil, fmt.Errorf("nothing to update")
+	}
 
-	var resultUserId int
-	queryResult.Scan(&resultUserId)
+	update.SetExpr("updated_at", "NOW()")
 
-	return map[string]int{"id": resultUserId}, nil
+	query, args, err := update.Build("id = ?", profileColumns, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.pgsql.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var before, after profileFields
+	if err := tx.Get(&before, "SELECT "+profileColumns+" FROM users WHERE id=$1 FOR UPDATE", userId); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Get(&after, query, args...); err != nil {
+		return nil, constraintError(err)
+	}
+
+	if err := recordChanges(tx, userId, userId, before.values(), after.values()); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.loadUser(userId)
+}
+
+// trim and validate value of user column
+func validateField(columnName string, value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	switch columnName {
+	case "login":
+		value = NormalizeLogin(value)
+	case "email":
+		value = NormalizeEmail(value)
+	}
+
+	if value == "" {
+		return "", &FieldError{Field: columnName, Code: ErrorCodeInvalid, Message: fmt.Sprintf("%s can not be empty", columnName)}
+	}
+
+	if len(value) > 255 {
+		return "", &FieldError{Field: columnName, Code: ErrorCodeInvalid, Message: fmt.Sprintf("%s is too long", columnName)}
+	}
+
+	if columnName == "email" {
+		at := strings.Index(value, "@")
+		if at < 1 || at != strings.LastIndex(value, "@") || at == len(value)-1 || strings.ContainsAny(value, " \t\r\n") {
+			return "", &FieldError{Field: columnName, Code: ErrorCodeInvalid, Message: "email is not valid"}
+		}
+	}
+
+	if columnName == "login" && strings.ContainsAny(value, " \t\r\n") {
+		return "", &FieldError{Field: columnName, Code: ErrorCodeInvalid, Message: "login can not contain spaces"}
+	}
+
+	return value, nil
 }
 
 func (r *Resolvers) Logout(params graphql.ResolveParams) (interface{}, error) {
 	authToken := params.Context.Value(authorization.AuthHeaderKey).(string)
-	token, err := authorization.ExtractTokenMetadata(authToken)
+	token, err := authorization.ExtractTokenMetadata(r.auth, authToken)
 
 	if err != nil {
 		return nil, err
@@ -236,10 +508,95 @@ func (r *Resolvers) RefreshToken(params graphql.ResolveParams) (*authorization.T
 		return nil, fmt.Errorf("refresh token required")
 	}
 
-	token, err := authorization.Refresh(authToken, r.RedisClient, params.Context)
+	token, err := authorization.Refresh(r.auth, authToken, r.RedisClient, params.Context)
 	if err != nil {
 		return nil, err
 	}
 
 	return &authorization.Tokens{AccessToken: token["access_token"], RefreshToken: token["refresh_token"]}, nil
 }
+
+const loginCodePurpose = "login"
+
+func (r *Resolvers) RequestLoginCode(params graphql.ResolveParams) (interface{}, error) {
+	email := NormalizeEmail(params.Args["email"].(string))
+	if email == "" {
+		return nil, fmt.Errorf("email required")
+	}
+
+	code, err := authorization.CreateOneTimeCode(loginCodePurpose, email, r.RedisClient, params.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	var userId uint64
+	err = r.pgsql.Get(&userId, "SELECT id FROM users WHERE email=$1", email)
+	if err == sql.ErrNoRows {
+		return map[string]bool{"success": true}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := loginLink(r.loginLinkURL, email, code.LinkToken)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Notify(params.Context, userId, NotificationSecurity, func(to string, f *locale.Formatter) mailer.Message {
+		return mailer.Message{
+			To:      to,
+			Subject: "Your login code",
+			Body: fmt.Sprintf(
+				"Your login code is %s\n\nOr open this link to log in:\n%s\n\nThe code expires at %s.",
+				code.Code, link, f.DateTime(code.ExpiresAt),
+			),
+		}
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to send login code: %s", err)
+	}
+
+	return map[string]bool{"success": true}, nil
+}
+
+// link of login page with email and code, query and fragment of page url are kept
+func loginLink(pageURL string, email string, token string) (string, error) {
+	link, err := url.Parse(pageURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid login link url: %s", err)
+	}
+
+	query := link.Query()
+	query.Set("email", email)
+	query.Set("code", token)
+	link.RawQuery = query.Encode()
+
+	return link.String(), nil
+}
+
+func (r *Resolvers) LoginWithCode(params graphql.ResolveParams) (*authorization.Tokens, error) {
+	email := NormalizeEmail(params.Args["email"].(string))
+	code := strings.TrimSpace(params.Args["code"].(string))
+
+	err := authorization.VerifyOneTimeCode(loginCodePurpose, email, code, r.RedisClient, params.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	var userId int
+	err = r.pgsql.Get(&userId, "SELECT id FROM users WHERE email=$1", email)
+	if err != nil {
+		return nil, fmt.Errorf("authorization failed")
+	}
+
+	token, err := authorization.CreateToken(r.auth, userId, r.RedisClient, params.Context)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &authorization.Tokens{AccessToken: token.AccessToken, RefreshToken: token.RefreshToken}, nil
+}
@@ -0,0 +1,98 @@
+package user
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/db/dbtest"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/graphql-go/graphql"
+)
+
+func TestCreateReturnsToken(t *testing.T) {
+	db := dbtest.Open(t)
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	// token is created only for active users, as in main
+	auth := &authorization.Config{
+		AccessSecret:  strings.Repeat("a", authorization.MinSecretLength),
+		RefreshSecret: strings.Repeat("r", authorization.MinSecretLength),
+		UserAllowed: func(ctx context.Context, userId uint64) error {
+			return authorization.CheckActive(ctx, db, userId)
+		},
+	}
+	r := GetResolvers(db, client, Options{Auth: auth})
+
+	tokens, err := r.Create(graphql.ResolveParams{
+		Context: context.Background(),
+		Args: map[string]interface{}{
+			"first_name": "New",
+			"last_name":  "User",
+			"login":      "new-user",
+			"email":      "new-user@mail.com",
+			"password":   "secret password",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	token, err := authorization.ExtractTokenMetadata(auth, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("access token is invalid: %v", err)
+	}
+
+	var login string
+	if err := db.Get(&login, "SELECT login FROM users WHERE id=$1", token.UserId); err != nil || login != "new-user" {
+		t.Fatalf("token of user %d has login %q, %v, want new-user", token.UserId, login, err)
+	}
+}
+
+func TestLoginLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    string
+		email   string
+		want    string
+		wantErr bool
+	}{
+		{name: "page", page: "https://app.example.com/login", email: "user@mail.com", want: "https://app.example.com/login?code=token&email=user%40mail.com"},
+		{name: "email with plus", page: "https://app.example.com/login", email: "user+tag@mail.com", want: "https://app.example.com/login?code=token&email=user%2Btag%40mail.com"},
+		{name: "page with query", page: "https://app.example.com/login?lang=en", email: "user@mail.com", want: "https://app.example.com/login?code=token&email=user%40mail.com&lang=en"},
+		{name: "values of page are replaced", page: "https://app.example.com/login?code=old&email=old", email: "user@mail.com", want: "https://app.example.com/login?code=token&email=user%40mail.com"},
+		{name: "page with fragment", page: "https://app.example.com/#/login", email: "user@mail.com", want: "https://app.example.com/?code=token&email=user%40mail.com#/login"},
+		{name: "invalid page", page: "https://app.example.com/%zz", email: "user@mail.com", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			link, err := loginLink(test.page, test.email, "token")
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got link %s, want error", link)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("loginLink: %v", err)
+			}
+
+			if link != test.want {
+				t.Fatalf("got link %s, want %s", link, test.want)
+			}
+
+			parsed, _ := url.Parse(link)
+			if parsed.Query().Get("email") != test.email {
+				t.Fatalf("got email %q from link", parsed.Query().Get("email"))
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package user
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/Moranilt/go-graphql-location/pagination"
+	"github.com/graphql-go/graphql"
+)
+
+const maxSearchQueryLength = 100
+
+// private use characters around matches in ts_headline, replaced by tags after escaping
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+type SearchResult struct {
+	User      *UserType `json:"user"`
+	Rank      float64   `json:"rank"`
+	Highlight string    `json:"highlight"`
+}
+
+type searchRow struct {
+	UserType
+	Rank      float64 `db:"rank"`
+	RankText  string  `db:"rank_text"`
+	Highlight string  `db:"highlight"`
+}
+
+// convert user input to prefix tsquery: "jo smi" -> "jo:* & smi:*".
+// Only letters, digits and email/phone characters are kept, so operators of tsquery can't be injected
+func prefixQuery(query string) string {
+	var terms []string
+
+	for _, word := range strings.Fields(query) {
+		term := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '@' || r == '.' || r == '_' || r == '+' || r == '-' {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, word)
+
+		term = strings.Trim(term, ".-_+@")
+		if term != "" {
+			terms = append(terms, term+":*")
+		}
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// escape user data of headline and wrap matches in <b></b>
+func highlightHTML(headline string) string {
+	return strings.NewReplacer(highlightStart, "<b>", highlightStop, "</b>").Replace(html.EscapeString(headline))
+}
+
+func (r *Resolvers) SearchUsers(params graphql.ResolveParams) (*pagination.Connection, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorization.CheckRole(r.pgsql, userId, authorization.RoleAdmin, authorization.RoleSupport); err != nil {
+		return nil, err
+	}
+
+	first, err := pagination.First(params.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	query := strings.TrimSpace(params.Args["query"].(string))
+	if len(query) > maxSearchQueryLength {
+		return nil, fmt.Errorf("query is too long")
+	}
+
+	tsQuery := prefixQuery(query)
+	if tsQuery == "" {
+		return nil, fmt.Errorf("query is empty")
+	}
+
+	const sortKey = "rank"
+
+	filter := &pagination.Filter{}
+	queryArg := filter.Arg(query)
+	tsQueryArg := filter.Arg(tsQuery)
+	markersArg := filter.Arg(highlightStart + highlightStop)
+	headlineArg := filter.Arg(fmt.Sprintf(`StartSel="%s", StopSel="%s", HighlightAll=true`, highlightStart, highlightStop))
+
+	// full-text match by word prefixes or trigram similarity for typos.
+	// Markers are removed from text, so only ts_headline is able to add them
+	ranked := fmt.Sprintf(`SELECT users.*,
+			(ts_rank(users.search_vector, to_tsquery('simple', %[2]s)) + word_similarity(%[1]s, users.search_text))::float8 AS rank,
+			ts_headline('simple', translate(users.search_text, %[3]s, ''), to_tsquery('simple', %[2]s), %[4]s) AS highlight
+		FROM users
+		WHERE users.search_vector @@ to_tsquery('simple', %[2]s) OR %[1]s <%% users.search_text`, queryArg, tsQueryArg, markersArg, headlineArg)
+
+	var totalCount int
+	err = r.pgsql.Get(&totalCount, "SELECT COUNT(*) FROM ("+ranked+") ranked", filter.Args...)
+	if err != nil {
+		return nil, err
+	}
+
+	after, _ := params.Args["after"].(string)
+	if after != "" {
+		cursor, err := pagination.DecodeCursor(after, sortKey)
+		if err != nil {
+			return nil, err
+		}
+		filter.Add("(ranked.rank, ranked.id) < (?::float8, ?)", cursor.Value, cursor.Id)
+	}
+
+	statement := fmt.Sprintf(
+		"SELECT ranked.*, ranked.rank::text AS rank_text FROM (%s) ranked%s ORDER BY ranked.rank DESC, ranked.id DESC LIMIT %s",
+		ranked, filter.Where(), filter.Arg(first+1),
+	)
+
+	var rows []searchRow
+	if err := r.pgsql.Select(&rows, statement, filter.Args...); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]interface{}, len(rows))
+	cursors := make([]string, len(rows))
+	for i := range rows {
+		nodes[i] = &SearchResult{User: &rows[i].UserType, Rank: rows[i].Rank, Highlight: highlightHTML(rows[i].Highlight)}
+		cursors[i] = pagination.EncodeCursor(pagination.Cursor{
+			Sort:  sortKey,
+			Value: rows[i].RankText,
+			Id:    int64(rows[i].Id),
+		})
+	}
+
+	return pagination.NewConnection(nodes, cursors, first, after != "", totalCount), nil
+}
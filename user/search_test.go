@@ -0,0 +1,40 @@
+package user
+
+import "testing"
+
+func TestHighlightHTML(t *testing.T) {
+	tests := []struct {
+		headline string
+		want     string
+	}{
+		{headline: highlightStart + "John" + highlightStop + " Smith", want: "<b>John</b> Smith"},
+		{headline: highlightStart + "<script>" + highlightStop + "alert(1)</script>", want: "<b>&lt;script&gt;</b>alert(1)&lt;/script&gt;"},
+		{headline: `"quoted" & 'single'`, want: "&#34;quoted&#34; &amp; &#39;single&#39;"},
+		{headline: "<b>fake</b>", want: "&lt;b&gt;fake&lt;/b&gt;"},
+	}
+
+	for _, test := range tests {
+		if got := highlightHTML(test.headline); got != test.want {
+			t.Errorf("highlightHTML(%q) = %q, want %q", test.headline, got, test.want)
+		}
+	}
+}
+
+func TestPrefixQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "jo smi", want: "jo:* & smi:*"},
+		{query: "John.Smith@Example.com", want: "john.smith@example.com:*"},
+		{query: "a & b | !c", want: "a:* & b:* & c:*"},
+		{query: "x:* <-> (y)", want: "x:* & y:*"},
+		{query: "&& ..", want: ""},
+	}
+
+	for _, test := range tests {
+		if got := prefixQuery(test.query); got != test.want {
+			t.Errorf("prefixQuery(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
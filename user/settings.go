@@ -0,0 +1,167 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/Moranilt/go-graphql-location/locale"
+	"github.com/Moranilt/go-graphql-location/mailer"
+	"github.com/graphql-go/graphql"
+)
+
+// categories of emails, security emails can not be disabled
+const (
+	NotificationSecurity  = "security"
+	NotificationAccount   = "account"
+	NotificationPayments  = "payments"
+	NotificationMarketing = "marketing"
+)
+
+type Settings struct {
+	Locale           string  `json:"locale" db:"locale"`
+	Timezone         string  `json:"timezone" db:"timezone"`
+	Currency         string  `json:"currency" db:"currency"`
+	Notify_account   bool    `json:"notify_account" db:"notify_account"`
+	Notify_payments  bool    `json:"notify_payments" db:"notify_payments"`
+	Notify_marketing bool    `json:"notify_marketing" db:"notify_marketing"`
+	Updated_at       *string `json:"updated_at" db:"updated_at"`
+}
+
+// settings of user who never changed them, same as column defaults of user_settings
+func DefaultSettings() Settings {
+	return Settings{
+		Locale:          locale.DefaultLocale,
+		Timezone:        locale.DefaultTimezone,
+		Currency:        locale.DefaultCurrency,
+		Notify_account:  true,
+		Notify_payments: true,
+	}
+}
+
+func (s *Settings) Validate() error {
+	if err := locale.ValidateLocale(s.Locale); err != nil {
+		return err
+	}
+
+	if err := locale.ValidateTimezone(s.Timezone); err != nil {
+		return err
+	}
+
+	return locale.ValidateCurrency(s.Currency)
+}
+
+// check opt-in for category of email
+func (s *Settings) Allows(category string) bool {
+	switch category {
+	case NotificationSecurity:
+		return true
+	case NotificationAccount:
+		return s.Notify_account
+	case NotificationPayments:
+		return s.Notify_payments
+	case NotificationMarketing:
+		return s.Notify_marketing
+	}
+
+	return false
+}
+
+func (s *Settings) Formatter() *locale.Formatter {
+	return locale.New(s.Locale, s.Timezone, s.Currency)
+}
+
+func (r *Resolvers) loadSettings(ctx context.Context, userId uint64) (*Settings, error) {
+	var settings Settings
+	err := r.pgsql.GetContext(ctx, &settings,
+		`SELECT locale, timezone, currency, notify_account, notify_payments, notify_marketing, updated_at
+		FROM user_settings WHERE user_id=$1`,
+		userId,
+	)
+
+	if err == sql.ErrNoRows {
+		settings = DefaultSettings()
+		return &settings, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+func (r *Resolvers) UpdateSettings(params graphql.ResolveParams) (*Settings, error) {
+	userId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := r.loadSettings(params.Context, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	args := params.Args
+	if value, ok := args["locale"].(string); ok {
+		settings.Locale = value
+	}
+	if value, ok := args["timezone"].(string); ok {
+		settings.Timezone = value
+	}
+	if value, ok := args["currency"].(string); ok {
+		settings.Currency = value
+	}
+	if value, ok := args["notify_account"].(bool); ok {
+		settings.Notify_account = value
+	}
+	if value, ok := args["notify_payments"].(bool); ok {
+		settings.Notify_payments = value
+	}
+	if value, ok := args["notify_marketing"].(bool); ok {
+		settings.Notify_marketing = value
+	}
+
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	err = r.pgsql.GetContext(params.Context, &settings.Updated_at,
+		`INSERT INTO user_settings (user_id, locale, timezone, currency, notify_account, notify_payments, notify_marketing)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE SET
+			locale=EXCLUDED.locale, timezone=EXCLUDED.timezone, currency=EXCLUDED.currency,
+			notify_account=EXCLUDED.notify_account, notify_payments=EXCLUDED.notify_payments,
+			notify_marketing=EXCLUDED.notify_marketing, updated_at=NOW()
+		RETURNING updated_at`,
+		userId, settings.Locale, settings.Timezone, settings.Currency,
+		settings.Notify_account, settings.Notify_payments, settings.Notify_marketing,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// send email to user when category is allowed by settings.
+// Message is composed with formatter for locale, timezone and currency of user.
+func (r *Resolvers) Notify(ctx context.Context, userId uint64, category string, compose func(email string, f *locale.Formatter) mailer.Message) error {
+	settings, err := r.loadSettings(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	if !settings.Allows(category) {
+		log.Printf("%s email for user %d is disabled by settings", category, userId)
+		return nil
+	}
+
+	var email string
+	if err := r.pgsql.GetContext(ctx, &email, "SELECT email FROM users WHERE id=$1", userId); err != nil {
+		return fmt.Errorf("unable to find email of user %d: %s", userId, err)
+	}
+
+	return r.mailer.Send(ctx, compose(email, settings.Formatter()))
+}
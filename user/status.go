@@ -0,0 +1,86 @@
+package user
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Moranilt/go-graphql-location/authorization"
+	"github.com/graphql-go/graphql"
+)
+
+func (r *Resolvers) SetStatus(params graphql.ResolveParams) (*UserType, error) {
+	adminId, err := r.currentUserId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorization.CheckRole(r.pgsql, adminId, authorization.RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	userId := uint64(params.Args["user_id"].(int))
+	status := params.Args["status"].(string)
+	reason, _ := params.Args["reason"].(string)
+	reason = strings.TrimSpace(reason)
+
+	if userId == adminId {
+		return nil, fmt.Errorf("unable to change status of own account")
+	}
+
+	if status != authorization.StatusActive && reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+
+	var nullableReason *string
+	if reason != "" {
+		nullableReason = &reason
+	}
+
+	tx, err := r.pgsql.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var before struct {
+		Status        string  `db:"status"`
+		Status_reason *string `db:"status_reason"`
+	}
+	err = tx.Get(&before, "SELECT status, status_reason FROM users WHERE id=$1 FOR UPDATE", userId)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET status=$2, status_reason=$3, status_changed_at=NOW(), updated_at=NOW() WHERE id=$1",
+		userId, status, nullableReason,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordChanges(tx, userId, adminId,
+		map[string]*string{"status": &before.Status, "status_reason": before.Status_reason},
+		map[string]*string{"status": &status, "status_reason": nullableReason},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// blocked user must not stay logged in until tokens expire
+	if status != authorization.StatusActive {
+		if err := authorization.RevokeUserSessions(userId, r.RedisClient, params.Context); err != nil {
+			return nil, fmt.Errorf("status is changed, but sessions are not revoked: %s", err)
+		}
+	}
+
+	return r.loadUser(userId)
+}
@@ -1,34 +1,53 @@
 package user
 
 import (
+	"github.com/Moranilt/go-graphql-location/money"
+	"github.com/Moranilt/go-graphql-location/pagination"
 	"github.com/Moranilt/go-graphql-location/payments"
 	"github.com/graphql-go/graphql"
 )
 
 // inheritance is not working for structs with graphql.ResolverFunc
 type UserType struct {
-	Id         int                `json:"_id"`
-	Created_at string             `json:"created_at"`
-	Updated_at string             `json:"updated_at"`
-	First_name string             `json:"first_name" db:"first_name"`
-	Last_name  string             `json:"last_name" db:"last_name"`
-	Phone      string             `json:"phone" db:"phone"`
-	Email      string             `json:"email" db:"email"`
-	Login      string             `json:"login" db:"login"`
-	Password   string             `json:"password" db:"password"`
-	Last_login string             `json:"last_login" db:"last_login"`
-	Payments   []payments.Payment `json:"payments"`
+	Id         int     `json:"_id"`
+	Created_at string  `json:"created_at"`
+	Updated_at string  `json:"updated_at"`
+	First_name string  `json:"first_name" db:"first_name"`
+	Last_name  string  `json:"last_name" db:"last_name"`
+	Phone      *string `json:"phone" db:"phone"`
+	Email      string  `json:"email" db:"email"`
+	Login      string  `json:"login" db:"login"`
+	Password   string  `json:"password" db:"password"`
+	Last_login string  `json:"last_login" db:"last_login"`
+	// set when phone was confirmed by code from SMS
+	Phone_verified_at *string `json:"phone_verified_at" db:"phone_verified_at"`
+	// user, support or admin
+	Role string `json:"role" db:"role"`
+	// active, suspended, deactivated or pending_verification
+	Status            string  `json:"status" db:"status"`
+	Status_reason     *string `json:"status_reason" db:"status_reason"`
+	Status_changed_at *string `json:"status_changed_at" db:"status_changed_at"`
+	// account is deleted after this date when deletion was requested
+	Delete_after *string `json:"delete_after" db:"delete_after"`
+	// common prefix of avatar files in blob store
+	Avatar_key *string `json:"-" db:"avatar_key"`
+	// columns for search, maintained by trigger
+	Search_text   string             `json:"-" db:"search_text"`
+	Search_vector string             `json:"-" db:"search_vector"`
+	Payments      []payments.Payment `json:"payments"`
+	Identities    []Identity         `json:"identities"`
+	Settings      *Settings          `json:"settings" db:"-"`
 	// UserInput
 }
 
 // struct for storing users data
 type UserInput struct {
-	First_name string `json:"first_name" db:"first_name"`
-	Last_name  string `json:"last_name" db:"last_name"`
-	Phone      string `json:"phone" db:"phone"`
-	Email      string `json:"email" db:"email"`
-	Login      string `json:"login" db:"login"`
-	Password   string `json:"password" db:"password"`
+	First_name string  `json:"first_name" db:"first_name"`
+	Last_name  string  `json:"last_name" db:"last_name"`
+	Phone      *string `json:"phone" db:"phone"`
+	Email      string  `json:"email" db:"email"`
+	Login      string  `json:"login" db:"login"`
+	Password   string  `json:"password" db:"password"`
 }
 
 type UserLogin struct {
@@ -37,22 +56,44 @@ type UserLogin struct {
 }
 
 type Types struct {
-	User         *graphql.Object
-	Create       *graphql.Object
-	Login        *graphql.Object
-	Update       *graphql.Object
-	Logout       *graphql.Object
-	RefreshToken *graphql.Object
+	User              *graphql.Object
+	Users             *graphql.Object
+	SearchUsers       *graphql.Object
+	Create            *graphql.Object
+	Login             *graphql.Object
+	Update            *graphql.Object
+	Logout            *graphql.Object
+	RefreshToken      *graphql.Object
+	RequestLoginCode  *graphql.Object
+	Identity          *graphql.Object
+	OidcAuthURL       *graphql.Object
+	IdentityUnlink    *graphql.Object
+	PhoneVerification *graphql.Object
+	ApproveDevice     *graphql.Object
+	AccountDeletion   *graphql.Object
+	Export            *graphql.Object
+	Settings          *graphql.Object
 }
 
 func GetTypes() Types {
 	return Types{
-		User:         userType,
-		Create:       createType,
-		Login:        loginType,
-		Update:       updateType,
-		Logout:       logoutType,
-		RefreshToken: refreshTokenType,
+		User:              userType,
+		Users:             usersConnectionType,
+		SearchUsers:       searchUsersConnectionType,
+		Create:            createType,
+		Login:             loginType,
+		Update:            userType,
+		Logout:            logoutType,
+		RefreshToken:      refreshTokenType,
+		RequestLoginCode:  requestLoginCodeType,
+		Identity:          identityType,
+		OidcAuthURL:       oidcAuthURLType,
+		IdentityUnlink:    identityUnlinkType,
+		PhoneVerification: phoneVerificationType,
+		ApproveDevice:     approveDeviceType,
+		AccountDeletion:   accountDeletionType,
+		Export:            exportType,
+		Settings:          settingsType,
 	}
 }
 
@@ -76,10 +117,33 @@ var userType = graphql.NewObject(graphql.ObjectConfig{
 				Type:        graphql.String,
 				Description: "Phone number",
 			},
+			"phone_verified_at": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Phone verification date, empty when phone is not verified",
+			},
 			"email": &graphql.Field{
 				Type:        graphql.String,
 				Description: "Email",
 			},
+			"status": &graphql.Field{
+				Type:        graphql.String,
+				Description: "active, suspended, deactivated or pending_verification",
+			},
+			"status_reason": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Reason of last status change",
+			},
+			"status_changed_at": &graphql.Field{
+				Type: graphql.String,
+			},
+			"delete_after": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Scheduled deletion date, empty when deletion was not requested",
+			},
+			"role": &graphql.Field{
+				Type:        graphql.String,
+				Description: "user, support or admin",
+			},
 			"_id": &graphql.Field{
 				Type:        graphql.String,
 				Description: "users id",
@@ -93,34 +157,126 @@ var userType = graphql.NewObject(graphql.ObjectConfig{
 				Description: "Updated profile date",
 			},
 			"payments": &graphql.Field{
-				Type:        graphql.NewList(paymentType),
+				Type:        graphql.NewList(payments.GetTypes().Payment),
 				Description: "Users Payments",
 			},
+			"identities": &graphql.Field{
+				Type:        graphql.NewList(identityType),
+				Description: "Linked external identity providers",
+			},
+			"settings": &graphql.Field{
+				Type:        settingsType,
+				Description: "Preferences of user, defaults when they were never changed",
+			},
+			"balance": &graphql.Field{
+				Type:        graphql.NewList(money.Type),
+				Description: "Wallet balance per currency from ledger. Available for the user and admins",
+				Resolve:     resolveBalance,
+			},
+			"history": &graphql.Field{
+				Type:        historyConnectionType,
+				Description: "Changes of profile, newest first. Available for the user and admins",
+				Args:        pagination.Args(nil),
+				Resolve:     resolveHistory,
+			},
+			"avatarUrl": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Link to square avatar image, empty when avatar is not uploaded",
+				Args: graphql.FieldConfigArgument{
+					"size": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: DefaultAvatarSize,
+						Description:  "Width in pixels, rounded up to one of 64, 128 and 256",
+					},
+				},
+				Resolve: resolveAvatarURL,
+			},
 		}
 	}),
 })
 
-var paymentType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "PaymentType",
+var settingsType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserSettings",
 	Fields: graphql.Fields{
-		"user_id": &graphql.Field{
-			Type: graphql.Int,
+		"locale": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Language with optional region, e.g. en or de-AT",
+		},
+		"timezone": &graphql.Field{
+			Type:        graphql.String,
+			Description: "IANA timezone, e.g. Europe/Berlin",
+		},
+		"currency": &graphql.Field{
+			Type:        graphql.String,
+			Description: "ISO 4217 code of preferred currency, amounts in it are shown with symbol and others with code",
 		},
-		"amount": &graphql.Field{
-			Type: graphql.Float,
+		"notify_account": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Emails about account changes",
 		},
-		"payed": &graphql.Field{
-			Type: graphql.Boolean,
+		"notify_payments": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Emails about payments and receipts",
 		},
-		"payed_at": &graphql.Field{
+		"notify_marketing": &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "News and offers",
+		},
+		"updated_at": &graphql.Field{
 			Type: graphql.String,
 		},
+	},
+})
+
+var historyEntryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserHistoryEntry",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.String,
+		},
+		"field": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Changed column",
+		},
+		"old_value": &graphql.Field{
+			Type: graphql.String,
+		},
+		"new_value": &graphql.Field{
+			Type: graphql.String,
+		},
+		"actor_id": &graphql.Field{
+			Type:        graphql.Int,
+			Description: "User who made the change, empty for system changes",
+		},
 		"created_at": &graphql.Field{
 			Type: graphql.String,
 		},
 	},
 })
 
+var historyConnectionType = pagination.ConnectionType("UserHistory", historyEntryType)
+
+var usersConnectionType = pagination.ConnectionType("Users", userType)
+
+var userSearchResultType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserSearchResult",
+	Fields: graphql.Fields{
+		"user": &graphql.Field{
+			Type: userType,
+		},
+		"rank": &graphql.Field{
+			Type:        graphql.Float,
+			Description: "Relevance, greater is better",
+		},
+		"highlight": &graphql.Field{
+			Type:        graphql.String,
+			Description: "HTML-escaped name, login, email and phone with matches wrapped in <b></b>",
+		},
+	},
+})
+
+var searchUsersConnectionType = pagination.ConnectionType("UserSearch", userSearchResultType)
+
 var createType = graphql.NewObject(graphql.ObjectConfig{
 	Name: "CreateUser",
 	Fields: graphql.FieldsThunk(func() graphql.Fields {
@@ -149,8 +305,8 @@ var loginType = graphql.NewObject(graphql.ObjectConfig{
 	}),
 })
 
-var updateType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "UpdateUser",
+var logoutType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "LogoutUser",
 	Fields: graphql.FieldsThunk(func() graphql.Fields {
 		return graphql.Fields{
 			"id": &graphql.Field{
@@ -160,25 +316,122 @@ var updateType = graphql.NewObject(graphql.ObjectConfig{
 	}),
 })
 
-var logoutType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "LogoutUser",
+var refreshTokenType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RefreshToken",
 	Fields: graphql.FieldsThunk(func() graphql.Fields {
 		return graphql.Fields{
-			"id": &graphql.Field{
+			"access_token": &graphql.Field{
+				Type: graphql.String,
+			},
+			"refresh_token": &graphql.Field{
 				Type: graphql.String,
 			},
 		}
 	}),
 })
 
-var refreshTokenType = graphql.NewObject(graphql.ObjectConfig{
-	Name: "RefreshToken",
+var requestLoginCodeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RequestLoginCode",
 	Fields: graphql.FieldsThunk(func() graphql.Fields {
 		return graphql.Fields{
-			"access_token": &graphql.Field{
+			"success": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+		}
+	}),
+})
+
+var identityType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Identity",
+	Fields: graphql.Fields{
+		"provider": &graphql.Field{
+			Type: graphql.String,
+		},
+		"email": &graphql.Field{
+			Type: graphql.String,
+		},
+		"created_at": &graphql.Field{
+			Type: graphql.String,
+		},
+	},
+})
+
+var oidcAuthURLType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "OidcAuthUrl",
+	Fields: graphql.FieldsThunk(func() graphql.Fields {
+		return graphql.Fields{
+			"url": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Provider login page",
+			},
+			"state": &graphql.Field{
 				Type: graphql.String,
 			},
-			"refresh_token": &graphql.Field{
+		}
+	}),
+})
+
+var identityUnlinkType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "IdentityUnlink",
+	Fields: graphql.FieldsThunk(func() graphql.Fields {
+		return graphql.Fields{
+			"provider": &graphql.Field{
+				Type: graphql.String,
+			},
+		}
+	}),
+})
+
+var phoneVerificationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PhoneVerification",
+	Fields: graphql.FieldsThunk(func() graphql.Fields {
+		return graphql.Fields{
+			"phone": &graphql.Field{
+				Type: graphql.String,
+			},
+			"verified": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+		}
+	}),
+})
+
+var approveDeviceType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "ApproveDevice",
+	Fields: graphql.FieldsThunk(func() graphql.Fields {
+		return graphql.Fields{
+			"client_id": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Application which requested access",
+			},
+			"approved": &graphql.Field{
+				Type: graphql.Boolean,
+			},
+		}
+	}),
+})
+
+var accountDeletionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "AccountDeletion",
+	Fields: graphql.FieldsThunk(func() graphql.Fields {
+		return graphql.Fields{
+			"delete_after": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Account and personal data are deleted after this date",
+			},
+		}
+	}),
+})
+
+var exportType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "DataExport",
+	Fields: graphql.FieldsThunk(func() graphql.Fields {
+		return graphql.Fields{
+			"url": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Link for downloading zip archive, does not require authorization",
+			},
+			"expires_at": &graphql.Field{
 				Type: graphql.String,
 			},
 		}